@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"blockchain/maker"
+	"blockchain/statedump"
+	"fmt"
+)
+
+// importReportInterval 导入时每隔多少个区块打印一次进度
+const importReportInterval = 1000
+
+// AdminRPC_exportChain 把高度 first 到 last 的区块导出到文件，文件名以 .gz 结尾时压缩
+func AdminRPC_exportChain(maker *maker.BlockMaker, path string, first, last uint64) error {
+	if err := maker.ExportChainFile(path, first, last); err != nil {
+		fmt.Println("导出区块失败:", err)
+		return err
+	}
+	fmt.Println("导出区块", first, "到", last, "至", path)
+	return nil
+}
+
+// AdminRPC_importChain 从导出文件导入区块，中断后重新执行会跳过已导入的区块，返回新导入的区块数
+func AdminRPC_importChain(m *maker.BlockMaker, path string) (uint64, error) {
+	status, err := m.ImportChainFile(path, func(p maker.ImportProgress) {
+		if (p.Imported+p.Skipped)%importReportInterval == 0 {
+			fmt.Println("导入进度：高度", p.Height, "新导入", p.Imported, "跳过", p.Skipped)
+		}
+	})
+	if err != nil {
+		fmt.Println("导入区块失败:", err, "已导入", status.Imported, "跳过", status.Skipped)
+		return status.Imported, err
+	}
+	fmt.Println("导入完成：高度", status.Height, "新导入", status.Imported, "跳过", status.Skipped)
+	return status.Imported, nil
+}
+
+// AdminRPC_dumpState 把某个区块之后的全部账户导出到文件，blockNumber 可以是 "latest"、"earliest" 或区块高度
+func AdminRPC_dumpState(maker *maker.BlockMaker, path string, blockNumber string, format statedump.Format) (uint64, error) {
+	trie, err := maker.StateTrieAt(blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	count, err := statedump.DumpFile(path, trie, format)
+	if err != nil {
+		fmt.Println("导出状态失败:", err)
+		return count, err
+	}
+	fmt.Println("导出", count, "个账户至", path, "，状态根", trie.RootHash())
+	return count, nil
+}
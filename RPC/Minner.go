@@ -8,8 +8,12 @@ import (
 	"fmt"
 )
 
-//别人传给我一个maker，我去调用，然后广播即可
-func MinnerRPC(maker *maker.BlockMaker,minner common.Address) {
-	height:=maker.MinnerRPC(minner)
+//别人传给我一个maker，我去调用，然后广播即可；出块失败时把原因返回给调用方
+func MinnerRPC(maker *maker.BlockMaker,minner common.Address) (uint64, error) {
+	height, err := maker.MinnerRPC(minner)
+	if err != nil {
+		return height, err
+	}
 	fmt.Println("minner",minner,"打包成功，高度为",height)
+	return height, nil
 }
\ No newline at end of file
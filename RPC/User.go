@@ -2,8 +2,10 @@ package rpc
 
 import (
 	"blockchain/common"
+	"blockchain/filters"
 	"blockchain/maker"
 	"blockchain/tx"
+	"blockchain/vm"
 	"fmt"
 )
 
@@ -17,10 +19,22 @@ func UserRPC_transaction(maker *maker.BlockMaker, tx *tx.Transaction) {
 	}
 }
 
+// UserRPC_sendRawTransaction 接收钱包签好的交易（0x开头的序列化十六进制），放入交易池并返回交易哈希
+func UserRPC_sendRawTransaction(maker *maker.BlockMaker, raw string) (common.Hash, error) {
+	transaction, err := tx.DecodeRawTransaction(raw)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := maker.Txpool.NewTX(transaction); err != nil {
+		return common.Hash{}, err
+	}
+	return transaction.GetHash()
+}
+
 func UserRPC_balance(maker *maker.BlockMaker, addr common.Address) uint64 {
 	// 从状态数据库中获取账户信息
 	addrBytes := addr.Bytes()
-	accountBytes, err := maker.State.Get(addrBytes)
+	accountBytes, err := maker.Snapshots().Get(maker.State, addrBytes)
 	if err != nil {
 		fmt.Println("获取账户信息失败:", err)
 		return 0
@@ -38,3 +52,77 @@ func UserRPC_balance(maker *maker.BlockMaker, addr common.Address) uint64 {
 
 	return account.Balance
 }
+
+// UserRPC_totalSupply 查询某个高度的区块执行完后的总发行量
+func UserRPC_totalSupply(maker *maker.BlockMaker, height uint64) uint64 {
+	supply, ok := maker.Chain().GetTotalSupply(height)
+	if !ok {
+		fmt.Println("区块不存在，高度为", height)
+		return 0
+	}
+	return supply
+}
+
+// UserRPC_getBalance 查询某个区块之后的余额，blockNumber 可以是 "pending"、"latest" 或区块高度
+func UserRPC_getBalance(maker *maker.BlockMaker, addr common.Address, blockNumber string) (uint64, error) {
+	state, err := maker.StateAt(blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	account, err := state.GetAccount(addr)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// UserRPC_getNonce 查询某个区块之后账户已用到的nonce
+func UserRPC_getNonce(maker *maker.BlockMaker, addr common.Address, blockNumber string) (uint64, error) {
+	state, err := maker.StateAt(blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	account, err := state.GetAccount(addr)
+	if err != nil {
+		return 0, err
+	}
+	return account.Nonce, nil
+}
+
+// UserRPC_call 在某个区块之后的状态上试执行，不改变任何状态，返回消耗的gas
+func UserRPC_call(maker *maker.BlockMaker, msg vm.CallMsg, blockNumber string) (uint64, error) {
+	state, err := maker.StateAt(blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	return state.Call(msg)
+}
+
+// UserRPC_createAccessList 在某个区块之后的状态上跟踪执行，返回调用需要声明的访问列表和带上它时消耗的gas
+func UserRPC_createAccessList(maker *maker.BlockMaker, msg vm.CallMsg, blockNumber string) (tx.AccessList, uint64, error) {
+	state, err := maker.StateAt(blockNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state.CreateAccessList(msg)
+}
+
+// UserRPC_getTransactionReceipt 查询已上链交易的收据
+func UserRPC_getTransactionReceipt(maker *maker.BlockMaker, hash common.Hash) (*tx.Receipt, error) {
+	return maker.GetTransactionReceipt(hash)
+}
+
+// UserRPC_getTransactionByHash 查询已上链的交易，各种类型的交易都按自己的格式返回
+func UserRPC_getTransactionByHash(maker *maker.BlockMaker, hash common.Hash) (*tx.Transaction, error) {
+	transaction, _, err := maker.GetTransaction(hash)
+	return transaction, err
+}
+
+// UserRPC_getLogs 按地址和主题查询一段区块里的日志，完整的段用布隆索引加速
+func UserRPC_getLogs(maker *maker.BlockMaker, criteria filters.FilterCriteria) ([]*tx.Log, error) {
+	indexer, err := filters.NewIndexer(maker.State.DB, filters.DefaultSectionSize)
+	if err != nil {
+		return nil, err
+	}
+	return filters.NewFilter(maker, indexer, criteria).Logs()
+}
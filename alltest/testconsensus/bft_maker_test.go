@@ -0,0 +1,165 @@
+package testconsensus
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus/bft"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type bftMakerNode struct {
+	self   common.Address
+	engine *bft.BFT
+	maker  *maker.BlockMaker
+}
+
+const bftSenderKey = "5555555555555555555555555555555555555555555555555555555555555555"
+
+// newBFTMakers 4个验证者各有自己的数据库和 BlockMaker，创世区块由第一个节点产出、其余节点导入
+func newBFTMakers(t *testing.T, dbDir string, sender common.Address) ([]*bftMakerNode, *bft.Network, *bft.Config) {
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	var validators []common.Address
+	for _, key := range signerKeys {
+		signer, _ := newSigner(t, key)
+		validators = append(validators, signer)
+	}
+	config := &bft.Config{
+		Validators:       validators,
+		TimeoutPropose:   3 * time.Second,
+		TimeoutPrevote:   time.Second,
+		TimeoutPrecommit: time.Second,
+		TimeoutDelta:     500 * time.Millisecond,
+	}
+	network := bft.NewNetwork()
+	clock := bft.NewMockClock(time.Unix(0, 0))
+
+	nodes := make([]*bftMakerNode, len(signerKeys))
+	for i, key := range signerKeys {
+		db, err := mpt.NewDB(filepath.Join(dbDir, fmt.Sprintf("node%d", i)))
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		signer, signFn := newSigner(t, key)
+		engine := bft.New(config, signer, signFn, clock, network.Join(signer))
+		state := mpt.NewMPT(db)
+		//创世状态各节点一致
+		if err := vm.NewVM(state).Mint(sender); err != nil {
+			t.Fatalf("Mint failed: %v", err)
+		}
+		nodes[i] = &bftMakerNode{self: signer, engine: engine, maker: maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, engine)}
+	}
+	nodes[0].maker.MinnerRPC(nodes[0].self)
+	genesis := nodes[0].maker.Chain().GetCurrentHeader()
+	if genesis == nil {
+		t.Fatal("genesis not produced")
+	}
+	for _, node := range nodes[1:] {
+		if err := node.maker.ImportBlock(genesis, nodes[0].maker.Chain().GetBody(genesis.Hash())); err != nil {
+			t.Fatalf("import genesis: %v", err)
+		}
+	}
+	return nodes, network, config
+}
+
+func TestBFT_MakerCommitsThroughConsensus(t *testing.T) {
+	key, _ := hex.DecodeString(bftSenderKey)
+	publicKey, _ := common.PrivateKeyToPublicKey(bftSenderKey)
+	sender := common.Address{}.PublicKeyToAddress(publicKey)
+	nodes, network, config := newBFTMakers(t, "test_db_bft_maker", sender)
+
+	// 提议要接在链头上并能执行出区块头里的状态根，否则不投票
+	genesis := nodes[1].maker.Chain().GetCurrentHeader()
+	proposal := block.NewHeader(genesis)
+	nodes[0].engine.Prepare(nodes[0].maker.Chain(), proposal)
+	proposal.Timestamp = genesis.Timestamp
+	proposal.GasLimit = maker.DefaultGasLimit
+	proposal.MMRRoot = nodes[1].maker.Chain().GetMMRRoot()
+	proposal.ReceiptRoot = tx.ReceiptsRoot(nil)
+	proposal.Bloom = tx.CreateBloom(nil)
+	if err := nodes[1].engine.VerifyProposal(proposal, block.NewBlock()); err != nil {
+		t.Fatalf("valid proposal rejected: %v", err)
+	}
+	tampered := *proposal
+	tampered.Root = common.Hash{1}
+	if err := nodes[1].engine.VerifyProposal(&tampered, block.NewBlock()); err == nil {
+		t.Error("proposal with a wrong state root accepted")
+	}
+	orphan := *proposal
+	orphan.ParentHash = common.Hash{1}
+	if err := nodes[1].engine.VerifyProposal(&orphan, block.NewBlock()); err == nil {
+		t.Error("proposal not extending the head accepted")
+	}
+
+	for _, node := range nodes {
+		if err := node.maker.StartConsensus(); err != nil {
+			t.Fatalf("StartConsensus failed: %v", err)
+		}
+	}
+	// 提议者开始共识之后才交出区块，也要在本轮提议，而不是等超时换轮
+	var producer *bftMakerNode
+	for _, node := range nodes {
+		if node.self == bft.NewValidatorSet(config.Validators).Proposer(1, 0) {
+			producer = node
+		}
+	}
+	transaction := tx.NewTransaction(1, common.Address{9}, big.NewInt(10), tx.TxGas, big.NewInt(1), nil, big.NewInt(1))
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := producer.maker.Txpool.NewTX(transaction); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	done := make(chan uint64, 1)
+	go func() {
+		height, err := producer.maker.MinnerRPC(producer.self)
+		if err != nil {
+			t.Errorf("MinnerRPC failed: %v", err)
+		}
+		done <- height
+	}()
+	deadline := time.After(10 * time.Second)
+	for height := uint64(0); height == 0; {
+		network.Flush()
+		select {
+		case height = <-done:
+			if height != 1 {
+				t.Fatalf("producer head at %d, want 1", height)
+			}
+		case <-deadline:
+			t.Fatal("block was not committed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	network.Flush()
+
+	// 每个验证者都通过 OnCommit 导入了同一个区块，交易在各自的状态上执行
+	committed := producer.maker.Chain().GetCurrentHeader()
+	for _, node := range nodes {
+		head := node.maker.Chain().GetCurrentHeader()
+		if head.Height != 1 || head.Hash() != committed.Hash() {
+			t.Fatalf("validator %v head %d diverged", node.self, head.Height)
+		}
+		latest, err := node.maker.StateAt(maker.LatestBlock)
+		if err != nil {
+			t.Fatalf("StateAt failed: %v", err)
+		}
+		if account, _ := latest.GetAccount(common.Address{9}); account.Balance != 10 {
+			t.Errorf("validator %v receiver balance %d", node.self, account.Balance)
+		}
+	}
+	if height, round, _ := nodes[2].engine.Core().State(); height != 2 || round != 0 {
+		t.Errorf("consensus at height %d round %d, want 2/0", height, round)
+	}
+}
@@ -0,0 +1,240 @@
+package testconsensus
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus/bft"
+	"sync"
+	"testing"
+	"time"
+)
+
+type bftNode struct {
+	self    common.Address
+	engine  *bft.BFT
+	chain   *block.Blockchain
+	commits []*block.Header
+}
+
+// newBFTNetwork 4个验证者共用一个模拟网络和一个模拟时钟，整个过程在测试协程里确定性地推进
+func newBFTNetwork(t *testing.T) ([]*bftNode, *bft.Network, *bft.MockClock, *bft.Config) {
+	var validators []common.Address
+	for _, key := range signerKeys {
+		signer, _ := newSigner(t, key)
+		validators = append(validators, signer)
+	}
+	config := &bft.Config{
+		Validators:       validators,
+		TimeoutPropose:   3 * time.Second,
+		TimeoutPrevote:   time.Second,
+		TimeoutPrecommit: time.Second,
+		TimeoutDelta:     500 * time.Millisecond,
+	}
+	network := bft.NewNetwork()
+	clock := bft.NewMockClock(time.Unix(0, 0))
+	genesis := &block.Header{Height: 0}
+
+	nodes := make([]*bftNode, len(signerKeys))
+	for i, key := range signerKeys {
+		signer, signFn := newSigner(t, key)
+		node := &bftNode{self: signer, chain: &block.Blockchain{}}
+		node.chain.AddBlock(genesis, block.NewBlock(), nil, nil)
+		node.engine = bft.New(config, signer, signFn, clock, network.Join(signer))
+		node.engine.OnCommit(func(header *block.Header, body *block.Body) {
+			node.commits = append(node.commits, header)
+			node.chain.AddBlock(header, body, nil, nil)
+			if header.Height < 3 {
+				node.propose(header.Height + 1)
+			}
+		})
+		nodes[i] = node
+	}
+	return nodes, network, clock, config
+}
+
+// propose 每个节点都准备好自己在下一高度的候选区块，轮到谁提议就用谁的
+func (n *bftNode) propose(height uint64) {
+	parent := n.chain.GetCurrentHeader()
+	header := block.NewHeader(parent)
+	header.Timestamp = parent.Timestamp + 1
+	n.engine.Prepare(n.chain, header)
+	n.engine.Propose(header, block.NewBlock())
+}
+
+func TestBFT_FourValidatorsCommit(t *testing.T) {
+	nodes, network, _, config := newBFTNetwork(t)
+	for _, node := range nodes {
+		node.propose(1)
+		node.engine.Start(1)
+	}
+	network.Flush()
+
+	vs := bft.NewValidatorSet(config.Validators)
+	// 网络一直通畅时，每个高度都在第0轮完成；各节点确认的区块完全一致
+	for _, node := range nodes {
+		if len(node.commits) != 3 {
+			t.Fatalf("validator %v committed %d blocks, want 3", node.self, len(node.commits))
+		}
+		for i, header := range node.commits {
+			if header.Hash() != nodes[0].commits[i].Hash() {
+				t.Errorf("validator %v diverged at height %d", node.self, header.Height)
+			}
+			if header.Coinbase != vs.Proposer(header.Height, 0) {
+				t.Errorf("height %d proposed by %v, want %v", header.Height, header.Coinbase, vs.Proposer(header.Height, 0))
+			}
+		}
+	}
+	// 证书可以被任何持有验证者集合的节点独立校验
+	verifier := nodes[0].engine
+	chain := &block.Blockchain{}
+	chain.AddBlock(&block.Header{Height: 0}, block.NewBlock(), nil, nil)
+	for _, header := range nodes[1].commits {
+		if err := verifier.VerifyHeader(chain, header); err != nil {
+			t.Fatalf("VerifyHeader failed at height %d: %v", header.Height, err)
+		}
+		cert, _ := bft.DecodeCertificate(header)
+		if len(cert.Signatures) < vs.Quorum() {
+			t.Errorf("certificate at height %d has %d signatures", header.Height, len(cert.Signatures))
+		}
+		chain.AddBlock(header, block.NewBlock(), nil, nil)
+	}
+
+	// 篡改区块头后证书失效
+	forged := *nodes[0].commits[0]
+	forged.Timestamp++
+	if err := verifier.VerifyHeader(chain, &forged); err == nil {
+		t.Error("expected forged header to be rejected")
+	}
+	for _, node := range nodes {
+		node.engine.Stop()
+	}
+}
+
+func TestBFT_ProposerOfflineRoundChange(t *testing.T) {
+	nodes, network, clock, config := newBFTNetwork(t)
+	vs := bft.NewValidatorSet(config.Validators)
+	offline := vs.Proposer(1, 0)
+	network.SetOffline(offline, true)
+
+	var online []*bftNode
+	for _, node := range nodes {
+		node.propose(1)
+		node.engine.Start(1)
+		if node.self != offline {
+			online = append(online, node)
+		}
+	}
+	// 只在第1个高度上验证换轮，后续高度的提议者同样会卡住
+	for _, node := range nodes {
+		node.engine.OnCommit(func(header *block.Header, body *block.Body) {
+			node.commits = append(node.commits, header)
+		})
+	}
+
+	network.Flush()
+	for _, node := range online {
+		if h, r, step := node.engine.Core().State(); h != 1 || r != 0 || step != "propose" {
+			t.Fatalf("unexpected state before timeout: height=%d round=%d step=%s", h, r, step)
+		}
+	}
+
+	// 提议超时 -> 投nil -> 2/3 nil预投票后预提交nil -> 预提交超时进入第1轮
+	clock.Advance(config.TimeoutPropose)
+	network.Flush()
+	clock.Advance(config.TimeoutPrecommit)
+	network.Flush()
+
+	for _, node := range online {
+		if len(node.commits) != 1 {
+			t.Fatalf("validator %v committed %d blocks, want 1", node.self, len(node.commits))
+		}
+		cert, err := bft.DecodeCertificate(node.commits[0])
+		if err != nil {
+			t.Fatalf("DecodeCertificate failed: %v", err)
+		}
+		if cert.Round != 1 {
+			t.Errorf("committed in round %d, want 1", cert.Round)
+		}
+		if node.commits[0].Coinbase != vs.Proposer(1, 1) {
+			t.Errorf("block proposed by %v, want %v", node.commits[0].Coinbase, vs.Proposer(1, 1))
+		}
+	}
+	for _, node := range nodes {
+		node.engine.Stop()
+	}
+}
+
+// 本节点持有链的锁封装区块时，别人的提议正好被确认：交付回调要拿链的锁，Seal 要进共识状态机，两边都不能卡住
+func TestBFT_RemoteCommitDuringSeal(t *testing.T) {
+	nodes, network, _, config := newBFTNetwork(t)
+	vs := bft.NewValidatorSet(config.Validators)
+	var local *bftNode
+	for _, node := range nodes {
+		if local == nil && node.self != vs.Proposer(1, 0) {
+			local = node
+			continue
+		}
+		node.propose(1)
+		node.engine.Start(1)
+	}
+
+	var chainMu sync.Mutex
+	var once sync.Once
+	entered := make(chan struct{})
+	local.engine.OnCommit(func(header *block.Header, body *block.Body) {
+		once.Do(func() { close(entered) })
+		chainMu.Lock()
+		defer chainMu.Unlock()
+		local.commits = append(local.commits, header)
+	})
+	local.engine.Start(1)
+
+	holding, release := make(chan struct{}), make(chan struct{})
+	sealed := make(chan error, 1)
+	go func() {
+		chainMu.Lock()
+		defer chainMu.Unlock()
+		close(holding)
+		<-release
+		parent := local.chain.GetCurrentHeader()
+		header := block.NewHeader(parent)
+		header.Timestamp = parent.Timestamp + 1
+		local.engine.Prepare(local.chain, header)
+		_, err := local.engine.Seal(local.chain, header, block.NewBlock(), make(chan struct{}))
+		sealed <- err
+	}()
+	<-holding
+	flushed := make(chan struct{})
+	go func() {
+		network.Flush()
+		close(flushed)
+	}()
+
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote proposal was not committed")
+	}
+	close(release)
+	select {
+	case err := <-sealed:
+		if err == nil {
+			t.Error("Seal succeeded although another block was committed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Seal deadlocked with the commit hook")
+	}
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("commit hook never got the chain lock")
+	}
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	if len(local.commits) == 0 || local.commits[0].Coinbase != vs.Proposer(1, 0) {
+		t.Errorf("local node did not receive the remote block")
+	}
+	for _, node := range nodes {
+		node.engine.Stop()
+	}
+}
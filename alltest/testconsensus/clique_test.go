@@ -0,0 +1,195 @@
+package testconsensus
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/consensus/clique"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var signerKeys = []string{
+	"1111111111111111111111111111111111111111111111111111111111111111",
+	"2222222222222222222222222222222222222222222222222222222222222222",
+	"3333333333333333333333333333333333333333333333333333333333333333",
+	"4444444444444444444444444444444444444444444444444444444444444444",
+}
+
+type cliqueNode struct {
+	signer common.Address
+	engine *clique.Clique
+	maker  *maker.BlockMaker
+	db     *mpt.DB
+}
+
+func newSigner(t *testing.T, hexKey string) (common.Address, consensus.SignerFn) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		t.Fatalf("Failed to decode key: %v", err)
+	}
+	signer, signFn, err := consensus.NewKeySigner(key)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer, signFn
+}
+
+// newCliqueNetwork 在同一个进程里起多个签名节点，每个节点有自己的数据库
+func newCliqueNetwork(t *testing.T, dbDir string, config *clique.Config, keys []string) []*cliqueNode {
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+
+	nodes := make([]*cliqueNode, len(keys))
+	for i, key := range keys {
+		db, err := mpt.NewDB(filepath.Join(dbDir, fmt.Sprintf("node%d", i)))
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		signer, signFn := newSigner(t, key)
+		engine := clique.New(config, db)
+		engine.Authorize(signer, signFn)
+		state := mpt.NewMPT(db)
+		nodes[i] = &cliqueNode{
+			signer: signer,
+			engine: engine,
+			maker:  maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, engine),
+			db:     db,
+		}
+	}
+	return nodes
+}
+
+// mine 让某个节点出块并把区块广播给其余节点导入
+func mine(t *testing.T, nodes []*cliqueNode, producer *cliqueNode) *block.Header {
+	before := producer.maker.Chain().GetCurrentHeader()
+	producer.maker.MinnerRPC(producer.signer)
+	header := producer.maker.Chain().GetCurrentHeader()
+	if header == nil || header == before {
+		t.Fatalf("signer %v failed to seal a block", producer.signer)
+	}
+	body := producer.maker.Chain().GetBody(header.Hash())
+	for _, node := range nodes {
+		if node == producer {
+			continue
+		}
+		if err := node.maker.ImportBlock(header, body); err != nil {
+			t.Fatalf("node %v failed to import block %d: %v", node.signer, header.Height, err)
+		}
+	}
+	return header
+}
+
+func inturnNode(t *testing.T, nodes []*cliqueNode, height uint64) *cliqueNode {
+	head := nodes[0].maker.Chain().GetCurrentHeader()
+	snap, err := nodes[0].engine.GetSnapshot(nodes[0].maker.Chain(), head.Height, head.Hash())
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	signers := snap.SignerList()
+	expected := signers[height%uint64(len(signers))]
+	for _, node := range nodes {
+		if node.signer == expected {
+			return node
+		}
+	}
+	t.Fatalf("no node for signer %v", expected)
+	return nil
+}
+
+// availableNode 优先选轮值签名者，它刚出过块时换一个没出过块的
+func availableNode(t *testing.T, nodes []*cliqueNode, height uint64) *cliqueNode {
+	producer := inturnNode(t, nodes, height)
+	last, _ := nodes[0].engine.Author(nodes[0].maker.Chain().GetCurrentHeader())
+	if producer.signer != last {
+		return producer
+	}
+	for _, node := range nodes {
+		if node.signer != last {
+			return node
+		}
+	}
+	return producer
+}
+
+func TestClique_SealImportAndVote(t *testing.T) {
+	var signers []common.Address
+	for _, key := range signerKeys[:3] {
+		signer, _ := newSigner(t, key)
+		signers = append(signers, signer)
+	}
+	config := &clique.Config{Period: 0, Epoch: 4, Signers: signers}
+	nodes := newCliqueNetwork(t, "test_db_clique", config, signerKeys[:3])
+
+	// 创世区块由任一节点生成，其余节点导入
+	mine(t, nodes, nodes[0])
+
+	// 轮值签名者出块，难度为2
+	for height := uint64(1); height <= 3; height++ {
+		producer := inturnNode(t, nodes, height)
+		header := mine(t, nodes, producer)
+		if header.Difficulty != 2 {
+			t.Errorf("block %d difficulty: got %d, want 2", height, header.Difficulty)
+		}
+		if author, err := producer.engine.Author(header); err != nil || author != producer.signer {
+			t.Errorf("block %d author: got %v (%v), want %v", height, author, err, producer.signer)
+		}
+	}
+
+	// 刚出过块的签名者不能连续出块
+	last, _ := nodes[0].engine.Author(nodes[0].maker.Chain().GetCurrentHeader())
+	for _, node := range nodes {
+		if node.signer == last {
+			if height, err := node.maker.MinnerRPC(node.signer); height != 3 || err == nil {
+				t.Errorf("recently signed node sealed block %d", height)
+			}
+		}
+	}
+
+	// 非轮值但不在最近窗口里的签名者可以抢着出块，难度为1
+	inturn := inturnNode(t, nodes, 4)
+	for _, node := range nodes {
+		if node.signer != last && node != inturn {
+			header := mine(t, nodes, node)
+			if header.Difficulty != 1 {
+				t.Errorf("out-of-turn difficulty: got %d, want 1", header.Difficulty)
+			}
+			break
+		}
+	}
+
+	// 所有签名者投票加入第四个账户，过半后生效
+	newcomer, _ := newSigner(t, signerKeys[3])
+	for _, node := range nodes {
+		node.engine.Propose(newcomer, true)
+	}
+	for height := uint64(5); height <= 6; height++ {
+		mine(t, nodes, availableNode(t, nodes, height))
+	}
+	head := nodes[1].maker.Chain().GetCurrentHeader()
+	snap, err := nodes[1].engine.GetSnapshot(nodes[1].maker.Chain(), head.Height, head.Hash())
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	if _, ok := snap.Signers[newcomer]; !ok {
+		t.Errorf("newcomer not authorized after majority vote, signers=%v", snap.SignerList())
+	}
+
+	// 检查点快照已持久化，新的引擎实例不依赖链上区块头也能读出来
+	checkpoint := nodes[2].maker.Chain().GetHeaderByHeight(4)
+	reloaded := clique.New(config, nodes[2].db)
+	cp, err := reloaded.GetSnapshot(&block.Blockchain{}, checkpoint.Height, checkpoint.Hash())
+	if err != nil {
+		t.Fatalf("checkpoint snapshot not persisted: %v", err)
+	}
+	if len(cp.Signers) != 3 {
+		t.Errorf("checkpoint signers: got %d, want 3", len(cp.Signers))
+	}
+}
@@ -0,0 +1,62 @@
+package testconsensus
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"os"
+	"testing"
+)
+
+func newMaker(t *testing.T, dbDir string, engine *pow.PoW) *maker.BlockMaker {
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	return maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, engine)
+}
+
+func TestPoW_SealAndVerify(t *testing.T) {
+	engine := pow.New(4)
+	blockMaker := newMaker(t, "test_db_pow", engine)
+	minner := common.Address{1}
+
+	for i := 0; i < 3; i++ {
+		height, err := blockMaker.MinnerRPC(minner)
+		if err != nil {
+			t.Fatalf("MinnerRPC failed: %v", err)
+		}
+		if height != uint64(i) {
+			t.Fatalf("height mismatch: got %d, want %d", height, i)
+		}
+		header := blockMaker.Chain().GetCurrentHeader()
+		if hash := header.Hash(); hash[0]>>4 != 0 {
+			t.Errorf("block %d hash %x does not meet difficulty", i, hash)
+		}
+		if err := engine.VerifyHeader(blockMaker.Chain(), header); err != nil {
+			t.Errorf("VerifyHeader failed for block %d: %v", i, err)
+		}
+		if header.Root != blockMaker.State.RootHash() {
+			t.Errorf("block %d state root mismatch", i)
+		}
+	}
+
+	// 换一个不满足难度的nonce，校验应失败
+	header := *blockMaker.Chain().GetCurrentHeader()
+	for header.Nonce++; header.Hash()[0]>>4 == 0; header.Nonce++ {
+	}
+	if err := engine.VerifyHeader(blockMaker.Chain(), &header); err == nil {
+		t.Error("expected VerifyHeader to reject invalid nonce")
+	}
+
+	author, _ := engine.Author(&header)
+	if author != minner {
+		t.Errorf("author mismatch: got %v, want %v", author, minner)
+	}
+}
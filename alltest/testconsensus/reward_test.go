@@ -0,0 +1,77 @@
+package testconsensus
+
+import (
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/consensus/pow"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestRewardSchedule(t *testing.T) {
+	fixed := consensus.FixedReward(50)
+	if fixed.Subsidy(0) != 50 || fixed.Subsidy(1<<40) != 50 {
+		t.Errorf("fixed reward changed with height")
+	}
+	halving := consensus.HalvingReward{Initial: 1000, Interval: 10}
+	for _, c := range []struct{ height, want uint64 }{{0, 1000}, {9, 1000}, {10, 500}, {25, 250}, {10 * 64, 0}} {
+		if got := halving.Subsidy(c.height); got != c.want {
+			t.Errorf("halving subsidy at %d: got %d, want %d", c.height, got, c.want)
+		}
+	}
+}
+
+func TestPoW_FeesRefundsAndSupply(t *testing.T) {
+	schedule := consensus.HalvingReward{Initial: 1000000, Interval: 2}
+	blockMaker := newMaker(t, "test_db_reward", pow.NewWithReward(0, schedule))
+	sender, _ := newSigner(t, signerKeys[0])
+	coinbase := common.Address{2}
+	receiver := common.Address{3}
+	balance := func(addr common.Address) uint64 {
+		account, err := vm.NewVM(blockMaker.State).GetAccount(addr)
+		if err != nil {
+			t.Fatalf("GetAccount failed: %v", err)
+		}
+		return account.Balance
+	}
+
+	// 创世区块的补贴给发送者作为初始余额
+	blockMaker.MinnerRPC(sender)
+
+	transfer := tx.NewTransaction(1, receiver, big.NewInt(100), 50000, big.NewInt(2), nil, big.NewInt(1))
+	key, _ := hex.DecodeString(signerKeys[0])
+	if err := transfer.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := blockMaker.Txpool.NewTX(transfer); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	blockMaker.MinnerRPC(coinbase)
+	blockMaker.MinnerRPC(coinbase)
+
+	// 发送者只付实际消耗的gas，未用完的部分退还；手续费归 coinbase
+	fee := tx.TxGas * 2
+	if got, want := balance(sender), 1000000-100-fee; got != want {
+		t.Errorf("sender balance: got %d, want %d", got, want)
+	}
+	if got := balance(receiver); got != 100 {
+		t.Errorf("receiver balance: got %d, want 100", got)
+	}
+	if got, want := balance(coinbase), 1000000+500000+fee; got != want {
+		t.Errorf("coinbase balance: got %d, want %d", got, want)
+	}
+
+	// 总发行量只随补贴增长，手续费不改变总量
+	for height, want := range []uint64{1000000, 2000000, 2500000} {
+		supply, ok := blockMaker.Chain().GetTotalSupply(uint64(height))
+		if !ok || supply != want {
+			t.Errorf("total supply at %d: got %d (%v), want %d", height, supply, ok, want)
+		}
+	}
+	if total := balance(sender) + balance(receiver) + balance(coinbase); total != 2500000 {
+		t.Errorf("balances sum to %d, want the total supply 2500000", total)
+	}
+}
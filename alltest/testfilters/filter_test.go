@@ -0,0 +1,159 @@
+package testfilters
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/filters"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+)
+
+const senderKey = "1111111111111111111111111111111111111111111111111111111111111111"
+
+type chain struct {
+	t     *testing.T
+	maker *maker.BlockMaker
+	db    *mpt.DB
+	nonce uint64
+}
+
+func newChain(t *testing.T, dbDir string) *chain {
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	publicKey, _ := common.PrivateKeyToPublicKey(senderKey)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	blockMaker.MinnerRPC(common.Address{}.PublicKeyToAddress(publicKey))
+	return &chain{t: t, maker: blockMaker, db: db}
+}
+
+// mine 把交易打包进下一个区块
+func (c *chain) mine(to common.Address, data []byte) *tx.Receipt {
+	c.nonce++
+	transaction := tx.NewTransaction(c.nonce, to, big.NewInt(0), 0, big.NewInt(1), data, big.NewInt(1))
+	transaction.GasLimit = transaction.IntrinsicGas()
+	key, _ := hex.DecodeString(senderKey)
+	if err := transaction.Sign(key); err != nil {
+		c.t.Fatalf("Sign failed: %v", err)
+	}
+	if err := c.maker.Txpool.NewTX(transaction); err != nil {
+		c.t.Fatalf("NewTX failed: %v", err)
+	}
+	c.maker.MinnerRPC(common.Address{1})
+	receipt, err := c.maker.GetTransactionReceipt(*transaction.Hash())
+	if err != nil {
+		c.t.Fatalf("transaction not mined: %v", err)
+	}
+	return receipt
+}
+
+func (c *chain) mineEmpty(height uint64) {
+	for c.maker.GetCurrentHeader().Height < height {
+		c.maker.MinnerRPC(common.Address{1})
+	}
+}
+
+func heights(logs []*tx.Log) []uint64 {
+	result := make([]uint64, len(logs))
+	for i, log := range logs {
+		result[i] = log.BlockNumber
+	}
+	return result
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFilter_AddressTopicsAndBloomIndex(t *testing.T) {
+	c := newChain(t, "test_db_filters")
+	contractA := c.mine(common.Address{}, []byte{0x60, 0x01}).ContractAddress
+	contractB := c.mine(common.Address{}, []byte{0x60, 0x02}).ContractAddress
+	topicX := common.Hash{}.NewHash([]byte{0xaa, 0, 0, 1})
+	topicY := common.Hash{}.NewHash([]byte{0xbb, 0, 0, 2})
+
+	// 日志分布在不同区块，中间夹着空块
+	c.mineEmpty(4)
+	c.mine(contractA, []byte{0xaa, 0, 0, 1, 7}) // 5: A X
+	c.mineEmpty(10)
+	c.mine(contractB, []byte{0xaa, 0, 0, 1}) // 11: B X
+	c.mine(contractA, []byte{0xbb, 0, 0, 2}) // 12: A Y
+	c.mineEmpty(20)
+	c.mine(contractB, []byte{0xbb, 0, 0, 2}) // 21: B Y
+	c.mineEmpty(26)
+
+	header := c.maker.GetHeaderByHeight(5)
+	if !header.Bloom.Test(contractA.Bytes()) || !header.Bloom.Test(topicX.Bytes()) || header.Bloom.Test(contractB.Bytes()) {
+		t.Error("header bloom does not reflect the block's logs")
+	}
+
+	indexer, err := filters.NewIndexer(c.db, 8)
+	if err != nil {
+		t.Fatalf("NewIndexer failed: %v", err)
+	}
+	from, to := uint64(0), uint64(20)
+	cases := []struct {
+		name     string
+		criteria filters.FilterCriteria
+		want     []uint64
+	}{
+		{"all", filters.FilterCriteria{FromBlock: &from}, []uint64{5, 11, 12, 21}},
+		{"address", filters.FilterCriteria{FromBlock: &from, Addresses: []common.Address{contractA}}, []uint64{5, 12}},
+		{"topic", filters.FilterCriteria{FromBlock: &from, Topics: [][]common.Hash{{topicY}}}, []uint64{12, 21}},
+		{"address and topic", filters.FilterCriteria{FromBlock: &from, Addresses: []common.Address{contractB}, Topics: [][]common.Hash{{topicX}}}, []uint64{11}},
+		{"topic alternatives in range", filters.FilterCriteria{FromBlock: &from, ToBlock: &to, Topics: [][]common.Hash{{topicX, topicY}}}, []uint64{5, 11, 12}},
+		{"too many topics", filters.FilterCriteria{FromBlock: &from, Topics: [][]common.Hash{{}, {topicX}}}, []uint64{}},
+		{"latest only", filters.FilterCriteria{}, []uint64{}},
+	}
+	for _, tc := range cases {
+		scanned, err := filters.NewFilter(c.maker, nil, tc.criteria).Logs()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		indexed, err := filters.NewFilter(c.maker, indexer, tc.criteria).Logs()
+		if err != nil {
+			t.Fatalf("%s with index: %v", tc.name, err)
+		}
+		if !equal(heights(scanned), tc.want) || !equal(heights(indexed), tc.want) {
+			t.Errorf("%s: scan %v, index %v, want %v", tc.name, heights(scanned), heights(indexed), tc.want)
+		}
+	}
+
+	// 27个区块构成3个完整的段，索引挑出的候选区块就是日志所在的区块
+	if sections := indexer.Sections(); sections != 3 {
+		t.Fatalf("indexed %d sections, want 3", sections)
+	}
+	candidates, err := indexer.Candidates(1, filters.FilterCriteria{Addresses: []common.Address{contractA}})
+	if err != nil {
+		t.Fatalf("Candidates failed: %v", err)
+	}
+	for i, candidate := range candidates {
+		if candidate != (i == 4) {
+			t.Errorf("block %d candidate %v", 8+i, candidate)
+		}
+	}
+	if _, err := indexer.Candidates(3, filters.FilterCriteria{}); err == nil {
+		t.Error("incomplete section should not be indexed")
+	}
+	if _, err := filters.NewIndexer(c.db, 12); err == nil {
+		t.Error("section size must be a multiple of 8")
+	}
+}
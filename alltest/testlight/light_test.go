@@ -0,0 +1,203 @@
+package testlight
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/light"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const senderKey = "1111111111111111111111111111111111111111111111111111111111111111"
+
+func newFullNode(t *testing.T, dbDir string) *maker.BlockMaker {
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	return maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+}
+
+func sender(t *testing.T) common.Address {
+	publicKey, err := common.PrivateKeyToPublicKey(senderKey)
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+	return common.Address{}.PublicKeyToAddress(publicKey)
+}
+
+func transfer(t *testing.T, node *maker.BlockMaker, nonce uint64, to common.Address, value int64) {
+	transaction := tx.NewTransaction(nonce, to, big.NewInt(value), tx.TxGas, big.NewInt(1), nil, big.NewInt(1))
+	key, _ := hex.DecodeString(senderKey)
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := node.Txpool.NewTX(transaction); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+}
+
+// switchable 测试里切换轻节点连接的全节点
+type switchable struct {
+	light.Backend
+}
+
+// tampered 返回另一个状态根下的证明
+type tampered struct {
+	*maker.BlockMaker
+	root common.Hash
+}
+
+func (b tampered) GetAccountProof(_ common.Hash, addr common.Address) ([][]byte, error) {
+	return b.BlockMaker.GetAccountProof(b.root, addr)
+}
+
+func TestLightClient_SyncAndVerifiedState(t *testing.T) {
+	dir := "test_db_light"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+	full := newFullNode(t, filepath.Join(dir, "a"))
+	alice, bob := sender(t), common.Address{7}
+
+	full.MinnerRPC(alice)
+	transfer(t, full, 1, bob, 300)
+	full.MinnerRPC(common.Address{1})
+	transfer(t, full, 2, bob, 200)
+	full.MinnerRPC(common.Address{1})
+
+	client := light.NewLightClient(full, pow.New(0))
+	if _, err := client.GetBalance(alice); err == nil {
+		t.Error("query before sync should fail")
+	}
+	if err := client.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if client.CurrentHeader().Hash() != full.GetCurrentHeader().Hash() {
+		t.Fatal("light client head differs from the full node")
+	}
+
+	// 轻节点验证后的结果和全节点本地读到的一致
+	state := vm.NewVM(full.State)
+	for _, addr := range []common.Address{alice, bob, {1}, {9}} {
+		want, _ := state.GetAccount(addr)
+		account, err := client.GetAccount(addr)
+		if err != nil {
+			t.Fatalf("GetAccount(%v) failed: %v", addr, err)
+		}
+		if account.Balance != want.Balance || account.Nonce != want.Nonce {
+			t.Errorf("%v: light %d/%d, full %d/%d", addr, account.Balance, account.Nonce, want.Balance, want.Nonce)
+		}
+	}
+	if nonce, _ := client.GetNonce(alice); nonce != 2 {
+		t.Errorf("alice nonce %d, want 2", nonce)
+	}
+	if balance, _ := client.GetBalance(bob); balance != 500 {
+		t.Errorf("bob balance %d, want 500", balance)
+	}
+
+	// 全节点给出别的状态根下的证明时拒绝
+	old := full.GetHeaderByHeight(1)
+	forged := light.NewLightClient(tampered{full, old.Root}, pow.New(0))
+	if err := forged.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, err := forged.GetBalance(bob); err == nil {
+		t.Error("proof under another state root accepted")
+	}
+
+	// 封装不符合本地共识规则的区块头被拒绝
+	strict := light.NewLightClient(full, pow.New(8))
+	if err := strict.Sync(); err == nil || strict.CurrentHeader() != nil {
+		t.Error("headers with an invalid seal accepted")
+	}
+}
+
+func TestLightClient_FollowsReorg(t *testing.T) {
+	dir := "test_db_light_reorg"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+	a := newFullNode(t, filepath.Join(dir, "a"))
+	b := newFullNode(t, filepath.Join(dir, "b"))
+
+	// 两个全节点共享前两个区块，之后各自出块，b 的分支更长
+	a.MinnerRPC(common.Address{1})
+	a.MinnerRPC(common.Address{1})
+	for height := uint64(0); height < 2; height++ {
+		header := a.GetHeaderByHeight(height)
+		if err := b.ImportBlock(header, a.Chain().GetBody(header.Hash())); err != nil {
+			t.Fatalf("ImportBlock failed: %v", err)
+		}
+	}
+	a.MinnerRPC(common.Address{2})
+	a.MinnerRPC(common.Address{2})
+	for i := 0; i < 3; i++ {
+		b.MinnerRPC(common.Address{3})
+	}
+
+	backend := &switchable{a}
+	client := light.NewLightClient(backend, pow.New(0))
+	if err := client.Sync(); err != nil || client.CurrentHeader().Hash() != a.GetCurrentHeader().Hash() {
+		t.Fatalf("sync from a: %v", err)
+	}
+	backend.Backend = b
+	if err := client.Sync(); err != nil {
+		t.Fatalf("sync from b: %v", err)
+	}
+	if head := client.CurrentHeader(); head.Hash() != b.GetCurrentHeader().Hash() || head.Height != 4 {
+		t.Fatalf("light client did not switch to the longer branch")
+	}
+	for height := uint64(0); height <= 4; height++ {
+		if client.GetHeaderByHeight(height).Hash() != b.GetHeaderByHeight(height).Hash() {
+			t.Errorf("header %d not from the new branch", height)
+		}
+	}
+	if balance, err := client.GetBalance(common.Address{3}); err != nil || balance == 0 {
+		t.Errorf("coinbase of the new branch: balance %d, err %v", balance, err)
+	}
+
+	// 创世区块不同的全节点
+	other := newFullNode(t, filepath.Join(dir, "c"))
+	other.MinnerRPC(common.Address{4})
+	backend.Backend = other
+	if err := client.Sync(); err == nil {
+		t.Error("sync from a chain with another genesis should fail")
+	}
+	if client.CurrentHeader().Hash() != b.GetCurrentHeader().Hash() {
+		t.Error("failed sync changed the light client head")
+	}
+
+	// 全节点 d 只有 b 的前三个区块：没有新区块头可下载，也要退回到 d 的链头
+	d := newFullNode(t, filepath.Join(dir, "d"))
+	for height := uint64(0); height <= 2; height++ {
+		header := b.GetHeaderByHeight(height)
+		if err := d.ImportBlock(header, b.Chain().GetBody(header.Hash())); err != nil {
+			t.Fatalf("ImportBlock failed: %v", err)
+		}
+	}
+	backend.Backend = d
+	if err := client.Sync(); err != nil {
+		t.Fatalf("sync from d: %v", err)
+	}
+	if head := client.CurrentHeader(); head.Hash() != d.GetCurrentHeader().Hash() || head.Height != 2 {
+		t.Fatalf("light client head %d did not roll back to the full node's head", head.Height)
+	}
+	if client.GetHeaderByHeight(3) != nil {
+		t.Error("header above the full node's head still canonical")
+	}
+	// 回滚后还能接着同步更长的链
+	backend.Backend = b
+	if err := client.Sync(); err != nil || client.CurrentHeader().Hash() != b.GetCurrentHeader().Hash() {
+		t.Fatalf("sync from b after the rollback: %v", err)
+	}
+}
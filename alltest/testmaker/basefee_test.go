@@ -0,0 +1,174 @@
+package testmaker
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/maker"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func signedDynamicTx(t *testing.T, hexKey string, nonce uint64, value, tipCap, feeCap int64) *tx.Transaction {
+	transaction := tx.NewDynamicFeeTransaction(nonce, common.Address{9}, big.NewInt(value), tx.TxGas, big.NewInt(tipCap), big.NewInt(feeCap), nil, big.NewInt(1))
+	key, _ := hex.DecodeString(hexKey)
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return transaction
+}
+
+func balanceAt(t *testing.T, state *vm.VM, addr common.Address) uint64 {
+	account, err := state.GetAccount(addr)
+	if err != nil {
+		t.Fatalf("GetAccount failed: %v", err)
+	}
+	return account.Balance
+}
+
+func TestBaseFee_BurnTipAndOrdering(t *testing.T) {
+	blockMaker, _ := newFundedMaker(t, "test_db_basefee")
+	// 先出两个块把 newFundedMaker 提交的交易打包完，池里只剩本测试的交易
+	blockMaker.MinnerRPC(common.Address{1})
+	blockMaker.MinnerRPC(common.Address{1})
+	start := blockMaker.GetCurrentHeader().Height
+	blockMaker.SetLondonBlock(start+1, big.NewInt(8))
+	blockMaker.SetGasLimit(4 * tx.TxGas)
+
+	senders := []common.Address{keyToAddress(t, senderKeys[0]), keyToAddress(t, senderKeys[1]), keyToAddress(t, senderKeys[2])}
+	before, _ := blockMaker.StateAt("latest")
+	balances := make([]uint64, len(senders))
+	for i, sender := range senders {
+		balances[i] = balanceAt(t, before, sender)
+	}
+	nonces := make([]uint64, len(senders))
+	for i, sender := range senders {
+		account, _ := before.GetAccount(sender)
+		nonces[i] = account.Nonce + 1
+	}
+	coinbase := common.Address{7}
+	coinbaseBefore := balanceAt(t, before, coinbase)
+	supplyBefore, _ := blockMaker.Chain().GetTotalSupply(start)
+
+	legacy := signedTx(t, senderKeys[0], nonces[0], 10, 10)               // 小费 10-8=2
+	dynamic := signedDynamicTx(t, senderKeys[1], nonces[1], 10, 5, 20)    // 小费 min(5, 20-8)=5
+	underpriced := signedDynamicTx(t, senderKeys[2], nonces[2], 10, 1, 7) // 付不起 baseFee
+	for _, transaction := range []*tx.Transaction{legacy, dynamic, underpriced} {
+		if err := blockMaker.Txpool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+	blockMaker.MinnerRPC(coinbase)
+
+	header := blockMaker.GetCurrentHeader()
+	if header.Height != start+1 || header.BaseFee == nil || header.BaseFee.Int64() != 8 {
+		t.Fatalf("block %d base fee %v", header.Height, header.BaseFee)
+	}
+	body := blockMaker.Chain().GetBody(header.Hash())
+	if len(body.Transactions) != 2 || *body.Transactions[0].Hash() != *dynamic.Hash() || *body.Transactions[1].Hash() != *legacy.Hash() {
+		t.Fatalf("block does not order by effective tip: %d transactions", len(body.Transactions))
+	}
+	if err := blockMaker.Txpool.GetRejected(*underpriced.Hash()); err != nil {
+		t.Errorf("underpriced transaction dropped instead of waiting: %v", err)
+	}
+
+	// 发送者按实际单价付费，baseFee 部分销毁，小费付给 coinbase
+	after, _ := blockMaker.StateAt("latest")
+	if got, want := balanceAt(t, after, senders[0]), balances[0]-10-tx.TxGas*10; got != want {
+		t.Errorf("legacy sender balance %d, want %d", got, want)
+	}
+	if got, want := balanceAt(t, after, senders[1]), balances[1]-10-tx.TxGas*13; got != want {
+		t.Errorf("dynamic fee sender balance %d, want %d", got, want)
+	}
+	reward := balanceAt(t, after, coinbase) - coinbaseBefore - tx.TxGas*(5+2)
+	supply, _ := blockMaker.Chain().GetTotalSupply(header.Height)
+	if burnt := tx.TxGas * 2 * 8; supply != supplyBefore+reward-burnt {
+		t.Errorf("total supply %d, want %d", supply, supplyBefore+reward-burnt)
+	}
+
+	// 用了一半gas，baseFee 不变；空块之后降 1/8，等着的交易就能打包了
+	blockMaker.MinnerRPC(coinbase)
+	if fee := blockMaker.GetCurrentHeader().BaseFee; fee.Int64() != 8 {
+		t.Errorf("base fee after a half full block %v", fee)
+	}
+	blockMaker.MinnerRPC(coinbase)
+	header = blockMaker.GetCurrentHeader()
+	if header.BaseFee.Int64() != 7 {
+		t.Fatalf("base fee after an empty block %v", header.BaseFee)
+	}
+	body = blockMaker.Chain().GetBody(header.Hash())
+	if len(body.Transactions) != 1 || *body.Transactions[0].Hash() != *underpriced.Hash() {
+		t.Errorf("waiting transaction not packed once the base fee dropped")
+	}
+}
+
+func TestBaseFee_ImportVerifiesHeader(t *testing.T) {
+	dir := "test_db_basefee_import"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+
+	source := newExportNode(t, filepath.Join(dir, "source"))
+	source.SetLondonBlock(1, big.NewInt(8))
+	source.MinnerRPC(keyToAddress(t, senderKeys[0]))
+	if err := source.Txpool.NewTX(signedDynamicTx(t, senderKeys[0], 1, 10, 2, 20)); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	source.MinnerRPC(common.Address{1})
+	genesis, block1 := source.GetHeaderByHeight(0), source.GetHeaderByHeight(1)
+	if genesis.BaseFee != nil || block1.BaseFee.Int64() != 8 {
+		t.Fatalf("base fees %v %v", genesis.BaseFee, block1.BaseFee)
+	}
+
+	target := newExportNode(t, filepath.Join(dir, "target"))
+	target.SetLondonBlock(1, big.NewInt(8))
+	if err := target.ImportBlock(genesis, source.Chain().GetBody(genesis.Hash())); err != nil {
+		t.Fatalf("import genesis: %v", err)
+	}
+	tampered := *block1
+	tampered.BaseFee = big.NewInt(9)
+	if err := target.ImportBlock(&tampered, source.Chain().GetBody(block1.Hash())); !errors.Is(err, block.ErrInvalidBaseFee) {
+		t.Errorf("imported a block with a wrong base fee: %v", err)
+	}
+	if err := target.ImportBlock(block1, source.Chain().GetBody(block1.Hash())); err != nil {
+		t.Errorf("import block 1: %v", err)
+	}
+	if target.State.RootHash() != block1.Root {
+		t.Error("imported state differs")
+	}
+}
+
+func TestBaseFee_DynamicFeeBeforeLondon(t *testing.T) {
+	blockMaker, _ := newFundedMaker(t, "test_db_basefee_before_london")
+	blockMaker.MinnerRPC(common.Address{1})
+	if err := blockMaker.SetLondonBlock(10, nil); err == nil {
+		t.Error("London enabled without an initial base fee")
+	}
+
+	// 还没有 baseFee 时交易池和vm都不接受动态手续费交易
+	latest, err := blockMaker.StateAt(maker.LatestBlock)
+	if err != nil {
+		t.Fatalf("StateAt failed: %v", err)
+	}
+	account, _ := latest.GetAccount(keyToAddress(t, senderKeys[0]))
+	dynamic := signedDynamicTx(t, senderKeys[0], account.Nonce+1, 10, 2, 20)
+	if err := blockMaker.Txpool.NewTX(dynamic); !errors.Is(err, tx.ErrNoBaseFee) {
+		t.Errorf("pool accepted a dynamic fee tx before London: %v", err)
+	}
+	if err := latest.ExecuteTransaction(dynamic); !errors.Is(err, tx.ErrNoBaseFee) {
+		t.Errorf("vm executed a dynamic fee tx without a base fee: %v", err)
+	}
+
+	// 下一个区块就启用时立即可以提交
+	if err := blockMaker.SetLondonBlock(blockMaker.GetCurrentHeader().Height+1, big.NewInt(8)); err != nil {
+		t.Fatalf("SetLondonBlock failed: %v", err)
+	}
+	if err := blockMaker.Txpool.NewTX(dynamic); err != nil {
+		t.Errorf("dynamic fee tx rejected after London: %v", err)
+	}
+}
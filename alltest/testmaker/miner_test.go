@@ -0,0 +1,165 @@
+package testmaker
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"os"
+	"testing"
+	"time"
+)
+
+func waitHead(t *testing.T, heads <-chan block.ChainHeadEvent, timeout time.Duration) *block.Header {
+	select {
+	case ev := <-heads:
+		return ev.Header
+	case <-time.After(timeout):
+		t.Fatalf("no block produced within %v", timeout)
+		return nil
+	}
+}
+
+func TestMiner_StartStopAndInterval(t *testing.T) {
+	dbDir := "test_db_miner"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+
+	heads := make(chan block.ChainHeadEvent, 16)
+	sub := blockMaker.Chain().SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	interval := time.Second
+	miner := maker.NewMiner(blockMaker, keyToAddress(t, senderKeys[0]), interval)
+	if err := miner.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer miner.Stop()
+	if err := miner.Start(); err == nil {
+		t.Error("second Start should fail while running")
+	}
+
+	genesis := waitHead(t, heads, time.Second)
+	start := time.Now()
+	if genesis.Height != 0 {
+		t.Fatalf("first block height %d, want 0", genesis.Height)
+	}
+
+	// 没有交易时不出空块
+	select {
+	case ev := <-heads:
+		t.Fatalf("empty block %d produced", ev.Header.Height)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// 新交易立即进入待出块区块，满最小间隔后才出块
+	transfer := signedTx(t, senderKeys[0], 1, 10, 1)
+	if err := blockMaker.Txpool.NewTX(transfer); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for {
+		if _, body := miner.Pending(); body != nil && len(body.Transactions) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pending block does not contain the new transaction")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	header := waitHead(t, heads, 2*interval)
+	if elapsed := time.Since(start); elapsed < interval-50*time.Millisecond {
+		t.Errorf("block produced after %v, minimum interval is %v", elapsed, interval)
+	}
+	body := blockMaker.Chain().GetBody(header.Hash())
+	if header.Height != 1 || len(body.Transactions) != 1 || *body.Transactions[0].Hash() != *transfer.Hash() {
+		t.Fatalf("unexpected block %d with %d transactions", header.Height, len(body.Transactions))
+	}
+
+	// 停止后不再出块，待出块区块作废，交易留在池中
+	miner.Stop()
+	if miner.Mining() {
+		t.Error("miner still running after Stop")
+	}
+	next := signedTx(t, senderKeys[0], 2, 10, 1)
+	if err := blockMaker.Txpool.NewTX(next); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	select {
+	case ev := <-heads:
+		t.Fatalf("block %d produced after Stop", ev.Header.Height)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if header, _ := miner.Pending(); header != nil {
+		t.Error("pending block kept after Stop")
+	}
+	if popped := blockMaker.Txpool.Pop(); popped == nil || *popped.Hash() != *next.Hash() {
+		t.Error("transaction submitted after Stop is not in the pool")
+	}
+}
+
+func TestHeadEvent_SubscriberCallsBack(t *testing.T) {
+	dbDir := "test_db_head_callback"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+
+	// 不带缓冲的订阅者收到链头后先回头查询 BlockMaker，再接收下一个事件
+	heads := make(chan block.ChainHeadEvent)
+	sub := blockMaker.Chain().SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+	proceed := make(chan struct{})
+	seen := make(chan uint64, 3)
+	go func() {
+		for ev := range heads {
+			<-proceed
+			if head := blockMaker.GetCurrentHeader(); head == nil || head.Height < ev.Header.Height {
+				t.Errorf("head behind the event at %d", ev.Header.Height)
+			}
+			seen <- ev.Header.Height
+		}
+	}()
+
+	produced := make(chan error, 1)
+	go func() {
+		for i := 0; i < 3; i++ {
+			if _, err := blockMaker.MinnerRPC(common.Address{1}); err != nil {
+				produced <- err
+				return
+			}
+		}
+		produced <- nil
+	}()
+	// 订阅者还在处理第一个事件时，后面的出块不能因为等它接收而一直占着 maker 的锁
+	time.Sleep(100 * time.Millisecond)
+	close(proceed)
+	select {
+	case err := <-produced:
+		if err != nil {
+			t.Fatalf("MinnerRPC failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("block production stalled behind a head subscriber")
+	}
+	for want := uint64(0); want < 3; want++ {
+		if height := <-seen; height != want {
+			t.Errorf("head event %d, want %d", height, want)
+		}
+	}
+}
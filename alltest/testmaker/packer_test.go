@@ -0,0 +1,131 @@
+package testmaker
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+)
+
+var senderKeys = []string{
+	"1111111111111111111111111111111111111111111111111111111111111111",
+	"2222222222222222222222222222222222222222222222222222222222222222",
+	"3333333333333333333333333333333333333333333333333333333333333333",
+}
+
+func keyToAddress(t *testing.T, hexKey string) common.Address {
+	publicKey, err := common.PrivateKeyToPublicKey(hexKey)
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+	return common.Address{}.PublicKeyToAddress(publicKey)
+}
+
+func signedTx(t *testing.T, hexKey string, nonce uint64, value int64, gasPrice int64) *tx.Transaction {
+	transaction := tx.NewTransaction(nonce, common.Address{9}, big.NewInt(value), tx.TxGas, big.NewInt(gasPrice), nil, big.NewInt(1))
+	key, _ := hex.DecodeString(hexKey)
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return transaction
+}
+
+// newFundedMaker 出完创世区块后给每个发送者mint一次，再按同样的顺序提交同一批交易
+func newFundedMaker(t *testing.T, dbDir string) (*maker.BlockMaker, []*tx.Transaction) {
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	blockMaker.MinnerRPC(common.Address{1})
+	for _, key := range senderKeys {
+		if err := vm.NewVM(state).Mint(keyToAddress(t, key)); err != nil {
+			t.Fatalf("Mint failed: %v", err)
+		}
+	}
+
+	txs := []*tx.Transaction{
+		signedTx(t, senderKeys[0], 1, 10, 3),
+		signedTx(t, senderKeys[0], 2, 10, 3),
+		signedTx(t, senderKeys[1], 1, 2000000, 2), // 余额不足，执行失败
+		signedTx(t, senderKeys[2], 1, 10, 1),
+		signedTx(t, senderKeys[2], 2, 10, 1), // 区块gas只够三笔转账
+	}
+	for _, transaction := range txs {
+		if err := blockMaker.Txpool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+	blockMaker.SetGasLimit(3 * tx.TxGas)
+	return blockMaker, txs
+}
+
+func TestPack_GasLimitAndSelection(t *testing.T) {
+	blockMaker, txs := newFundedMaker(t, "test_db_pack")
+	if height, err := blockMaker.MinnerRPC(common.Address{1}); height != 1 || err != nil {
+		t.Fatalf("block not produced, height %d: %v", height, err)
+	}
+
+	// 价格高的先打包，失败的交易不影响其它交易，放不下的留在池中
+	header := blockMaker.Chain().GetCurrentHeader()
+	body := blockMaker.Chain().GetBody(header.Hash())
+	want := []*tx.Transaction{txs[0], txs[1], txs[3]}
+	if len(body.Transactions) != len(want) {
+		t.Fatalf("block has %d transactions, want %d", len(body.Transactions), len(want))
+	}
+	for i := range want {
+		if *body.Transactions[i].Hash() != *want[i].Hash() {
+			t.Errorf("transaction %d not in expected order", i)
+		}
+	}
+	if header.GasLimit != 3*tx.TxGas || header.GasUsed != 3*tx.TxGas {
+		t.Errorf("gas limit/used: got %d/%d, want %d/%d", header.GasLimit, header.GasUsed, 3*tx.TxGas, 3*tx.TxGas)
+	}
+	if err := blockMaker.Txpool.GetRejected(*txs[2].Hash()); err == nil {
+		t.Error("failed transaction was not reported to the pool")
+	}
+
+	// 被跳过的交易在下一个区块里打包
+	blockMaker.MinnerRPC(common.Address{1})
+	header = blockMaker.Chain().GetCurrentHeader()
+	body = blockMaker.Chain().GetBody(header.Hash())
+	if len(body.Transactions) != 1 || *body.Transactions[0].Hash() != *txs[4].Hash() {
+		t.Errorf("deferred transaction not packed into the next block")
+	}
+	if header.GasUsed != tx.TxGas {
+		t.Errorf("gas used: got %d, want %d", header.GasUsed, tx.TxGas)
+	}
+}
+
+func TestPack_Deterministic(t *testing.T) {
+	first, _ := newFundedMaker(t, "test_db_pack_a")
+	second, _ := newFundedMaker(t, "test_db_pack_b")
+	first.MinnerRPC(common.Address{1})
+	second.MinnerRPC(common.Address{1})
+
+	a := first.Chain().GetCurrentHeader()
+	b := second.Chain().GetCurrentHeader()
+	if a.Root != b.Root || a.GasUsed != b.GasUsed {
+		t.Errorf("same pool snapshot produced different blocks: root %x/%x, gas %d/%d", a.Root, b.Root, a.GasUsed, b.GasUsed)
+	}
+	bodyA := first.Chain().GetBody(a.Hash())
+	bodyB := second.Chain().GetBody(b.Hash())
+	if len(bodyA.Transactions) != len(bodyB.Transactions) {
+		t.Fatalf("transaction count differs: %d vs %d", len(bodyA.Transactions), len(bodyB.Transactions))
+	}
+	for i := range bodyA.Transactions {
+		if *bodyA.Transactions[i].Hash() != *bodyB.Transactions[i].Hash() {
+			t.Errorf("transaction %d differs", i)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package testmaker
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func signedCall(t *testing.T, hexKey string, nonce uint64, to common.Address, data []byte) *tx.Transaction {
+	transaction := tx.NewTransaction(nonce, to, big.NewInt(0), 0, big.NewInt(1), data, big.NewInt(1))
+	transaction.GasLimit = transaction.IntrinsicGas() + 1000
+	key, _ := hex.DecodeString(hexKey)
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return transaction
+}
+
+func TestReceipts_ProducedRootedAndPersisted(t *testing.T) {
+	dbDir := "test_db_receipts"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	sender := keyToAddress(t, senderKeys[0])
+	blockMaker.MinnerRPC(sender)
+
+	// 先创建合约，下一个区块里调用合约并转账
+	create := signedCall(t, senderKeys[0], 1, common.Address{}, []byte{0x60, 0x00})
+	transfer := signedTx(t, senderKeys[0], 3, 10, 1)
+	if err := blockMaker.Txpool.NewTX(create); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	blockMaker.MinnerRPC(common.Address{1})
+	createReceipt, err := blockMaker.GetTransactionReceipt(*create.Hash())
+	if err != nil {
+		t.Fatalf("creation receipt: %v", err)
+	}
+	contract := createReceipt.ContractAddress
+	if contract.IsZero() {
+		t.Fatal("creation receipt has no contract address")
+	}
+	if account, _ := vm.NewVM(state).GetAccount(contract); len(account.Code) == 0 {
+		t.Fatal("contract address in the receipt holds no code")
+	}
+
+	call := signedCall(t, senderKeys[0], 2, contract, []byte{1, 2, 3, 4, 5, 6})
+	for _, transaction := range []*tx.Transaction{call, transfer} {
+		if err := blockMaker.Txpool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+	blockMaker.MinnerRPC(common.Address{1})
+	header := blockMaker.Chain().GetCurrentHeader()
+
+	callReceipt, err := blockMaker.GetTransactionReceipt(*call.Hash())
+	if err != nil {
+		t.Fatalf("call receipt: %v", err)
+	}
+	transferReceipt, err := blockMaker.GetTransactionReceipt(*transfer.Hash())
+	if err != nil {
+		t.Fatalf("transfer receipt: %v", err)
+	}
+	receipts := []*tx.Receipt{callReceipt, transferReceipt}
+	if tx.ReceiptsRoot(receipts) != header.ReceiptRoot || header.ReceiptRoot == (common.Hash{}) {
+		t.Error("header does not commit to the receipts")
+	}
+	for i, receipt := range receipts {
+		if receipt.Status != tx.ReceiptStatusSuccessful || receipt.TxIndex != uint(i) {
+			t.Errorf("receipt %d: status %d index %d", i, receipt.Status, receipt.TxIndex)
+		}
+		if receipt.BlockHash != header.Hash() || receipt.BlockNumber != header.Height {
+			t.Errorf("receipt %d not linked to block %d", i, header.Height)
+		}
+	}
+	if callReceipt.GasUsed != call.IntrinsicGas() || transferReceipt.CumulativeGasUsed != header.GasUsed ||
+		transferReceipt.CumulativeGasUsed != callReceipt.GasUsed+tx.TxGas {
+		t.Errorf("gas used: call %d cumulative %d, header %d", callReceipt.GasUsed, transferReceipt.CumulativeGasUsed, header.GasUsed)
+	}
+
+	// 合约调用产生日志，布隆过滤器包含合约地址和主题
+	if len(callReceipt.Logs) != 1 || len(transferReceipt.Logs) != 0 {
+		t.Fatalf("logs: call %d transfer %d", len(callReceipt.Logs), len(transferReceipt.Logs))
+	}
+	log := callReceipt.Logs[0]
+	topic := common.Hash{}.NewHash([]byte{1, 2, 3, 4})
+	if log.Address != contract || len(log.Topics) != 1 || log.Topics[0] != topic || hex.EncodeToString(log.Data) != "0506" {
+		t.Errorf("unexpected log %+v", log)
+	}
+	if log.TxHash != *call.Hash() || log.BlockHash != header.Hash() {
+		t.Error("log not linked to its transaction and block")
+	}
+	if !callReceipt.Bloom.Test(contract.Bytes()) || !callReceipt.Bloom.Test(topic.Bytes()) {
+		t.Error("bloom misses the log address or topic")
+	}
+	if transferReceipt.Bloom.Test(contract.Bytes()) {
+		t.Error("bloom of a receipt without logs matches")
+	}
+
+	// 重启后仍然可以查询
+	db.Close()
+	db, err = mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	restarted := maker.NewBlockMaker(tx.NewTxPool(mpt.NewMPT(db)), mpt.NewMPT(db))
+	receipt, err := restarted.GetTransactionReceipt(*call.Hash())
+	if err != nil {
+		t.Fatalf("receipt lost after restart: %v", err)
+	}
+	if receipt.BlockHash != header.Hash() || len(receipt.Logs) != 1 || receipt.Logs[0].Topics[0] != topic {
+		t.Error("receipt changed after restart")
+	}
+	if _, err := restarted.GetTransactionReceipt(common.Hash{1}); err == nil {
+		t.Error("unknown transaction has a receipt")
+	}
+}
@@ -0,0 +1,139 @@
+package testmaker
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingEngine 在 fail 为true时封装失败，模拟没轮到本节点签名
+type failingEngine struct {
+	consensus.Engine
+	fail bool
+}
+
+func (e *failingEngine) Seal(chain consensus.ChainReader, header *block.Header, body *block.Body, stop <-chan struct{}) (*block.Header, error) {
+	if e.fail {
+		return nil, errors.New("not our turn")
+	}
+	return e.Engine.Seal(chain, header, body, stop)
+}
+
+func TestSealFailure_RevertsState(t *testing.T) {
+	dbDir := "test_db_seal_failure"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	engine := &failingEngine{Engine: pow.New(0)}
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, engine)
+	blockMaker.MinnerRPC(common.Address{1})
+	sender := keyToAddress(t, senderKeys[0])
+	if err := vm.NewVM(state).Mint(sender); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	transaction := signedTx(t, senderKeys[0], 1, 10, 1)
+	if err := blockMaker.Txpool.NewTX(transaction); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+
+	// 封装失败时状态树退回父区块的根，交易没有上链
+	engine.fail = true
+	root := state.RootHash()
+	if height, err := blockMaker.MinnerRPC(common.Address{1}); height != 0 || err == nil {
+		t.Fatalf("block produced although sealing failed, height %d", height)
+	}
+	if state.RootHash() != root {
+		t.Fatal("state written by the unsealed block was kept")
+	}
+
+	// 交易回到池中，下一个区块只执行它一次
+	engine.fail = false
+	if height, err := blockMaker.MinnerRPC(common.Address{1}); height != 1 || err != nil {
+		t.Fatalf("block not produced, height %d: %v", height, err)
+	}
+	header := blockMaker.Chain().GetCurrentHeader()
+	if body := blockMaker.Chain().GetBody(header.Hash()); len(body.Transactions) != 1 || *body.Transactions[0].Hash() != *transaction.Hash() {
+		t.Fatal("transaction not packed after the failed seal")
+	}
+	latest, err := blockMaker.StateAt(maker.LatestBlock)
+	if err != nil {
+		t.Fatalf("StateAt failed: %v", err)
+	}
+	if account, _ := latest.GetAccount(sender); account.Nonce != 1 || account.Balance != 1000000-10-tx.TxGas {
+		t.Errorf("sender balance %d nonce %d", account.Balance, account.Nonce)
+	}
+}
+
+func TestAddBlock_RejectsGap(t *testing.T) {
+	chain := &block.Blockchain{}
+	if err := chain.AddBlock(&block.Header{Height: 0}, block.NewBlock(), nil, nil); err != nil {
+		t.Fatalf("AddBlock genesis: %v", err)
+	}
+	if err := chain.AddBlock(&block.Header{Height: 2}, block.NewBlock(), nil, nil); err == nil {
+		t.Error("block leaving a gap was added")
+	}
+	if head := chain.GetCurrentHeader(); head.Height != 0 {
+		t.Errorf("head moved to %d", head.Height)
+	}
+}
+
+func TestImportBlock_RejectsReplayedTransaction(t *testing.T) {
+	dir := "test_db_import_replay"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+
+	source := newExportNode(t, filepath.Join(dir, "source"))
+	source.MinnerRPC(common.Address{1})
+	target := newExportNode(t, filepath.Join(dir, "target"))
+	genesis := source.GetHeaderByHeight(0)
+	if err := target.ImportBlock(genesis, source.Chain().GetBody(genesis.Hash())); err != nil {
+		t.Fatalf("import genesis: %v", err)
+	}
+	sender := keyToAddress(t, senderKeys[0])
+	for _, node := range []*maker.BlockMaker{source, target} {
+		if err := vm.NewVM(node.State).Mint(sender); err != nil {
+			t.Fatalf("Mint failed: %v", err)
+		}
+	}
+	if err := source.Txpool.NewTX(signedTx(t, senderKeys[0], 1, 10, 1)); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	source.MinnerRPC(common.Address{1})
+	block1 := source.GetHeaderByHeight(1)
+	if err := target.ImportBlock(block1, source.Chain().GetBody(block1.Hash())); err != nil {
+		t.Fatalf("import block 1: %v", err)
+	}
+
+	// 下一个区块原样带上已经上链的交易，重放要在执行时被拒绝
+	replay := *block1
+	replay.Height, replay.ParentHash = 2, block1.Hash()
+	replay.MMRRoot = target.Chain().GetMMRRoot()
+	if err := target.ImportBlock(&replay, source.Chain().GetBody(block1.Hash())); !errors.Is(err, tx.ErrNonceTooLow) {
+		t.Errorf("imported a replayed transaction: %v", err)
+	}
+	if head := target.Chain().GetCurrentHeader(); head.Height != 1 || target.State.RootHash() != block1.Root {
+		t.Errorf("replayed block changed the chain, head %d", head.Height)
+	}
+
+	// 跳过 nonce 的交易同样不能导入
+	skipped := block.NewBlock()
+	skipped.Transactions = append(skipped.Transactions, signedTx(t, senderKeys[0], 3, 10, 1))
+	if err := target.ImportBlock(&replay, skipped); !errors.Is(err, tx.ErrNonceTooHigh) {
+		t.Errorf("imported a transaction skipping a nonce: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package testmaker
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestStateAt_PendingLatestAndHeight(t *testing.T) {
+	dbDir := "test_db_state_at"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	sender := keyToAddress(t, senderKeys[0])
+	receiver := common.Address{9}
+
+	// 创世区块的补贴给发送者，再出一个空块
+	blockMaker.MinnerRPC(sender)
+	blockMaker.MinnerRPC(common.Address{1})
+
+	query := func(blockNumber string) (uint64, uint64) {
+		view, err := blockMaker.StateAt(blockNumber)
+		if err != nil {
+			t.Fatalf("StateAt(%q) failed: %v", blockNumber, err)
+		}
+		account, _ := view.GetAccount(sender)
+		return account.Balance, account.Nonce
+	}
+
+	// 没有待出块区块时 pending 等于 latest
+	if balance, nonce := query(maker.PendingBlock); balance != 1000000 || nonce != 0 {
+		t.Errorf("pending without block: balance %d nonce %d", balance, nonce)
+	}
+
+	transfer := signedTx(t, senderKeys[0], 1, 100, 1)
+	if err := blockMaker.Txpool.NewTX(transfer); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	if err := blockMaker.NewBlock(); err != nil {
+		t.Fatalf("NewBlock failed: %v", err)
+	}
+	if err := blockMaker.Pack(); err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+
+	want := uint64(1000000 - 100 - tx.TxGas)
+	if balance, nonce := query(maker.PendingBlock); balance != want || nonce != 1 {
+		t.Errorf("pending: balance %d nonce %d, want %d 1", balance, nonce, want)
+	}
+	if balance, nonce := query(maker.LatestBlock); balance != 1000000 || nonce != 0 {
+		t.Errorf("latest: balance %d nonce %d, want 1000000 0", balance, nonce)
+	}
+	if balance, _ := query("0x0"); balance != 1000000 {
+		t.Errorf("height 0: balance %d, want 1000000", balance)
+	}
+	if _, err := blockMaker.StateAt("7"); err == nil {
+		t.Error("unknown height should fail")
+	}
+	header, body := blockMaker.Pending()
+	if header == nil || header.GasUsed != tx.TxGas || len(body.Transactions) != 1 {
+		t.Fatal("pending block does not contain the transaction")
+	}
+
+	// 试执行不改变待出块区块的状态
+	view, _ := blockMaker.StateAt(maker.PendingBlock)
+	to := receiver
+	gas, err := view.Call(vm.CallMsg{From: sender, To: &to, Value: big.NewInt(50)})
+	if err != nil || gas != tx.TxGas {
+		t.Errorf("call: gas %d err %v", gas, err)
+	}
+	if _, err := view.Call(vm.CallMsg{From: sender, To: &to, Value: big.NewInt(2000000)}); err == nil {
+		t.Error("call exceeding the balance should fail")
+	}
+	if account, _ := view.GetAccount(receiver); account.Balance != 100 {
+		t.Errorf("receiver balance after calls: %d, want 100", account.Balance)
+	}
+	if balance, nonce := query(maker.PendingBlock); balance != want || nonce != 1 {
+		t.Errorf("pending changed by call: balance %d nonce %d", balance, nonce)
+	}
+}
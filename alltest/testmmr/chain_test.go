@@ -0,0 +1,147 @@
+package testmmr
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mmr"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// rootOf 直接用区块哈希重新算一遍MMR根
+func rootOf(headers []*block.Header) common.Hash {
+	history := mmr.New(mimc.NewMiMC())
+	for _, header := range headers {
+		hash := header.Hash()
+		history.AddLeaf(hash.Bytes())
+	}
+	var root common.Hash
+	copy(root[:], history.Root())
+	return root
+}
+
+func TestChain_HeadersCommitToAncestors(t *testing.T) {
+	dbDir := "test_db_mmr_chain"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	state := mpt.NewMPT(db)
+	blockMaker := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	for i := 0; i < 10; i++ {
+		blockMaker.MinnerRPC(common.Address{1})
+	}
+
+	var headers []*block.Header
+	for height := uint64(0); height < 10; height++ {
+		header := blockMaker.GetHeaderByHeight(height)
+		if header.MMRRoot != rootOf(headers) {
+			t.Errorf("header %d does not commit to the previous block hashes", height)
+		}
+		headers = append(headers, header)
+	}
+
+	head := blockMaker.GetCurrentHeader()
+	for height := uint64(0); height < head.Height; height++ {
+		proof, err := blockMaker.GetAncestorProof(height)
+		if err != nil {
+			t.Fatalf("GetAncestorProof(%d) failed: %v", height, err)
+		}
+		if !block.VerifyAncestorProof(head, headers[height], proof) {
+			t.Errorf("ancestor proof for block %d does not verify", height)
+		}
+		// 换一个区块头或者换成别的高度的区块都不能通过
+		forged := *headers[height]
+		forged.Nonce++
+		if block.VerifyAncestorProof(head, &forged, proof) {
+			t.Errorf("forged block %d verifies", height)
+		}
+		if other := headers[(height+1)%head.Height]; block.VerifyAncestorProof(head, other, proof) {
+			t.Errorf("proof for block %d verifies block %d", height, other.Height)
+		}
+	}
+	if _, err := blockMaker.GetAncestorProof(head.Height); err == nil {
+		t.Error("the head is not its own ancestor")
+	}
+}
+
+func TestChain_MMRFollowsReorg(t *testing.T) {
+	chain := &block.Blockchain{}
+	var canonical []*block.Header
+	var parent *block.Header
+	for height := 0; height < 6; height++ {
+		header := block.NewHeader(parent)
+		header.MMRRoot = chain.GetMMRRoot()
+		chain.AddBlock(header, block.NewBlock(), nil, nil)
+		canonical = append(canonical, header)
+		parent = header
+	}
+
+	// 在高度3换一条分叉，MMR退回到分叉点再追加
+	fork := block.NewHeader(canonical[2])
+	fork.Nonce = 42
+	chain.AddBlock(fork, block.NewBlock(), nil, nil)
+	want := rootOf(append(canonical[:3:3], fork))
+	if chain.GetMMRRoot() != want {
+		t.Error("mmr root after reorg differs from the root of the new canonical chain")
+	}
+}
+
+// failingStore 打开开关后写入都失败
+type failingStore struct {
+	*mmr.MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Put(key, value []byte) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Put(key, value)
+}
+
+func TestChain_AddBlockKeepsChainWhenHistoryFails(t *testing.T) {
+	chain := &block.Blockchain{}
+	store := &failingStore{MemoryStore: mmr.NewMemoryStore()}
+	if err := chain.SetHistoryStore(store); err != nil {
+		t.Fatal(err)
+	}
+	var canonical []*block.Header
+	var parent *block.Header
+	for height := 0; height < 3; height++ {
+		header := block.NewHeader(parent)
+		header.MMRRoot = chain.GetMMRRoot()
+		if err := chain.AddBlock(header, block.NewBlock(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		canonical = append(canonical, header)
+		parent = header
+	}
+
+	store.fail = true
+	next := block.NewHeader(parent)
+	if err := chain.AddBlock(next, block.NewBlock(), nil, nil); err == nil {
+		t.Fatal("expected the history write error")
+	}
+	fork := block.NewHeader(canonical[1])
+	fork.Nonce = 42
+	if err := chain.AddBlock(fork, block.NewBlock(), nil, nil); err == nil {
+		t.Fatal("expected the history rewind error")
+	}
+	if chain.GetCurrentHeader() != parent || chain.GetHeaderByHash(next.Hash()) != nil {
+		t.Error("a block whose history update failed changed the chain")
+	}
+	if chain.GetMMRRoot() != rootOf(canonical) {
+		t.Error("mmr root no longer matches the canonical chain")
+	}
+}
@@ -0,0 +1,110 @@
+package testmmr
+
+import (
+	"blockchain/mmr"
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeightBitmapForMMRSize(t *testing.T) {
+	testValues := []struct {
+		mmrSize  uint64
+		expected uint64
+	}{
+		{1, 1}, {3, 2}, {4, 3}, {7, 4}, {10, 6}, {15, 8}, {22, 12}, {25, 14},
+		{26, 15}, {31, 16}, {32, 17}, {34, 18}, {35, 19}, {38, 20}, {41, 22}, {42, 23},
+	}
+	for _, test := range testValues {
+		if peaks, _ := mmr.HeightBitmapForMMRSize(test.mmrSize); peaks != test.expected {
+			t.Errorf("HeightBitmapForMMRSize(%d) = %d, want %d", test.mmrSize, peaks, test.expected)
+		}
+	}
+}
+
+func TestMMRAddLeafAndSizes(t *testing.T) {
+	testCases := []struct {
+		nrLeavesToAdd      uint64
+		expectedNrElements uint64
+	}{
+		{7, 11}, {8, 15}, {9, 16}, {10, 18}, {16, 31},
+	}
+	for _, tc := range testCases {
+		m := mmr.New(sha256.New())
+		for i := uint64(0); i < tc.nrLeavesToAdd; i++ {
+			m.AddLeaf([]byte{byte(i)})
+		}
+		if m.Size() != tc.expectedNrElements || mmr.MMRSizeForLeaves(tc.nrLeavesToAdd) != tc.expectedNrElements {
+			t.Errorf("after adding %d leaves: size %d, want %d", tc.nrLeavesToAdd, m.Size(), tc.expectedNrElements)
+		}
+		if m.LeafCount() != tc.nrLeavesToAdd {
+			t.Errorf("leaf count %d, want %d", m.LeafCount(), tc.nrLeavesToAdd)
+		}
+	}
+	// 第4个叶子（从0数）在位置7，第8个在位置15
+	assert.Equal(t, uint64(7), mmr.LeafIndex(4))
+	assert.Equal(t, uint64(15), mmr.LeafIndex(8))
+}
+
+func TestGetProof_EveryLeaf(t *testing.T) {
+	for _, nrLeaves := range []int{1, 2, 3, 7, 16, 17} {
+		m := mmr.New(sha256.New())
+		var leaves [][]byte
+		for i := 0; i < nrLeaves; i++ {
+			leaf := []byte{byte(i), 0xab}
+			leaves = append(leaves, leaf)
+			m.AddLeaf(leaf)
+		}
+		root := m.BaggingThePeaks(sha256.New())
+		for i, leaf := range leaves {
+			proof := m.GetProof(mmr.LeafIndex(uint64(i)))
+			if !proof.Verify(leaf, root, sha256.New()) {
+				t.Errorf("%d leaves: proof of leaf %d does not verify", nrLeaves, i)
+			}
+			if proof.Verify([]byte{0xff}, root, sha256.New()) {
+				t.Errorf("%d leaves: proof of leaf %d verifies another leaf", nrLeaves, i)
+			}
+		}
+	}
+}
+
+func TestAtLeavesAndRewind(t *testing.T) {
+	// 用和链上一样的MiMC，叶子是32字节的域元素
+	leaf := func(i int) []byte {
+		b := make([]byte, 32)
+		b[31] = byte(i + 1)
+		return b
+	}
+	full := mmr.New(mimc.NewMiMC())
+	for i := 0; i < 13; i++ {
+		full.AddLeaf(leaf(i))
+	}
+	for k := 0; k <= 13; k++ {
+		fresh := mmr.New(mimc.NewMiMC())
+		for i := 0; i < k; i++ {
+			fresh.AddLeaf(leaf(i))
+		}
+		view, err := full.AtLeaves(uint64(k))
+		if err != nil {
+			t.Fatalf("AtLeaves(%d) failed: %v", k, err)
+		}
+		if !bytes.Equal(view.Root(), fresh.Root()) || view.LeafCount() != uint64(k) {
+			t.Errorf("view at %d leaves differs from an MMR built with %d leaves", k, k)
+		}
+	}
+	if _, err := full.AtLeaves(14); err == nil {
+		t.Error("view beyond the last leaf should fail")
+	}
+
+	// 回退后重新追加得到相同的根
+	root := full.Root()
+	assert.NoError(t, full.Rewind(5))
+	assert.Equal(t, uint64(5), full.LeafCount())
+	for i := 5; i < 13; i++ {
+		full.AddLeaf(leaf(i))
+	}
+	assert.Equal(t, root, full.Root())
+}
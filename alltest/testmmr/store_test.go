@@ -0,0 +1,108 @@
+package testmmr
+
+import (
+	"blockchain/mmr"
+	"blockchain/mpt"
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+func fieldLeaf(i int) []byte {
+	b := make([]byte, 32)
+	b[30], b[31] = byte(i>>8), byte(i)
+	return b
+}
+
+func TestPersistentMMR_MatchesInMemory(t *testing.T) {
+	dbDir := "test_db_mmr_store"
+	os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+
+	memory := mmr.New(mimc.NewMiMC())
+	stored, err := mmr.NewPersistent(db, []byte("test-"), mimc.NewMiMC())
+	if err != nil {
+		t.Fatalf("NewPersistent failed: %v", err)
+	}
+	for i := 0; i < 37; i++ {
+		memory.AddLeaf(fieldLeaf(i))
+		if err := stored.AddLeaf(fieldLeaf(i)); err != nil {
+			t.Fatalf("AddLeaf failed: %v", err)
+		}
+		if stored.Size() != memory.Size() || !bytes.Equal(stored.Root(), memory.Root()) {
+			t.Fatalf("after %d leaves the stored MMR differs from the in-memory one", i+1)
+		}
+	}
+
+	// 证明和内存版一致，且能验证
+	root := memory.Root()
+	for i := 0; i < 37; i++ {
+		index := mmr.LeafIndex(uint64(i))
+		proof, err := stored.GetProof(index)
+		if err != nil {
+			t.Fatalf("GetProof(%d) failed: %v", i, err)
+		}
+		want := memory.GetProof(index)
+		if len(proof.MerkleProof) != len(want.MerkleProof) || !proof.Verify(fieldLeaf(i), root, mimc.NewMiMC()) {
+			t.Errorf("proof of leaf %d differs or does not verify", i)
+		}
+	}
+	if _, err := stored.GetProof(stored.Size()); err == nil {
+		t.Error("proof beyond the last element should fail")
+	}
+
+	// 重启后从数据库恢复同样的根和山峰
+	db.Close()
+	db, err = mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+	reopened, err := mmr.NewPersistent(db, []byte("test-"), mimc.NewMiMC())
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if reopened.LeafCount() != 37 || !bytes.Equal(reopened.Root(), root) || len(reopened.GetPeaks()) != len(memory.GetPeaks()) {
+		t.Fatal("reopened MMR differs")
+	}
+
+	// 旧大小的只读视图和回退
+	view, err := reopened.AtLeaves(20)
+	if err != nil {
+		t.Fatalf("AtLeaves failed: %v", err)
+	}
+	memoryView, _ := memory.AtLeaves(20)
+	if !bytes.Equal(view.Root(), memoryView.Root()) {
+		t.Error("view root differs from the in-memory view")
+	}
+	if err := view.AddLeaf(fieldLeaf(0)); err == nil {
+		t.Error("view must be read-only")
+	}
+	if err := reopened.Rewind(20); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if !bytes.Equal(reopened.Root(), memoryView.Root()) || reopened.LeafCount() != 20 {
+		t.Error("rewound MMR differs from the MMR with 20 leaves")
+	}
+	for i := 20; i < 37; i++ {
+		reopened.AddLeaf(fieldLeaf(i))
+	}
+	if !bytes.Equal(reopened.Root(), root) {
+		t.Error("re-appending after rewind gives a different root")
+	}
+	if err := reopened.Rewind(38); err == nil {
+		t.Error("rewinding forward should fail")
+	}
+
+	// 不同前缀互不影响
+	other, _ := mmr.NewPersistent(db, []byte("other-"), mimc.NewMiMC())
+	if other.Size() != 0 {
+		t.Error("MMR under another prefix is not empty")
+	}
+}
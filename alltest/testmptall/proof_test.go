@@ -0,0 +1,67 @@
+package main
+
+import (
+	"blockchain/mpt"
+	"bytes"
+	"testing"
+)
+
+func TestMPTProof(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	trie := mpt.NewMPT(db)
+	keys := [][]byte{{0x12, 0x34}, {0x12, 0x35}, {0x12, 0x44}, {0x56, 0x78}}
+	for i, key := range keys {
+		if err := trie.Put(key, []byte{byte(i + 1)}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	root := trie.RootHash()
+
+	// 重新按根打开，子节点从数据库加载
+	reopened, err := mpt.NewMPTWithRoot(db, root)
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+	for i, key := range keys {
+		proof, err := reopened.Prove(key)
+		if err != nil {
+			t.Fatalf("Prove(%x) failed: %v", key, err)
+		}
+		value, err := mpt.VerifyProof(root, key, proof)
+		if err != nil || !bytes.Equal(value, []byte{byte(i + 1)}) {
+			t.Errorf("VerifyProof(%x) = %x, %v", key, value, err)
+		}
+		// 少一个节点或换一个根都不能通过
+		if _, err := mpt.VerifyProof(root, key, proof[:len(proof)-1]); err == nil {
+			t.Errorf("truncated proof of %x verifies", key)
+		}
+		if _, err := mpt.VerifyProof(root, key, [][]byte{[]byte(`{"nodeType":0,"key":"","value":"AQ=="}`)}); err == nil {
+			t.Errorf("forged proof of %x verifies", key)
+		}
+	}
+
+	// 不存在的键得到不存在的证明
+	for _, key := range [][]byte{{0x12, 0x36}, {0x99, 0x99}} {
+		proof, err := reopened.Prove(key)
+		if err != nil {
+			t.Fatalf("Prove(%x) failed: %v", key, err)
+		}
+		if value, err := mpt.VerifyProof(root, key, proof); err != nil || value != nil {
+			t.Errorf("absent key %x: value %x, err %v", key, value, err)
+		}
+	}
+
+	// 旧的根仍然可以证明旧值
+	if err := trie.Put(keys[0], []byte{0xff}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	proof, _ := reopened.Prove(keys[0])
+	if value, _ := mpt.VerifyProof(root, keys[0], proof); !bytes.Equal(value, []byte{1}) {
+		t.Errorf("old root proves %x", value)
+	}
+	if _, err := mpt.VerifyProof(trie.RootHash(), keys[0], proof); err == nil {
+		t.Error("proof against the old root verifies against the new root")
+	}
+}
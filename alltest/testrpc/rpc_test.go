@@ -54,7 +54,9 @@ func TestRPC(t *testing.T) {
 	blockMaker := get_block_maker()
 	fmt.Println("BlockMaker创建成功")
 
-	rpc.MinnerRPC(blockMaker, minerAddress)
+	if _, err := rpc.MinnerRPC(blockMaker, minerAddress); err != nil {
+		t.Fatalf("MinnerRPC failed: %v", err)
+	}
 	fmt.Println("第一次挖矿完成")
 
 	minnerBalance := rpc.UserRPC_balance(blockMaker, minerAddress)
@@ -105,7 +107,9 @@ func TestRPC(t *testing.T) {
 	fmt.Println("交易已成功添加到交易池")
 
 	// 再次使用MinnerRPC打包交易
-	rpc.MinnerRPC(blockMaker, minerAddress)
+	if _, err := rpc.MinnerRPC(blockMaker, minerAddress); err != nil {
+		t.Fatalf("MinnerRPC failed: %v", err)
+	}
 	fmt.Println("第二次挖矿完成")
 
 	// 检查矿工和接收者的余额变化
@@ -0,0 +1,207 @@
+package testsnapshot
+
+import (
+	rpc "blockchain/RPC"
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/snapshot"
+	"blockchain/tx"
+	"blockchain/vm"
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func openDB(t *testing.T, dir string) *mpt.DB {
+	os.RemoveAll(dir)
+	db, err := mpt.NewDB(dir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	return db
+}
+
+// commitBlock 在 base 状态上改几个账户，返回新的状态根和写入的账户
+func commitBlock(t *testing.T, db *mpt.DB, base common.Hash, balances map[common.Address]uint64) (common.Hash, map[string][]byte) {
+	trie, err := mpt.NewMPTWithRoot(db, base)
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+	evm := vm.NewVM(trie)
+	evm.DeferCommit()
+	for addr, balance := range balances {
+		evm.SetAccount(addr, &common.Account{Balance: balance, IsEoa: true})
+	}
+	if err := evm.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	parent, accounts := evm.GetStateDiff()
+	if parent != base {
+		t.Fatalf("diff parent %x, want %x", parent, base)
+	}
+	return trie.RootHash(), accounts
+}
+
+// checkReads 快照读到的和直接读状态树的结果一致
+func checkReads(t *testing.T, tree *snapshot.Tree, db *mpt.DB, root common.Hash, addrs []common.Address) {
+	t.Helper()
+	trie, err := mpt.NewMPTWithRoot(db, root)
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+	for _, addr := range addrs {
+		want, wantErr := trie.Get(addr.Bytes())
+		got, err := tree.Get(trie, addr.Bytes())
+		if !bytes.Equal(got, want) || (err == nil) != (wantErr == nil) {
+			t.Errorf("root %x account %v: snapshot %s (%v), trie %s (%v)", root[:4], addr, got, err, want, wantErr)
+		}
+	}
+}
+
+func TestTree_LayersFlattenAndForks(t *testing.T) {
+	db := openDB(t, "test_db_snapshot_tree")
+	a, b, c := common.Address{1}, common.Address{2}, common.Address{3}
+	addrs := []common.Address{a, b, c, {4}}
+
+	genesis, _ := commitBlock(t, db, common.Hash{}, map[common.Address]uint64{a: 100})
+	trie, _ := mpt.NewMPTWithRoot(db, genesis)
+	tree, err := snapshot.New(db, trie)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if tree.DiskRoot() != genesis {
+		t.Fatal("snapshot not generated from the trie")
+	}
+
+	// genesis -> r1 -> r2 -> r3，另外在 r1 上分叉出 f2
+	r1, d1 := commitBlock(t, db, genesis, map[common.Address]uint64{a: 90, b: 10})
+	r2, d2 := commitBlock(t, db, r1, map[common.Address]uint64{b: 20})
+	r3, d3 := commitBlock(t, db, r2, map[common.Address]uint64{c: 5})
+	f2, df := commitBlock(t, db, r1, map[common.Address]uint64{a: 1, c: 7})
+	for _, update := range []struct {
+		root, parent common.Hash
+		diff         map[string][]byte
+	}{{r1, genesis, d1}, {r2, r1, d2}, {r3, r2, d3}, {f2, r1, df}} {
+		if err := tree.Update(update.root, update.parent, update.diff); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+	if err := tree.Update(common.Hash{9}, common.Hash{8}, nil); err == nil {
+		t.Error("layer on an unknown parent accepted")
+	}
+	for _, root := range []common.Hash{genesis, r1, r2, r3, f2} {
+		if !tree.Covers(root) {
+			t.Errorf("root %x not covered", root[:4])
+		}
+		checkReads(t, tree, db, root, addrs)
+	}
+
+	// 只留一层差异层：r1 合并进磁盘，r1 上的分叉 f2 保留，r2 之前的状态不再有快照
+	if err := tree.Cap(r3, 1); err != nil {
+		t.Fatalf("Cap failed: %v", err)
+	}
+	if tree.DiskRoot() != r2 {
+		t.Fatalf("disk root %x, want r2", tree.DiskRoot())
+	}
+	if tree.Covers(r1) || tree.Covers(f2) || tree.Covers(genesis) || !tree.Covers(r3) {
+		t.Error("unexpected layers after flattening")
+	}
+	// 没有快照的状态根改读状态树，结果不变
+	for _, root := range []common.Hash{genesis, r1, r2, r3, f2} {
+		checkReads(t, tree, db, root, addrs)
+	}
+
+	// 重新打开时磁盘层和状态树对得上，不用重新生成
+	trie, _ = mpt.NewMPTWithRoot(db, r2)
+	reopened, err := snapshot.New(db, trie)
+	if err != nil || reopened.DiskRoot() != r2 {
+		t.Fatalf("reopen: %v", err)
+	}
+	checkReads(t, reopened, db, r2, addrs)
+	if data, err := db.Get(append([]byte("snapshot-account-"), b.Bytes()...)); err != nil || common.Reserialize(data).Balance != 20 {
+		t.Error("flattened account not stored on disk")
+	}
+}
+
+func TestTree_FollowsReorg(t *testing.T) {
+	db := openDB(t, "test_db_snapshot_reorg")
+	a := common.Address{1}
+	trie := mpt.NewMPT(db)
+	tree, err := snapshot.New(db, trie)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	genesis, d0 := commitBlock(t, db, common.Hash{}, map[common.Address]uint64{a: 1})
+	tree.Update(genesis, common.Hash{}, d0)
+	old, dOld := commitBlock(t, db, genesis, map[common.Address]uint64{a: 2})
+	tree.Update(old, genesis, dOld)
+
+	// 新分支更长，链头换到新分支后按新的状态根读
+	head := genesis
+	for i := uint64(3); i < 6; i++ {
+		root, diff := commitBlock(t, db, head, map[common.Address]uint64{a: i})
+		if err := tree.Update(root, head, diff); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		head = root
+	}
+	if err := tree.Cap(head, 2); err != nil {
+		t.Fatalf("Cap failed: %v", err)
+	}
+	trie, _ = mpt.NewMPTWithRoot(db, head)
+	data, err := tree.Get(trie, a.Bytes())
+	if err != nil || common.Reserialize(data).Balance != 5 {
+		t.Fatalf("balance on the new head: %s %v", data, err)
+	}
+	if tree.Covers(old) {
+		t.Error("layer of the abandoned branch kept after flattening past the fork")
+	}
+	checkReads(t, tree, db, old, []common.Address{a})
+}
+
+func TestBlockMaker_UsesSnapshot(t *testing.T) {
+	db := openDB(t, "test_db_snapshot_maker")
+	state := mpt.NewMPT(db)
+	node := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	key := "1111111111111111111111111111111111111111111111111111111111111111"
+	publicKey, _ := common.PrivateKeyToPublicKey(key)
+	sender := common.Address{}.PublicKeyToAddress(publicKey)
+
+	node.MinnerRPC(sender)
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		transaction := tx.NewTransaction(nonce, common.Address{7}, big.NewInt(10), tx.TxGas, big.NewInt(1), nil, big.NewInt(1))
+		privateKey, _ := hex.DecodeString(key)
+		transaction.Sign(privateKey)
+		if err := node.Txpool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX nonce %d: %v", nonce, err)
+		}
+		node.MinnerRPC(common.Address{1})
+	}
+
+	snaps := node.Snapshots()
+	head := node.GetCurrentHeader()
+	if snaps == nil || !snaps.Covers(head.Root) || !snaps.Covers(node.GetHeaderByHeight(1).Root) {
+		t.Fatal("blocks not recorded in the snapshot")
+	}
+	trie := vm.NewVM(state)
+	for _, addr := range []common.Address{sender, {7}, {1}} {
+		want, _ := trie.GetAccount(addr)
+		if balance := rpc.UserRPC_balance(node, addr); balance != want.Balance {
+			t.Errorf("%v: balance %d, want %d", addr, balance, want.Balance)
+		}
+	}
+	if balance, _ := rpc.UserRPC_getBalance(node, common.Address{7}, "0"); balance != 0 {
+		t.Errorf("balance after genesis: %d", balance)
+	}
+	if balance, _ := rpc.UserRPC_getBalance(node, common.Address{7}, "1"); balance != 10 {
+		t.Errorf("balance after block 1: %d", balance)
+	}
+}
@@ -0,0 +1,148 @@
+package teststatedump
+
+import (
+	"blockchain/common"
+	"blockchain/consensus/pow"
+	"blockchain/maker"
+	"blockchain/mpt"
+	"blockchain/statedump"
+	"blockchain/tx"
+	"blockchain/vm"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openDB(t *testing.T, path string) *mpt.DB {
+	db, err := mpt.NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// populate 分几批随机写入账户，模拟多个区块陆续改动状态
+func populate(t *testing.T, state *mpt.MPT) []common.Address {
+	r := rand.New(rand.NewSource(1))
+	var addrs []common.Address
+	for batch := 0; batch < 3; batch++ {
+		evm := vm.NewVM(state)
+		evm.DeferCommit()
+		for i := 0; i < 15; i++ {
+			var addr common.Address
+			r.Read(addr[:2]) //共享前缀的地址让树里出现扩展节点
+			account := &common.Account{Nonce: uint64(r.Intn(10)), Balance: uint64(r.Intn(1000)), IsEoa: true}
+			if i%5 == 0 {
+				account = common.NewContract([]byte{byte(i)}, []byte{0x60, byte(i)})
+				account.Storage["slot"] = "value"
+			}
+			if err := evm.SetAccount(addr, account); err != nil {
+				t.Fatalf("SetAccount failed: %v", err)
+			}
+			addrs = append(addrs, addr)
+		}
+		if err := evm.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+	return addrs
+}
+
+func TestStateDump_RoundTrip(t *testing.T) {
+	dir := "test_db_statedump"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+
+	source := mpt.NewMPT(openDB(t, filepath.Join(dir, "source")))
+	addrs := populate(t, source)
+	want := vm.NewVM(source)
+
+	for _, format := range []statedump.Format{statedump.FormatJSON, statedump.FormatBinary} {
+		path := filepath.Join(dir, "state.dump")
+		written, err := statedump.DumpFile(path, source, format)
+		if err != nil {
+			t.Fatalf("dump format %d: %v", format, err)
+		}
+		restored, read, err := statedump.RestoreFile(path, openDB(t, filepath.Join(dir, fmt.Sprintf("restore-%d", format))))
+		if err != nil {
+			t.Fatalf("restore format %d: %v", format, err)
+		}
+		if read != written || restored.RootHash() != source.RootHash() {
+			t.Fatalf("format %d: %d of %d accounts, roots %x %x", format, read, written, restored.RootHash(), source.RootHash())
+		}
+		got := vm.NewVM(restored)
+		for _, addr := range addrs {
+			a, _ := want.GetAccount(addr)
+			b, _ := got.GetAccount(addr)
+			if !bytes.Equal(a.Serialize(), b.Serialize()) {
+				t.Errorf("format %d: account %v differs", format, addr)
+			}
+		}
+	}
+}
+
+func TestStateDump_DetectsTampering(t *testing.T) {
+	dir := "test_db_statedump_tamper"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+
+	source := mpt.NewMPT(openDB(t, filepath.Join(dir, "source")))
+	populate(t, source)
+	var dump bytes.Buffer
+	if _, err := statedump.Dump(&dump, source, statedump.FormatJSON); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+
+	// 改掉一个账户的余额
+	lines := strings.Split(dump.String(), "\n")
+	lines[3] = strings.Replace(lines[3], `"balance":`, `"balance":1`, 1)
+	_, _, err := statedump.Restore(strings.NewReader(strings.Join(lines, "\n")), openDB(t, filepath.Join(dir, "a")))
+	if !errors.Is(err, statedump.ErrRootMismatch) {
+		t.Errorf("tampered balance: %v", err)
+	}
+
+	// 少了最后一个账户
+	truncated := strings.Join(lines[:len(lines)-2], "\n")
+	_, _, err = statedump.Restore(strings.NewReader(truncated), openDB(t, filepath.Join(dir, "b")))
+	if !errors.Is(err, statedump.ErrRootMismatch) {
+		t.Errorf("missing account: %v", err)
+	}
+}
+
+func TestStateDump_FromBlock(t *testing.T) {
+	dir := "test_db_statedump_block"
+	os.RemoveAll(dir)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+
+	state := mpt.NewMPT(openDB(t, filepath.Join(dir, "node")))
+	node := maker.NewBlockMakerWithEngine(tx.NewTxPool(state), state, pow.New(0))
+	node.MinnerRPC(common.Address{1})
+	node.MinnerRPC(common.Address{2})
+	node.MinnerRPC(common.Address{3})
+
+	// 导出较早区块之后的状态，恢复出来的是那个区块的状态根
+	trie, err := node.StateTrieAt("1")
+	if err != nil {
+		t.Fatalf("StateTrieAt: %v", err)
+	}
+	path := filepath.Join(dir, "block1.dump")
+	if count, err := statedump.DumpFile(path, trie, statedump.FormatBinary); err != nil || count != 2 {
+		t.Fatalf("dump: %d accounts, %v", count, err)
+	}
+	restored, _, err := statedump.RestoreFile(path, openDB(t, filepath.Join(dir, "restored")))
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored.RootHash() != node.GetHeaderByHeight(1).Root {
+		t.Error("restored root differs from the block's state root")
+	}
+}
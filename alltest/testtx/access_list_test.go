@@ -0,0 +1,48 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestAccessListTx_SigningHashAndGas(t *testing.T) {
+	to := common.Address{}.NewAddress(bytes.Repeat([]byte{0x35}, 20))
+	accessList := tx.AccessList{
+		{Address: common.Address{1}, StorageKeys: []common.Hash{{1}, {2}}},
+		{Address: common.Address{2}, StorageKeys: []common.Hash{{3}}},
+	}
+	transaction := tx.NewAccessListTransaction(3, to, big.NewInt(5), 40000, big.NewInt(7), []byte{1, 0}, accessList, big.NewInt(1))
+	if err := transaction.Sign(mustKey()); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if transaction.Type() != tx.AccessListTxType || len(transaction.GetAccessList()) != 2 {
+		t.Fatalf("type %d", transaction.Type())
+	}
+
+	// 字段顺序和 EIP-2930 一致，访问列表编码成 [[address, [key...]]...]
+	fields := []interface{}{
+		big.NewInt(1), uint64(3), big.NewInt(7), uint64(40000),
+		transaction.To, big.NewInt(5), []byte{1, 0},
+		[]interface{}{
+			[]interface{}{common.Address{1}, []common.Hash{{1}, {2}}},
+			[]interface{}{common.Address{2}, []common.Hash{{3}}},
+		},
+	}
+	payload, _ := rlp.EncodeToBytes(fields)
+	wantHash := crypto.Keccak256(append([]byte{tx.AccessListTxType}, payload...))
+	if hash := tx.NewTypedSigner(big.NewInt(1)).Hash(transaction); !bytes.Equal(hash.Bytes(), wantHash) {
+		t.Errorf("signing hash %x, want %x", hash.Bytes(), wantHash)
+	}
+
+	// 每个声明的账户 2400，每个存储键 1900，data 一个非零一个零字节
+	want := tx.TxGas + 2*tx.TxAccessListAddressGas + 3*tx.TxAccessListStorageKeyGas + tx.TxDataNonZeroGas + tx.TxDataZeroGas
+	if gas := transaction.IntrinsicGas(); gas != want {
+		t.Errorf("intrinsic gas %d, want %d", gas, want)
+	}
+}
@@ -0,0 +1,54 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestBatchTx_IntrinsicGas(t *testing.T) {
+	calls := []tx.BatchCall{
+		{To: common.Address{1}, Value: big.NewInt(5)},
+		{To: common.Address{2}, Value: big.NewInt(7), Data: []byte{1, 0}},
+	}
+	transaction := tx.NewBatchTransaction(2, calls, 60000, big.NewInt(1), big.NewInt(1))
+	if err := transaction.Sign(mustKey()); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if transaction.IsContractCreation() {
+		t.Error("batch transaction taken as contract creation")
+	}
+	want := tx.TxGas + 2*tx.TxBatchCallGas + tx.TxDataNonZeroGas + tx.TxDataZeroGas
+	if gas := transaction.IntrinsicGas(); gas != want {
+		t.Errorf("intrinsic gas %d, want %d", gas, want)
+	}
+}
+
+func TestReceipt_CallResults(t *testing.T) {
+	receipt := &tx.Receipt{Status: tx.ReceiptStatusFailed, Logs: []*tx.Log{}, Type: tx.BatchTxType, CallResults: []tx.CallResult{
+		{Status: tx.ReceiptStatusSuccessful},
+		{Status: tx.ReceiptStatusFailed, Error: "insufficient balance"},
+	}}
+	data, _ := rlp.EncodeToBytes(receipt)
+	var decoded tx.Receipt
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		t.Fatalf("decode receipt: %v", err)
+	}
+	if len(decoded.CallResults) != 2 || decoded.CallResults[1].Error != "insufficient balance" {
+		t.Errorf("call results %v", decoded.CallResults)
+	}
+
+	// 调用结果影响收据根，失败原因不影响
+	root := tx.ReceiptsRoot([]*tx.Receipt{receipt})
+	receipt.CallResults[1].Error = "other"
+	if tx.ReceiptsRoot([]*tx.Receipt{receipt}) != root {
+		t.Error("error message changed the receipts root")
+	}
+	receipt.CallResults[0].Status = tx.ReceiptStatusFailed
+	if tx.ReceiptsRoot([]*tx.Receipt{receipt}) == root {
+		t.Error("call status not covered by the receipts root")
+	}
+}
@@ -0,0 +1,139 @@
+package testtx
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/tx"
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestDynamicFeeTx_Encoding(t *testing.T) {
+	to := common.Address{}.NewAddress(bytes.Repeat([]byte{0x35}, 20))
+	transaction := tx.NewDynamicFeeTransaction(9, to, big.NewInt(5), 21000, big.NewInt(2), big.NewInt(30), []byte{1, 2}, big.NewInt(1))
+	if err := transaction.Sign(mustKey()); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if transaction.Type() != tx.DynamicFeeTxType || !transaction.Protected() {
+		t.Fatalf("type %d", transaction.Type())
+	}
+	if v := transaction.V.Uint64(); v > 1 {
+		t.Errorf("typed transaction v = %d, want the recovery id", v)
+	}
+
+	// 编码和签名内容都按 EIP-1559 的字段顺序，类型字节在最前面
+	fields := []interface{}{
+		big.NewInt(1), uint64(9), big.NewInt(2), big.NewInt(30), uint64(21000),
+		transaction.To, big.NewInt(5), []byte{1, 2}, []interface{}{},
+	}
+	payload, _ := rlp.EncodeToBytes(fields)
+	wantHash := crypto.Keccak256(append([]byte{tx.DynamicFeeTxType}, payload...))
+	if hash := tx.NewTypedSigner(big.NewInt(1)).Hash(transaction); !bytes.Equal(hash.Bytes(), wantHash) {
+		t.Errorf("signing hash %x, want %x", hash.Bytes(), wantHash)
+	}
+	signed, _ := rlp.EncodeToBytes(append(fields, transaction.V, transaction.R, transaction.S))
+	serialized, err := transaction.Serialize()
+	if err != nil || !bytes.Equal(serialized, append([]byte{tx.DynamicFeeTxType}, signed...)) {
+		t.Fatalf("serialized %x, %v", serialized, err)
+	}
+
+	decoded, err := tx.Deserialize(serialized)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if _, err := tx.Sender(tx.NewTypedSigner(big.NewInt(2)), decoded); !errors.Is(err, tx.ErrInvalidChainID) {
+		t.Errorf("signer of another chain: %v", err)
+	}
+	if _, err := tx.Sender(tx.NewEIP155Signer(big.NewInt(1)), decoded); !errors.Is(err, tx.ErrTxTypeNotSupported) {
+		t.Errorf("legacy signer: %v", err)
+	}
+
+	// 区块体里和 legacy 交易混在一起
+	legacy := mustSigned(t, mustKey())
+	body := &block.Body{Transactions: []*tx.Transaction{legacy, transaction}}
+	data, _ := rlp.EncodeToBytes(body)
+	var decodedBody block.Body
+	if err := rlp.DecodeBytes(data, &decodedBody); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if decodedBody.Transactions[0].Type() != tx.LegacyTxType || *decodedBody.Transactions[1].Hash() != *transaction.Hash() {
+		t.Error("mixed body round trip failed")
+	}
+}
+
+func TestEffectiveGasTip(t *testing.T) {
+	legacy := tx.NewTransaction(1, common.Address{1}, big.NewInt(0), 21000, big.NewInt(10), nil, big.NewInt(1))
+	dynamic := tx.NewDynamicFeeTransaction(1, common.Address{1}, big.NewInt(0), 21000, big.NewInt(3), big.NewInt(10), nil, big.NewInt(1))
+	tests := []struct {
+		transaction *tx.Transaction
+		baseFee     *big.Int
+		tip, price  int64
+		err         error
+	}{
+		{legacy, nil, 10, 10, nil},
+		{legacy, big.NewInt(4), 6, 10, nil},
+		{legacy, big.NewInt(11), -1, 10, tx.ErrFeeCapTooLow},
+		{dynamic, nil, 3, 3, nil},
+		{dynamic, big.NewInt(4), 3, 7, nil},
+		{dynamic, big.NewInt(8), 2, 10, nil},
+		{dynamic, big.NewInt(12), -2, 10, tx.ErrFeeCapTooLow},
+	}
+	for i, test := range tests {
+		tip, err := test.transaction.GetEffectiveGasTip(test.baseFee)
+		if tip.Int64() != test.tip || !errors.Is(err, test.err) {
+			t.Errorf("%d: tip %v %v, want %d %v", i, tip, err, test.tip, test.err)
+		}
+		if price := test.transaction.GetEffectiveGasPrice(test.baseFee); price.Int64() != test.price {
+			t.Errorf("%d: price %v, want %d", i, price, test.price)
+		}
+	}
+}
+
+func TestCalcBaseFee(t *testing.T) {
+	parent := &block.Header{GasLimit: 80000, BaseFee: big.NewInt(800)}
+	tests := []struct {
+		gasUsed uint64
+		want    int64
+	}{
+		{40000, 800}, // 正好是目标
+		{80000, 900}, // 用满，涨 1/8
+		{0, 700},     // 空块，降 1/8
+		{60000, 850},
+		{40001, 801}, // 涨的时候至少涨1
+	}
+	for _, test := range tests {
+		parent.GasUsed = test.gasUsed
+		if got := block.CalcBaseFee(parent, big.NewInt(1)); got.Int64() != test.want {
+			t.Errorf("gas used %d: base fee %v, want %d", test.gasUsed, got, test.want)
+		}
+	}
+	if got := block.CalcBaseFee(&block.Header{GasLimit: 80000}, big.NewInt(7)); got.Int64() != 7 {
+		t.Errorf("first base fee %v", got)
+	}
+
+	// 没有 BaseFee 的区块头编码不变，旧区块的哈希不受影响
+	header := &block.Header{Height: 3, GasLimit: 80000}
+	type oldHeader struct {
+		Root, ReceiptRoot common.Hash
+		Bloom             tx.Bloom
+		MMRRoot           common.Hash
+		ParentHash        common.Hash
+		Height            uint64
+		Coinbase          common.Address
+		GasLimit, GasUsed uint64
+		Timestamp         uint64
+		Difficulty        uint64
+		Nonce             uint64
+		ExtraData         []byte
+	}
+	a, _ := rlp.EncodeToBytes(header)
+	b, _ := rlp.EncodeToBytes(oldHeader{Height: 3, GasLimit: 80000})
+	if !bytes.Equal(a, b) {
+		t.Error("header encoding changed for blocks without base fee")
+	}
+}
@@ -0,0 +1,301 @@
+package testtx
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/tx"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestEnvelope_LegacyEncodingUnchanged(t *testing.T) {
+	transaction := mustSigned(t, mustKey())
+	if transaction.Type() != tx.LegacyTxType {
+		t.Fatalf("type %d", transaction.Type())
+	}
+	serialized, _ := transaction.Serialize()
+
+	// 区块体里的 legacy 交易就是它自己的RLP列表，和旧的编码一致
+	var buf bytes.Buffer
+	if err := rlp.Encode(&buf, transaction); err != nil {
+		t.Fatalf("EncodeRLP failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), serialized) {
+		t.Errorf("rlp encoding %x differs from serialized %x", buf.Bytes(), serialized)
+	}
+
+	body := &block.Body{Transactions: []*tx.Transaction{transaction, transaction}}
+	data, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		t.Fatalf("encode body: %v", err)
+	}
+	var decoded block.Body
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if len(decoded.Transactions) != 2 {
+		t.Fatalf("decoded %d transactions", len(decoded.Transactions))
+	}
+	for i := range decoded.Transactions {
+		if *decoded.Transactions[i].Hash() != *transaction.Hash() {
+			t.Errorf("transaction %d hash differs after body round trip", i)
+		}
+	}
+}
+
+func TestEnvelope_UnknownType(t *testing.T) {
+	for _, raw := range [][]byte{{0x05, 0xc0}, {0x7f, 0xc1, 0x80}} {
+		if _, err := tx.Deserialize(raw); !errors.Is(err, tx.ErrTxTypeNotSupported) {
+			t.Errorf("%x: %v", raw, err)
+		}
+	}
+	if _, err := tx.Deserialize(nil); err == nil {
+		t.Error("empty input decoded")
+	}
+	if _, err := tx.Deserialize([]byte{0x05}); !errors.Is(err, tx.ErrEmptyTypedTx) {
+		t.Errorf("type byte only: %v", err)
+	}
+
+	// 区块体里的字节串按类型化交易解码
+	data, _ := rlp.EncodeToBytes([]interface{}{[]interface{}{[]byte{0x05, 0xc0}}})
+	var body block.Body
+	if err := rlp.DecodeBytes(data, &body); !errors.Is(err, tx.ErrTxTypeNotSupported) {
+		t.Errorf("body with unknown type: %v", err)
+	}
+
+	var transaction tx.Transaction
+	if err := json.Unmarshal([]byte(`{"type":"0x5","nonce":"0x0","gas":"0x5208","chainId":"0x1"}`), &transaction); !errors.Is(err, tx.ErrTxTypeNotSupported) {
+		t.Errorf("json with unknown type: %v", err)
+	}
+}
+
+// roundTripCase 一种交易：构造并签好名的交易、它的发送者、JSON 里应有的字段，以及解码后要保留的类型专有字段
+type roundTripCase struct {
+	name   string
+	build  func(t *testing.T) (*tx.Transaction, common.Address)
+	fields map[string]interface{} //nil 表示该字段不应出现
+	check  func(t *testing.T, decoded *tx.Transaction)
+}
+
+func roundTripCases() []roundTripCase {
+	to := common.Address{}.NewAddress(bytes.Repeat([]byte{0x35}, 20))
+	keys, owners := ownerKeys(2)
+	payer := owners[0]
+	treasury := common.Address{0xaa}
+	signed := func(t *testing.T, transaction *tx.Transaction) (*tx.Transaction, common.Address) {
+		if err := transaction.Sign(mustKey()); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		return transaction, keyAddress(mustKey())
+	}
+	return []roundTripCase{
+		{
+			name: "legacy",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				return mustSigned(t, mustKey()), keyAddress(mustKey())
+			},
+			fields: map[string]interface{}{"type": "0x0", "nonce": "0x9", "gasPrice": "0x4a817c800", "v": "0x25"},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if decoded.ChainID.Cmp(big.NewInt(1)) != 0 {
+					t.Errorf("chain id %v", decoded.ChainID)
+				}
+			},
+		},
+		{
+			name: "access list",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				accessList := tx.AccessList{
+					{Address: common.Address{1}, StorageKeys: []common.Hash{{1}, {2}}},
+					{Address: common.Address{2}, StorageKeys: []common.Hash{{3}}},
+				}
+				return signed(t, tx.NewAccessListTransaction(3, to, big.NewInt(5), 40000, big.NewInt(7), []byte{1, 0}, accessList, big.NewInt(1)))
+			},
+			fields: map[string]interface{}{"type": "0x1", "gasPrice": "0x7", "maxFeePerGas": nil},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if list := decoded.GetAccessList(); len(list) != 2 || list[1].StorageKeys[0] != (common.Hash{3}) {
+					t.Errorf("access list %v", list)
+				}
+			},
+		},
+		{
+			name: "dynamic fee",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				return signed(t, tx.NewDynamicFeeTransaction(9, to, big.NewInt(5), 21000, big.NewInt(2), big.NewInt(30), []byte{1, 2}, big.NewInt(1)))
+			},
+			fields: map[string]interface{}{"type": "0x2", "maxFeePerGas": "0x1e", "maxPriorityFeePerGas": "0x2", "gasPrice": nil},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if decoded.GetGasTipCap().Int64() != 2 || decoded.GetGasFeeCap().Int64() != 30 {
+					t.Errorf("fee caps %v %v", decoded.GetGasTipCap(), decoded.GetGasFeeCap())
+				}
+			},
+		},
+		{
+			name: "multisig",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				transaction := tx.NewMultisigTransaction(treasury, 4, common.Address{2}, big.NewInt(10), 50000, big.NewInt(1), nil, big.NewInt(1))
+				for _, key := range keys {
+					if err := transaction.Sign(key); err != nil {
+						t.Fatalf("Sign failed: %v", err)
+					}
+				}
+				return transaction, treasury
+			},
+			fields: map[string]interface{}{"type": "0x10"},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				account := &common.Account{Owners: owners, Threshold: 2}
+				if err := tx.VerifyMultisig(tx.NewTypedSigner(big.NewInt(1)), decoded, account); err != nil {
+					t.Errorf("signatures lost: %v", err)
+				}
+			},
+		},
+		{
+			name: "batch",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				calls := []tx.BatchCall{
+					{To: common.Address{1}, Value: big.NewInt(5)},
+					{To: common.Address{2}, Value: big.NewInt(7), Data: []byte{1, 0}},
+				}
+				return signed(t, tx.NewBatchTransaction(2, calls, 60000, big.NewInt(1), big.NewInt(1)))
+			},
+			fields: map[string]interface{}{"type": "0x11"},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if calls := decoded.GetBatchCalls(); len(calls) != 2 || calls[1].Value.Int64() != 7 || calls[1].To != (common.Address{2}) {
+					t.Errorf("calls %v", calls)
+				}
+			},
+		},
+		{
+			name: "sponsored",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				transaction, sender := signed(t, tx.NewSponsoredTransaction(2, common.Address{8}, big.NewInt(5), 30000, big.NewInt(3), []byte{1}, payer, big.NewInt(1)))
+				if err := transaction.SignFeePayer(keys[0]); err != nil {
+					t.Fatalf("SignFeePayer failed: %v", err)
+				}
+				return transaction, sender
+			},
+			fields: map[string]interface{}{"type": "0x12", "feePayer": "0x" + payer.String()},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if got, err := tx.FeePayer(tx.NewTypedSigner(big.NewInt(1)), decoded); err != nil || got != payer {
+					t.Errorf("fee payer %v %v", got, err)
+				}
+			},
+		},
+		{
+			name: "time bound",
+			build: func(t *testing.T) (*tx.Transaction, common.Address) {
+				return signed(t, tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(5), 21000, big.NewInt(1), nil, 10, 1700000000, big.NewInt(1)))
+			},
+			fields: map[string]interface{}{"type": "0x13", "validAfter": "0xa", "validUntil": "0x6553f100"},
+			check: func(t *testing.T, decoded *tx.Transaction) {
+				if decoded.GetValidAfter() != 10 || decoded.GetValidUntil() != 1700000000 {
+					t.Errorf("bounds %d %d", decoded.GetValidAfter(), decoded.GetValidUntil())
+				}
+			},
+		},
+	}
+}
+
+// TestEnvelope_RoundTrip 每种交易经过RLP和JSON编解码后哈希、发送者和类型专有字段都不变
+func TestEnvelope_RoundTrip(t *testing.T) {
+	for _, c := range roundTripCases() {
+		t.Run(c.name, func(t *testing.T) {
+			transaction, sender := c.build(t)
+			serialized, err := transaction.Serialize()
+			if err != nil {
+				t.Fatalf("Serialize failed: %v", err)
+			}
+			fromRLP, err := tx.Deserialize(serialized)
+			if err != nil {
+				t.Fatalf("Deserialize failed: %v", err)
+			}
+
+			data, err := json.Marshal(transaction)
+			if err != nil {
+				t.Fatalf("MarshalJSON failed: %v", err)
+			}
+			var fields map[string]interface{}
+			json.Unmarshal(data, &fields)
+			for name, want := range c.fields {
+				if fields[name] != want {
+					t.Errorf("json %s = %v, want %v", name, fields[name], want)
+				}
+			}
+			fromJSON := new(tx.Transaction)
+			if err := json.Unmarshal(data, fromJSON); err != nil {
+				t.Fatalf("UnmarshalJSON failed: %v", err)
+			}
+
+			for _, decoded := range []*tx.Transaction{fromRLP, fromJSON} {
+				if decoded.Type() != transaction.Type() || *decoded.Hash() != *transaction.Hash() {
+					t.Fatalf("round trip changed the transaction: %s", data)
+				}
+				if got, err := decoded.GetSender(); err != nil || got != sender {
+					t.Errorf("sender %v %v", got, err)
+				}
+				c.check(t, decoded)
+			}
+		})
+	}
+}
+
+func TestEnvelope_MalformedJSON(t *testing.T) {
+	// 没有 type 字段按 legacy 交易处理
+	var decoded tx.Transaction
+	if err := json.Unmarshal([]byte(`{"nonce":"0x1","gas":"0x5208","gasPrice":"0x1","to":"0x3535353535353535353535353535353535353535"}`), &decoded); err != nil {
+		t.Errorf("legacy json without type: %v", err)
+	} else if decoded.Type() != tx.LegacyTxType || *decoded.To != (common.Address{}.NewAddress(bytes.Repeat([]byte{0x35}, 20))) {
+		t.Errorf("decoded %+v", &decoded)
+	}
+
+	// 各类型缺少必需字段或字段格式不对时报错
+	for name, data := range map[string]string{
+		"legacy without gasPrice":                  `{"nonce":"0x1","gas":"0x5208"}`,
+		"dynamic fee without maxPriorityFeePerGas": `{"type":"0x2","chainId":"0x1","nonce":"0x1","gas":"0x5208","maxFeePerGas":"0x1"}`,
+		"access list with a short storage key":     `{"type":"0x1","chainId":"0x1","nonce":"0x1","gas":"0x5208","accessList":[{"address":"0100000000000000000000000000000000000000","storageKeys":["0x01"]}],"gasPrice":"0x1"}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &decoded); err == nil {
+			t.Errorf("%s decoded", name)
+		}
+	}
+}
+
+func TestEnvelope_ReceiptType(t *testing.T) {
+	// 加上类型字段之前存下的收据仍能解码，类型为 legacy
+	type oldReceipt struct {
+		Status            uint64
+		CumulativeGasUsed uint64
+		Logs              []*tx.Log
+		Bloom             tx.Bloom
+		TxHash            common.Hash
+		ContractAddress   common.Address
+		GasUsed           uint64
+		BlockHash         common.Hash
+		BlockNumber       uint64
+		TxIndex           uint
+	}
+	data, _ := rlp.EncodeToBytes([]*oldReceipt{{Status: tx.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*tx.Log{}, GasUsed: 21000}})
+	var receipts []*tx.Receipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		t.Fatalf("decode old receipts: %v", err)
+	}
+	if len(receipts) != 1 || receipts[0].Type != tx.LegacyTxType || receipts[0].GasUsed != 21000 {
+		t.Errorf("decoded %+v", receipts)
+	}
+
+	// 类型不同的收据共识哈希不同
+	typed := *receipts[0]
+	typed.Type = 2
+	if tx.ReceiptsRoot([]*tx.Receipt{receipts[0]}) == tx.ReceiptsRoot([]*tx.Receipt{&typed}) {
+		t.Error("receipt type does not affect the receipts root")
+	}
+}
+
+func mustKey() []byte {
+	_, key := eip155Example()
+	return key
+}
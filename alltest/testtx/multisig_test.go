@@ -0,0 +1,95 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func ownerKeys(n int) ([][]byte, []common.Address) {
+	keys := make([][]byte, n)
+	owners := make([]common.Address, n)
+	for i := range keys {
+		key, _ := crypto.GenerateKey()
+		keys[i] = crypto.FromECDSA(key)
+		owners[i] = keyAddress(keys[i])
+	}
+	return keys, owners
+}
+
+func TestMultisigTx_Signatures(t *testing.T) {
+	keys, owners := ownerKeys(3)
+	treasury := common.Address{0xaa}
+	transaction := tx.NewMultisigTransaction(treasury, 4, common.Address{2}, big.NewInt(10), 50000, big.NewInt(1), nil, big.NewInt(1))
+	signer := tx.NewTypedSigner(big.NewInt(1))
+	if _, err := tx.Sender(signer, transaction); err == nil {
+		t.Error("multisig transaction without signatures has a sender")
+	}
+
+	// 所有者签的是同一个哈希，加签名不改变它
+	hash := signer.Hash(transaction)
+	for _, key := range keys[:2] {
+		if err := transaction.Sign(key); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+	}
+	if signer.Hash(transaction) != hash {
+		t.Error("signing hash covers the signatures")
+	}
+	if sender, err := transaction.GetSender(); err != nil || sender != treasury {
+		t.Errorf("sender %v %v", sender, err)
+	}
+	if gas := transaction.IntrinsicGas(); gas != tx.TxGas+2*tx.TxMultisigSignatureGas {
+		t.Errorf("intrinsic gas %d", gas)
+	}
+
+	// 门限按不同的所有者计数：重复签名和非所有者的签名都不算
+	account := &common.Account{Owners: owners, Threshold: 2}
+	if err := tx.VerifyMultisig(signer, transaction, account); err != nil {
+		t.Errorf("2 of 3: %v", err)
+	}
+	account.Threshold = 3
+	if err := tx.VerifyMultisig(signer, transaction, account); !errors.Is(err, tx.ErrNotEnoughSignatures) {
+		t.Errorf("3 of 3 with two signatures: %v", err)
+	}
+	stranger, _ := crypto.GenerateKey()
+	transaction.Sign(keys[0])
+	transaction.Sign(crypto.FromECDSA(stranger))
+	if err := tx.VerifyMultisig(signer, transaction, account); !errors.Is(err, tx.ErrNotEnoughSignatures) {
+		t.Errorf("duplicate and stranger signatures counted: %v", err)
+	}
+	if err := tx.VerifyMultisig(signer, transaction, &common.Account{}); !errors.Is(err, tx.ErrNotMultisig) {
+		t.Errorf("plain account: %v", err)
+	}
+	if err := tx.VerifyMultisig(signer, mustSigned(t, mustKey()), account); !errors.Is(err, tx.ErrMultisigRequired) {
+		t.Errorf("single signature from a multisig account: %v", err)
+	}
+}
+
+func TestOwnerUpdate(t *testing.T) {
+	_, owners := ownerKeys(2)
+	update, ok, err := tx.DecodeOwnerUpdate(tx.EncodeOwnerUpdate(owners, 2))
+	if err != nil || !ok || update.Threshold != 2 || len(update.Owners) != 2 || update.Owners[1] != owners[1] {
+		t.Errorf("round trip: %v %v %v", update, ok, err)
+	}
+	if _, ok, _ := tx.DecodeOwnerUpdate([]byte("hello")); ok {
+		t.Error("ordinary data taken as an owner update")
+	}
+	for _, bad := range [][]byte{
+		tx.EncodeOwnerUpdate(owners, 3),
+		tx.EncodeOwnerUpdate(owners, 0),
+		tx.EncodeOwnerUpdate([]common.Address{owners[0], owners[0]}, 1),
+		append(append([]byte{}, tx.OwnerUpdatePrefix...), 0x01),
+	} {
+		if _, ok, err := tx.DecodeOwnerUpdate(bad); !ok || err == nil {
+			t.Errorf("accepted %x", bad)
+		}
+	}
+	if update, _, err := tx.DecodeOwnerUpdate(tx.EncodeOwnerUpdate(nil, 0)); err != nil || update.Threshold != 0 {
+		t.Errorf("clearing the owners: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package testtx
+
+import (
+	"blockchain/tx"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestTransactionJSON_EthereumLayout(t *testing.T) {
+	transaction := mustSigned(t, mustKey())
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+
+	// 数值都是0x开头的十六进制，地址和哈希也带0x，和以太坊RPC一致
+	from := keyAddress(mustKey())
+	want := map[string]interface{}{
+		"type":     "0x0",
+		"nonce":    "0x9",
+		"gas":      "0x5208",
+		"gasPrice": "0x4a817c800",
+		"value":    "0xde0b6b3a7640000",
+		"chainId":  "0x1",
+		"input":    "0x",
+		"to":       "0x" + transaction.To.String(),
+		"from":     "0x" + from.String(),
+		"hash":     "0x33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788", //EIP-155 示例交易的哈希
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+	for _, key := range []string{"v", "r", "s"} {
+		if s, ok := fields[key].(string); !ok || !strings.HasPrefix(s, "0x") {
+			t.Errorf("%s = %v", key, fields[key])
+		}
+	}
+
+	// hash 和 from 只是附带的信息，解码时不看
+	fields["hash"] = "0x00"
+	fields["from"] = "0x0000000000000000000000000000000000000001"
+	data, _ = json.Marshal(fields)
+	var decoded tx.Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if *decoded.Hash() != *transaction.Hash() {
+		t.Errorf("decoded transaction differs")
+	}
+	if sender, err := decoded.GetSender(); err != nil || sender != from {
+		t.Errorf("sender %v %v", sender, err)
+	}
+
+	// 没签名的交易没有 from
+	unsigned, _ := eip155Example()
+	data, _ = json.Marshal(unsigned)
+	if strings.Contains(string(data), `"from"`) {
+		t.Errorf("unsigned transaction json has a sender: %s", data)
+	}
+}
+
+func TestDecodeRawTransaction(t *testing.T) {
+	for _, c := range roundTripCases() {
+		transaction, _ := c.build(t)
+		serialized, _ := transaction.Serialize()
+		decoded, err := tx.DecodeRawTransaction(hexutil.Encode(serialized))
+		if err != nil {
+			t.Fatalf("type %d: %v", transaction.Type(), err)
+		}
+		if *decoded.Hash() != *transaction.Hash() || decoded.Type() != transaction.Type() {
+			t.Errorf("type %d: decoded transaction differs", transaction.Type())
+		}
+	}
+	for _, raw := range []string{"", "0x", "f86c", "0xzz", "0x7f01"} {
+		if _, err := tx.DecodeRawTransaction(raw); err == nil {
+			t.Errorf("decoded %q", raw)
+		}
+	}
+}
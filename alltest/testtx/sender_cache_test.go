@@ -0,0 +1,119 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestSender_CachedPerSigner(t *testing.T) {
+	transaction := mustSigned(t, mustKey())
+	signer := tx.NewTypedSigner(big.NewInt(1))
+	from, err := tx.Sender(signer, transaction)
+	if err != nil || from != keyAddress(mustKey()) {
+		t.Fatalf("sender %v %v", from, err)
+	}
+
+	// 解码进同一个交易后缓存作废，按新的内容重新恢复
+	other, _ := crypto.GenerateKey()
+	resigned := mustSigned(t, crypto.FromECDSA(other))
+	data, err := resigned.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	decoded := transaction.Copy()
+	tx.Sender(signer, decoded)
+	if err := rlp.DecodeBytes(data, decoded); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if recovered, err := tx.Sender(signer, decoded); err != nil || recovered != keyAddress(crypto.FromECDSA(other)) {
+		t.Errorf("sender after decoding %v %v", recovered, err)
+	}
+	// 别的链的签名方案不能用这个缓存
+	if _, err := tx.Sender(tx.NewTypedSigner(big.NewInt(2)), transaction); !errors.Is(err, tx.ErrInvalidChainID) {
+		t.Errorf("signer of another chain: %v", err)
+	}
+
+	// 重新签名后缓存作废
+	if err := transaction.Sign(crypto.FromECDSA(other)); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if resigned, err := tx.Sender(signer, transaction); err != nil || resigned != keyAddress(crypto.FromECDSA(other)) {
+		t.Errorf("sender after re-signing %v %v", resigned, err)
+	}
+}
+
+// countingSigner 记录恢复签名的次数
+type countingSigner struct {
+	tx.Signer
+	calls *int32
+}
+
+func (s countingSigner) Sender(transaction *tx.Transaction) (common.Address, error) {
+	atomic.AddInt32(s.calls, 1)
+	return s.Signer.Sender(transaction)
+}
+
+func (s countingSigner) Equal(other tx.Signer) bool {
+	counting, ok := other.(countingSigner)
+	return ok && s.Signer.Equal(counting.Signer)
+}
+
+func TestCacheSenders(t *testing.T) {
+	signer := countingSigner{Signer: tx.NewTypedSigner(big.NewInt(1)), calls: new(int32)}
+	txs := make([]*tx.Transaction, 64)
+	want := make([]common.Address, len(txs))
+	for i := range txs {
+		key, _ := crypto.GenerateKey()
+		txs[i] = tx.NewTransaction(uint64(i), common.Address{1}, big.NewInt(1), tx.TxGas, big.NewInt(1), nil, big.NewInt(1))
+		if i%2 == 1 {
+			txs[i] = tx.NewDynamicFeeTransaction(uint64(i), common.Address{1}, big.NewInt(1), tx.TxGas, big.NewInt(1), big.NewInt(2), nil, big.NewInt(1))
+		}
+		if err := txs[i].Sign(crypto.FromECDSA(key)); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		want[i] = keyAddress(crypto.FromECDSA(key))
+	}
+	// 签名无效的交易留给之后的校验报错
+	invalid := tx.NewTransaction(0, common.Address{1}, big.NewInt(1), tx.TxGas, big.NewInt(1), nil, big.NewInt(1))
+	tx.CacheSenders(signer, append(txs, invalid))
+	if calls := atomic.LoadInt32(signer.calls); calls != int32(len(txs)+1) {
+		t.Fatalf("recovered %d signatures, want %d", calls, len(txs)+1)
+	}
+
+	// 之后都用缓存，不再恢复签名
+	for i, transaction := range txs {
+		if from, err := tx.Sender(signer, transaction); err != nil || from != want[i] {
+			t.Errorf("tx %d: sender %v %v", i, from, err)
+		}
+	}
+	if calls := atomic.LoadInt32(signer.calls); calls != int32(len(txs)+1) {
+		t.Errorf("cached senders recovered again: %d recoveries", calls)
+	}
+	if _, err := tx.Sender(signer, invalid); err == nil {
+		t.Error("unsigned transaction got a sender")
+	}
+
+	// 签名后的交易视为不可变，直接改字段不会重新恢复，改完要重新签名
+	txs[0].Value = big.NewInt(2)
+	before := atomic.LoadInt32(signer.calls)
+	if from, err := tx.Sender(signer, txs[0]); err != nil || from != want[0] || atomic.LoadInt32(signer.calls) != before {
+		t.Errorf("cached sender not reused: %v %v", from, err)
+	}
+	key, _ := crypto.GenerateKey()
+	if err := tx.SignTx(txs[0], signer, crypto.FromECDSA(key)); err != nil {
+		t.Fatalf("SignTx failed: %v", err)
+	}
+	if from, err := tx.Sender(signer, txs[0]); err != nil || from != keyAddress(crypto.FromECDSA(key)) {
+		t.Errorf("sender after re-signing %v %v", from, err)
+	}
+	if atomic.LoadInt32(signer.calls) != before+1 {
+		t.Error("re-signed transaction not recovered again")
+	}
+}
@@ -0,0 +1,160 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EIP-155 规范里的示例交易
+func eip155Example() (*tx.Transaction, []byte) {
+	to := common.Address{}.NewAddress([]byte(strings.Repeat("\x35", 20)))
+	value, _ := new(big.Int).SetString("1000000000000000000", 10)
+	transaction := tx.NewTransaction(9, to, value, 21000, big.NewInt(20000000000), nil, big.NewInt(1))
+	key, _ := hex.DecodeString(strings.Repeat("46", 32))
+	return transaction, key
+}
+
+func keyAddress(key []byte) common.Address {
+	privateKey, _ := crypto.ToECDSA(key)
+	return common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&privateKey.PublicKey))
+}
+
+func TestEIP155Signer_GoldenVector(t *testing.T) {
+	transaction, key := eip155Example()
+	signer := tx.NewEIP155Signer(big.NewInt(1))
+
+	// 未签名的编码就是签名内容 [.., chainId, 0, 0]
+	unsigned, _ := transaction.Serialize()
+	if got := hex.EncodeToString(unsigned); got != "ec098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a764000080018080" {
+		t.Errorf("signing payload %s", got)
+	}
+	if got := signer.Hash(transaction).String(); got != "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Errorf("signing hash %s", got)
+	}
+
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if transaction.V.Uint64() != 37 ||
+		transaction.R.String() != "18515461264373351373200002665853028612451056578545711640558177340181847433846" ||
+		transaction.S.String() != "46948507304638947509940763649030358759909902576025900602547168820602576006531" {
+		t.Errorf("signature values v=%v r=%v s=%v", transaction.V, transaction.R, transaction.S)
+	}
+	signed, _ := transaction.Serialize()
+	const want = "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if got := hex.EncodeToString(signed); got != want {
+		t.Fatalf("signed encoding\n got %s\nwant %s", got, want)
+	}
+
+	// 解码后链ID从 v 还原，再编码逐字节一致，发送者不变
+	raw, _ := hex.DecodeString(want)
+	decoded, err := tx.Deserialize(raw)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if decoded.ChainID.Cmp(big.NewInt(1)) != 0 || decoded.V.Uint64() != 37 {
+		t.Errorf("decoded chain id %v, v %v", decoded.ChainID, decoded.V)
+	}
+	if again, _ := decoded.Serialize(); hex.EncodeToString(again) != want {
+		t.Error("re-encoding differs")
+	}
+	sender, err := tx.Sender(signer, decoded)
+	if err != nil || sender != keyAddress(key) {
+		t.Errorf("sender %v, %v", sender, err)
+	}
+	if hash, _ := decoded.GetHash(); hash != *transaction.Hash() {
+		t.Error("decoded transaction hash differs")
+	}
+}
+
+func TestEIP155Signer_RejectsOtherChains(t *testing.T) {
+	transaction, key := eip155Example()
+	transaction.ChainID = big.NewInt(2)
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if transaction.V.Uint64() != 39 && transaction.V.Uint64() != 40 {
+		t.Errorf("v = %d for chain 2", transaction.V.Uint64())
+	}
+	if _, err := tx.Sender(tx.NewEIP155Signer(big.NewInt(1)), transaction); !errors.Is(err, tx.ErrInvalidChainID) {
+		t.Errorf("chain 1 signer: %v", err)
+	}
+	if sender, err := tx.Sender(tx.NewEIP155Signer(big.NewInt(2)), transaction); err != nil || sender != keyAddress(key) {
+		t.Errorf("chain 2 signer: %v %v", sender, err)
+	}
+	// 只改 v 里的链ID，签名就对不上原来的发送者
+	transaction.V.Sub(transaction.V, big.NewInt(2))
+	transaction.ChainID = big.NewInt(1)
+	if sender, err := tx.Sender(tx.NewEIP155Signer(big.NewInt(1)), transaction); err == nil && sender == keyAddress(key) {
+		t.Error("signature replayed on another chain")
+	}
+
+	// 交易池和虚拟机只接受本链的交易
+	transaction, key = eip155Example()
+	transaction.ChainID = big.NewInt(2)
+	transaction.Sign(key)
+	dbDir := "test_db_signer"
+	os.RemoveAll(dbDir)
+	defer os.RemoveAll(dbDir)
+	db, err := mpt.NewDB(dbDir)
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	defer db.Close()
+	state := mpt.NewMPT(db)
+	if err := tx.NewTxPool(state).NewTX(transaction); !errors.Is(err, tx.ErrInvalidChainID) {
+		t.Errorf("pool accepted a transaction of another chain: %v", err)
+	}
+	if err := vm.NewVM(state).ExecuteTransaction(transaction); !errors.Is(err, tx.ErrInvalidChainID) {
+		t.Errorf("vm executed a transaction of another chain: %v", err)
+	}
+}
+
+func TestHomesteadSigner(t *testing.T) {
+	transaction, key := eip155Example()
+	transaction.ChainID = nil
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if v := transaction.V.Uint64(); v != 27 && v != 28 {
+		t.Fatalf("homestead v = %d", v)
+	}
+	if transaction.Protected() {
+		t.Error("homestead signature reported as protected")
+	}
+	// EIP-155 签名器仍接受没有链ID的旧签名
+	for _, signer := range []tx.Signer{tx.HomesteadSigner{}, tx.NewEIP155Signer(big.NewInt(1))} {
+		if sender, err := tx.Sender(signer, transaction); err != nil || sender != keyAddress(key) {
+			t.Errorf("%T: %v %v", signer, sender, err)
+		}
+	}
+	data, _ := transaction.Serialize()
+	decoded, err := tx.Deserialize(data)
+	if err != nil || decoded.ChainID != nil {
+		t.Fatalf("decoded chain id %v, %v", decoded.ChainID, err)
+	}
+	if sender, err := decoded.GetSender(); err != nil || sender != keyAddress(key) {
+		t.Errorf("decoded sender %v %v", sender, err)
+	}
+	if _, err := tx.Sender(tx.HomesteadSigner{}, mustSigned(t, key)); !errors.Is(err, tx.ErrInvalidSig) {
+		t.Errorf("homestead signer accepted an EIP-155 signature: %v", err)
+	}
+}
+
+func mustSigned(t *testing.T, key []byte) *tx.Transaction {
+	transaction, _ := eip155Example()
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return transaction
+}
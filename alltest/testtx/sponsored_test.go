@@ -0,0 +1,54 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSponsoredTx_Signatures(t *testing.T) {
+	keys, _ := ownerKeys(1)
+	payerKey := keys[0]
+	transaction := tx.NewSponsoredTransaction(2, common.Address{8}, big.NewInt(5), 30000, big.NewInt(3), []byte{1}, keyAddress(payerKey), big.NewInt(1))
+	if err := transaction.Sign(mustKey()); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := transaction.SignFeePayer(payerKey); err != nil {
+		t.Fatalf("SignFeePayer failed: %v", err)
+	}
+	signer := tx.NewTypedSigner(big.NewInt(1))
+	if sender, err := tx.Sender(signer, transaction); err != nil || sender != keyAddress(mustKey()) {
+		t.Errorf("sender %v %v", sender, err)
+	}
+	if payer, err := tx.FeePayer(signer, transaction); err != nil || payer != keyAddress(payerKey) {
+		t.Errorf("fee payer %v %v", payer, err)
+	}
+	// 其他交易的代付方就是发送者
+	plain := tx.NewTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, big.NewInt(1))
+	plain.Sign(mustKey())
+	if payer, err := tx.FeePayer(signer, plain); err != nil || payer != keyAddress(mustKey()) {
+		t.Errorf("plain fee payer %v %v", payer, err)
+	}
+
+	// 发送者重新签名后代付签名失效，别人的签名也不算
+	forged := transaction.Copy()
+	otherKey, _ := crypto.GenerateKey()
+	forged.SignFeePayer(crypto.FromECDSA(otherKey))
+	if _, err := tx.FeePayer(signer, forged); !errors.Is(err, tx.ErrInvalidFeePayer) {
+		t.Errorf("wrong payer: %v", err)
+	}
+	transaction.GasPrice = big.NewInt(4)
+	transaction.Sign(mustKey())
+	if _, err := tx.FeePayer(signer, transaction); !errors.Is(err, tx.ErrInvalidFeePayer) {
+		t.Errorf("re-signed by sender: %v", err)
+	}
+	unsigned := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, keyAddress(payerKey), big.NewInt(1))
+	unsigned.Sign(mustKey())
+	if _, err := tx.FeePayer(signer, unsigned); !errors.Is(err, tx.ErrInvalidFeePayer) {
+		t.Errorf("missing payer signature: %v", err)
+	}
+}
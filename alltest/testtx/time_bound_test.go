@@ -0,0 +1,34 @@
+package testtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestTimeBoundTx_CheckValidity(t *testing.T) {
+	// 高度界限和时间戳界限按 LockTimeThreshold 区分，两端都包含
+	byHeight := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 10, 20, big.NewInt(1))
+	byTime := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 0, 1700000000, big.NewInt(1))
+	plain := tx.NewTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, big.NewInt(1))
+	tests := []struct {
+		transaction       *tx.Transaction
+		height, timestamp uint64
+		want              error
+	}{
+		{byHeight, 9, 1800000000, tx.ErrTxNotYetValid},
+		{byHeight, 10, 0, nil},
+		{byHeight, 20, 0, nil},
+		{byHeight, 21, 0, tx.ErrTxExpired},
+		{byTime, 1000000, 1700000000, nil},
+		{byTime, 0, 1700000001, tx.ErrTxExpired},
+		{plain, 0, 0, nil},
+	}
+	for i, test := range tests {
+		if err := test.transaction.CheckValidity(test.height, test.timestamp); !errors.Is(err, test.want) {
+			t.Errorf("case %d: got %v, want %v", i, err, test.want)
+		}
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"blockchain/tx"
 	"blockchain/vm"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // 固定测试私钥
@@ -111,7 +114,7 @@ func TestTxPool_NewTX_and_Execute(t *testing.T) {
 		1,              // nonce
 		receiver,       // to
 		big.NewInt(50), // value
-		1000,           // gasLimit
+		100000,         // gasLimit
 		big.NewInt(1),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -157,7 +160,7 @@ func TestTxPool_NewTX_and_Execute(t *testing.T) {
 	}
 	t.Logf("[DEBUG] 接收者账户获取成功 - balance: %d, nonce: %d", receiverAccount.Balance, receiverAccount.Nonce)
 
-	gasCost := uint64(tx1.GasLimit) * tx1.GasPrice.Uint64()
+	gasCost := tx1.IntrinsicGas() * tx1.GasPrice.Uint64()
 	expectedSenderBalance := uint64(1000000) - (uint64(50) + gasCost)
 	expectedReceiverBalance := uint64(50)
 
@@ -188,7 +191,7 @@ func TestTxPool_NewTX_and_Execute(t *testing.T) {
 		2,              // nonce
 		receiver,       // to
 		big.NewInt(30), // value
-		800,            // gasLimit
+		80000,          // gasLimit
 		big.NewInt(1),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -216,7 +219,7 @@ func TestTxPool_NewTX_and_Execute(t *testing.T) {
 		3,              // nonce
 		receiver,       // to
 		big.NewInt(20), // value
-		600,            // gasLimit
+		60000,          // gasLimit
 		big.NewInt(1),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -257,9 +260,9 @@ func TestTxPool_NewTX_and_Execute(t *testing.T) {
 	}
 
 	// 计算所有交易的gas费用
-	gasCost1 := uint64(tx1.GasLimit) * tx1.GasPrice.Uint64()
-	gasCost2 := uint64(tx2.GasLimit) * tx2.GasPrice.Uint64()
-	gasCost3 := uint64(tx3.GasLimit) * tx3.GasPrice.Uint64()
+	gasCost1 := tx1.IntrinsicGas() * tx1.GasPrice.Uint64()
+	gasCost2 := tx2.IntrinsicGas() * tx2.GasPrice.Uint64()
+	gasCost3 := tx3.IntrinsicGas() * tx3.GasPrice.Uint64()
 	totalGasCost := gasCost1 + gasCost2 + gasCost3
 
 	// 计算转账总额
@@ -314,7 +317,7 @@ func TestTxPool_GasPriceCompetition(t *testing.T) {
 		1,              // nonce
 		receiver,       // to
 		big.NewInt(50), // value
-		1000,           // gasLimit
+		100000,         // gasLimit
 		big.NewInt(1),  // gasPrice (低)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -332,7 +335,7 @@ func TestTxPool_GasPriceCompetition(t *testing.T) {
 		1,              // nonce (相同)
 		receiver,       // to
 		big.NewInt(50), // value
-		1000,           // gasLimit
+		100000,         // gasLimit
 		big.NewInt(5),  // gasPrice (高)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -377,7 +380,7 @@ func TestTxPool_GasPriceCompetition(t *testing.T) {
 	}
 
 	// 应该只有高gas交易被执行
-	gasCost := uint64(txHighGas.GasLimit) * txHighGas.GasPrice.Uint64()
+	gasCost := txHighGas.IntrinsicGas() * txHighGas.GasPrice.Uint64()
 	expectedSenderBalance := uint64(1000000) - (uint64(50) + gasCost)
 	expectedReceiverBalance := uint64(50)
 
@@ -427,7 +430,7 @@ func TestTxPool_NonceReplacement(t *testing.T) {
 		1,              // nonce
 		receiver,       // to
 		big.NewInt(30), // value
-		1000,           // gasLimit
+		100000,         // gasLimit
 		big.NewInt(2),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -445,7 +448,7 @@ func TestTxPool_NonceReplacement(t *testing.T) {
 		1,              // nonce (相同)
 		receiver,       // to
 		big.NewInt(40), // value (不同)
-		1000,           // gasLimit (不同)
+		100000,         // gasLimit (不同)
 		big.NewInt(3),  // gasPrice (更高)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -490,7 +493,7 @@ func TestTxPool_NonceReplacement(t *testing.T) {
 	}
 
 	// 应该只有第二笔交易被执行
-	gasCost := uint64(tx2.GasLimit) * tx2.GasPrice.Uint64()
+	gasCost := tx2.IntrinsicGas() * tx2.GasPrice.Uint64()
 	expectedSenderBalance := uint64(1000000) - (uint64(40) + gasCost)
 	expectedReceiverBalance := uint64(40)
 
@@ -550,7 +553,7 @@ func TestTxPool_MultipleTransactionsByGasPrice(t *testing.T) {
 		1,              // nonce
 		receiver1,      // to
 		big.NewInt(10), // value
-		500,            // gasLimit
+		50000,          // gasLimit
 		big.NewInt(1),  // gasPrice (低)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -561,7 +564,7 @@ func TestTxPool_MultipleTransactionsByGasPrice(t *testing.T) {
 		2,              // nonce
 		receiver2,      // to
 		big.NewInt(20), // value
-		600,            // gasLimit
+		60000,          // gasLimit
 		big.NewInt(3),  // gasPrice (中等)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -572,7 +575,7 @@ func TestTxPool_MultipleTransactionsByGasPrice(t *testing.T) {
 		3,              // nonce
 		receiver3,      // to
 		big.NewInt(30), // value
-		700,            // gasLimit
+		70000,          // gasLimit
 		big.NewInt(5),  // gasPrice (高)
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -639,7 +642,7 @@ func TestTxPool_MultipleTransactionsByGasPrice(t *testing.T) {
 	}
 
 	// 计算总费用
-	totalGasCost := uint64(500)*1 + uint64(600)*3 + uint64(700)*5
+	totalGasCost := tx.TxGas * (1 + 3 + 5) // 按实际消耗的固有gas收费
 	totalTransfer := uint64(10) + uint64(20) + uint64(30)
 	expectedSenderBalance := uint64(1000000) - totalTransfer - totalGasCost
 
@@ -713,7 +716,7 @@ func TestTxPool_NonceOutOfOrder(t *testing.T) {
 		3,              // nonce
 		receiver3,      // to
 		big.NewInt(30), // value
-		700,            // gasLimit
+		70000,          // gasLimit
 		big.NewInt(2),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -724,7 +727,7 @@ func TestTxPool_NonceOutOfOrder(t *testing.T) {
 		1,              // nonce
 		receiver1,      // to
 		big.NewInt(10), // value
-		500,            // gasLimit
+		50000,          // gasLimit
 		big.NewInt(1),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -735,7 +738,7 @@ func TestTxPool_NonceOutOfOrder(t *testing.T) {
 		4,              // nonce
 		receiver4,      // to
 		big.NewInt(40), // value
-		800,            // gasLimit
+		80000,          // gasLimit
 		big.NewInt(3),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -746,7 +749,7 @@ func TestTxPool_NonceOutOfOrder(t *testing.T) {
 		2,              // nonce
 		receiver2,      // to
 		big.NewInt(20), // value
-		600,            // gasLimit
+		60000,          // gasLimit
 		big.NewInt(2),  // gasPrice
 		[]byte{},       // data
 		big.NewInt(1),  // chainID
@@ -831,7 +834,7 @@ func TestTxPool_NonceOutOfOrder(t *testing.T) {
 	}
 
 	// 计算总费用
-	totalGasCost := uint64(500)*1 + uint64(600)*2 + uint64(700)*2 + uint64(800)*3
+	totalGasCost := tx.TxGas * (1 + 2 + 2 + 3) // 按实际消耗的固有gas收费
 	totalTransfer := uint64(10) + uint64(20) + uint64(30) + uint64(40)
 	expectedSenderBalance := uint64(1000000) - totalTransfer - totalGasCost
 
@@ -897,7 +900,7 @@ func TestTxPool_InsufficientBalance(t *testing.T) {
 		1,                   // nonce
 		receiver,            // to
 		big.NewInt(2000000), // value (超过初始余额1000000)
-		1000,                // gasLimit
+		100000,              // gasLimit
 		big.NewInt(1),       // gasPrice
 		[]byte{},            // data
 		big.NewInt(1),       // chainID
@@ -964,3 +967,305 @@ func TestTxPool_InsufficientBalance(t *testing.T) {
 func cleanupTestDB(dbDir string) {
 	os.RemoveAll(dbDir)
 }
+
+func TestTxPool_NewTXsBatch(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_batch")
+	pool, _, senderAddr, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_batch")
+	events := make(chan tx.NewTxsEvent, 1)
+	sub := pool.SubscribeNewTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	receiver := common.Address{8}
+	txs := make([]*tx.Transaction, 4)
+	for i := range txs {
+		txs[i] = tx.NewTransaction(uint64(i+1), receiver, big.NewInt(1), 30000, big.NewInt(1), nil, big.NewInt(1))
+		if i != 2 {
+			if err := txs[i].Sign(privateKeyBytes); err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+		}
+	}
+
+	// 未签名的第三笔被拒绝，第四笔nonce接不上进入queue，错误和交易一一对应
+	errs := pool.NewTXs(txs)
+	for i, err := range errs {
+		if (err != nil) != (i == 2) {
+			t.Errorf("tx %d: %v", i, err)
+		}
+	}
+	select {
+	case ev := <-events:
+		if len(ev.Txs) != 3 {
+			t.Errorf("event carries %d transactions, want 3", len(ev.Txs))
+		}
+	default:
+		t.Error("no event for the batch")
+	}
+	for i := 0; i < 2; i++ {
+		popped := pool.Pop()
+		if popped == nil || popped.Nonce != uint64(i+1) {
+			t.Fatalf("pop %d: %v", i, popped)
+		}
+		if from, err := tx.Sender(tx.LatestSignerForChainID(tx.DefaultChainID), popped); err != nil || from != senderAddr {
+			t.Errorf("sender %v %v", from, err)
+		}
+	}
+}
+
+func TestTxPool_MultisigAdmission(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_multisig")
+	pool, vma, treasury, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_multisig")
+	keys := make([][]byte, 2)
+	owners := make([]common.Address, 2)
+	for i := range keys {
+		ownerKey, _ := crypto.GenerateKey()
+		keys[i] = crypto.FromECDSA(ownerKey)
+		owners[i] = common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&ownerKey.PublicKey))
+	}
+	convert := tx.NewTransaction(1, treasury, big.NewInt(0), 100000, big.NewInt(1), tx.EncodeOwnerUpdate(owners, 2), big.NewInt(1))
+	convert.Sign(privateKeyBytes)
+	if err := vma.VM.ExecuteTransaction(convert); err != nil {
+		t.Fatalf("convert to multisig: %v", err)
+	}
+
+	// 池子按账户状态检查多签：单签和签名不够的都拒绝
+	single := tx.NewTransaction(2, common.Address{8}, big.NewInt(1), 30000, big.NewInt(1), nil, big.NewInt(1))
+	single.Sign(privateKeyBytes)
+	if err := pool.NewTX(single); !errors.Is(err, tx.ErrMultisigRequired) {
+		t.Errorf("single signature: %v", err)
+	}
+	transaction := tx.NewMultisigTransaction(treasury, 2, common.Address{8}, big.NewInt(1), 100000, big.NewInt(1), nil, big.NewInt(1))
+	transaction.Sign(keys[0])
+	if err := pool.NewTX(transaction); !errors.Is(err, tx.ErrNotEnoughSignatures) {
+		t.Errorf("one of two signatures: %v", err)
+	}
+	transaction.Sign(keys[1])
+	if err := pool.NewTX(transaction); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	if popped := pool.Pop(); popped == nil || *popped.Hash() != *transaction.Hash() {
+		t.Fatal("multisig transaction not pending")
+	}
+	if err := vma.VM.ExecuteTransaction(transaction); err != nil {
+		t.Errorf("ExecuteTransaction failed: %v", err)
+	}
+}
+
+func TestTxPool_SponsoredAdmission(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_sponsored")
+	pool, vma, treasury, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_sponsored")
+	userKey, _ := crypto.GenerateKey()
+	user := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&userKey.PublicKey))
+	if err := vma.VM.SetAccount(user, &common.Account{}); err != nil {
+		t.Fatalf("SetAccount failed: %v", err)
+	}
+	if err := vma.VM.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// 池子检查代付签名，并按代付方的余额判断付不付得起gas费
+	transaction := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(0), 30000, big.NewInt(1), nil, treasury, big.NewInt(1))
+	transaction.Sign(crypto.FromECDSA(userKey))
+	if err := pool.NewTX(transaction); !errors.Is(err, tx.ErrInvalidFeePayer) {
+		t.Errorf("without payer signature: %v", err)
+	}
+	expensive := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(0), 2000000, big.NewInt(1), nil, treasury, big.NewInt(1))
+	expensive.Sign(crypto.FromECDSA(userKey))
+	expensive.SignFeePayer(privateKeyBytes)
+	if err := pool.NewTX(expensive); !errors.Is(err, tx.ErrInsufficientPayerFunds) {
+		t.Errorf("payer cannot afford gas: %v", err)
+	}
+	transaction.SignFeePayer(privateKeyBytes)
+	if err := pool.NewTX(transaction); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	if err := pool.Execute(vma, 1); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if account, _ := vma.VM.GetAccount(user); account.Nonce != 1 || account.Balance != 0 {
+		t.Errorf("user balance %d nonce %d", account.Balance, account.Nonce)
+	}
+}
+
+func TestTxPool_SponsoredMultisigPayer(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_sponsored_multisig")
+	pool, vma, _, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_sponsored_multisig")
+	payerKey, _ := crypto.GenerateKey()
+	payer := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&payerKey.PublicKey))
+	multisig := &common.Account{Balance: 1000000, Owners: []common.Address{payer, {5}}, Threshold: 2}
+	if err := vma.VM.SetAccount(payer, multisig); err != nil {
+		t.Fatalf("SetAccount failed: %v", err)
+	}
+	if err := vma.VM.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// 代付方是多签账户时池子直接拒绝，不等到执行才失败
+	transaction := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(0), 30000, big.NewInt(1), nil, payer, big.NewInt(1))
+	transaction.Sign(privateKeyBytes)
+	transaction.SignFeePayer(crypto.FromECDSA(payerKey))
+	if err := pool.NewTX(transaction); !errors.Is(err, tx.ErrMultisigFeePayer) {
+		t.Errorf("multisig payer admitted: %v", err)
+	}
+	if pool.Pop() != nil {
+		t.Error("rejected transaction left in the pool")
+	}
+}
+
+func TestTxPool_TimeBoundQueue(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_time_bound")
+	pool, vma, _, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_time_bound")
+	pool.SetHead(5, 0)
+
+	// 过期的交易直接拒绝
+	expired := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 0, 5, big.NewInt(1))
+	expired.Sign(privateKeyBytes)
+	if err := pool.NewTX(expired); !errors.Is(err, tx.ErrTxExpired) {
+		t.Errorf("expired transaction: %v", err)
+	}
+
+	// 第10块才生效的交易留在queue里，后面nonce的交易也要等它
+	scheduled := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 10, 0, big.NewInt(1))
+	scheduled.Sign(privateKeyBytes)
+	next := tx.NewTransaction(2, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, big.NewInt(1))
+	next.Sign(privateKeyBytes)
+	// 第8块之后就过期的交易
+	expiring := tx.NewTimeBoundTransaction(3, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 0, 8, big.NewInt(1))
+	expiring.Sign(privateKeyBytes)
+	for _, transaction := range []*tx.Transaction{scheduled, next, expiring} {
+		if err := pool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+	if popped := pool.Pop(); popped != nil {
+		t.Fatalf("popped nonce %d before it is valid", popped.Nonce)
+	}
+
+	// 新链头上过期的交易被清出去，生效的交易进入pending
+	pool.SetHead(9, 0)
+	if err := pool.GetRejected(*expiring.Hash()); !errors.Is(err, tx.ErrTxExpired) {
+		t.Errorf("expiring transaction: %v", err)
+	}
+	for _, want := range []*tx.Transaction{scheduled, next} {
+		popped := pool.Pop()
+		if popped == nil || *popped.Hash() != *want.Hash() {
+			t.Fatalf("want nonce %d popped", want.Nonce)
+		}
+		vma.VM.SetBlock(10, 0)
+		if err := vma.VM.ExecuteTransaction(popped); err != nil {
+			t.Fatalf("ExecuteTransaction failed: %v", err)
+		}
+	}
+	if popped := pool.Pop(); popped != nil {
+		t.Errorf("expired nonce %d still pending", popped.Nonce)
+	}
+}
+
+func TestTxPool_TimeBoundExpiresInPending(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_time_bound_pending")
+	pool, _, _, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_time_bound_pending")
+	pool.SetHead(5, 0)
+
+	expiring := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, 0, 7, big.NewInt(1))
+	expiring.Sign(privateKeyBytes)
+	next := tx.NewTransaction(2, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, big.NewInt(1))
+	next.Sign(privateKeyBytes)
+	for _, transaction := range []*tx.Transaction{expiring, next} {
+		if err := pool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+
+	// pending 里的交易过期后被丢弃，后面的交易nonce接不上，退回queue
+	pool.SetHead(7, 0)
+	if err := pool.GetRejected(*expiring.Hash()); !errors.Is(err, tx.ErrTxExpired) {
+		t.Errorf("expiring transaction: %v", err)
+	}
+	if popped := pool.Pop(); popped != nil {
+		t.Fatalf("popped nonce %d after a gap", popped.Nonce)
+	}
+	if err := pool.GetRejected(*next.Hash()); err != nil {
+		t.Errorf("queued transaction rejected: %v", err)
+	}
+
+	// 补上nonce之后排在后面的交易重新进入pending
+	refill := tx.NewTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(1), nil, big.NewInt(1))
+	refill.Sign(privateKeyBytes)
+	if err := pool.NewTX(refill); err != nil {
+		t.Fatalf("NewTX failed: %v", err)
+	}
+	for _, want := range []*tx.Transaction{refill, next} {
+		if popped := pool.Pop(); popped == nil || *popped.Hash() != *want.Hash() {
+			t.Fatalf("want nonce %d popped", want.Nonce)
+		}
+	}
+}
+
+func TestTxPool_TipAboveFeeCap(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_tip_cap")
+	pool, _, _, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_tip_cap")
+	pool.SetBaseFee(big.NewInt(1))
+
+	dynamic := tx.NewDynamicFeeTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(5), big.NewInt(3), nil, big.NewInt(1))
+	dynamic.Sign(privateKeyBytes)
+	if err := pool.NewTX(dynamic); !errors.Is(err, tx.ErrTipAboveFeeCap) {
+		t.Errorf("tip above fee cap: %v", err)
+	}
+	if popped := pool.Pop(); popped != nil {
+		t.Errorf("popped nonce %d with its tip above the fee cap", popped.Nonce)
+	}
+}
+
+// 出池顺序按当前 baseFee 下的实际小费，baseFee 变了顺序跟着变
+func TestTxPool_PopByEffectiveTip(t *testing.T) {
+	defer cleanupTestDB("test_db_txpool_effective_tip")
+	pool, vma, _, privateKeyBytes := setupTestEnvWithDB(t, "test_db_txpool_effective_tip")
+	otherKeyHex := "0000000000000000000000000000000000000000000000000000000000000002"
+	otherKey, _ := hex.DecodeString(otherKeyHex)
+	publicKey, err := common.PrivateKeyToPublicKey(otherKeyHex)
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+	hash := common.Hash{}.NewHash(publicKey)
+	if err := vma.VM.Mint(common.Address{}.NewAddress(hash[:20])); err != nil {
+		t.Fatalf("Failed to mint tokens: %v", err)
+	}
+
+	pool.SetBaseFee(big.NewInt(1))
+	legacy := tx.NewTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(10), nil, big.NewInt(1))
+	legacy.Sign(privateKeyBytes)
+	dynamic := tx.NewDynamicFeeTransaction(1, common.Address{8}, big.NewInt(1), 21000, big.NewInt(4), big.NewInt(20), nil, big.NewInt(1))
+	dynamic.Sign(otherKey)
+	for _, transaction := range []*tx.Transaction{legacy, dynamic} {
+		if err := pool.NewTX(transaction); err != nil {
+			t.Fatalf("NewTX failed: %v", err)
+		}
+	}
+
+	// baseFee 为 12 时 legacy 交易付不起，只有动态手续费交易（小费4）出池
+	pool.SetBaseFee(big.NewInt(12))
+	if popped := pool.Pop(); popped == nil || *popped.Hash() != *dynamic.Hash() {
+		t.Fatal("want the dynamic fee transaction popped")
+	}
+	if popped := pool.Pop(); popped != nil {
+		t.Fatalf("popped nonce %d below the base fee", popped.Nonce)
+	}
+	pool.Restore([]*tx.Transaction{dynamic})
+
+	// baseFee 为 8 时 legacy 的小费是 2，排在小费 4 的动态手续费交易后面
+	pool.SetBaseFee(big.NewInt(8))
+	for _, want := range []*tx.Transaction{dynamic, legacy} {
+		if popped := pool.Pop(); popped == nil || *popped.Hash() != *want.Hash() {
+			t.Fatalf("want type %d popped", want.Type())
+		}
+	}
+
+	// baseFee 为 1 时 legacy 的小费是 9，先出池
+	pool.Restore([]*tx.Transaction{legacy, dynamic})
+	pool.SetBaseFee(big.NewInt(1))
+	for _, want := range []*tx.Transaction{legacy, dynamic} {
+		if popped := pool.Pop(); popped == nil || *popped.Hash() != *want.Hash() {
+			t.Fatalf("want type %d popped", want.Type())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package testvmtx
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestVM(t *testing.T, dbDir string) (*vm.VM, common.Address, []byte) {
+	os.RemoveAll(dbDir)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		t.Fatalf("Failed to create DB directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
+	db, err := mpt.NewDB(filepath.Join(dbDir, "MPT"))
+	if err != nil {
+		t.Fatalf("Failed to create DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	virtualMachine := vm.NewVM(mpt.NewMPT(db))
+
+	key, _ := hex.DecodeString(testPrivateKeyHex)
+	publicKey, _ := common.PrivateKeyToPublicKey(testPrivateKeyHex)
+	hash := common.Hash{}.NewHash(publicKey)
+	sender := common.Address{}.NewAddress(hash[:20])
+	if err := virtualMachine.Mint(sender); err != nil {
+		t.Fatalf("Failed to mint tokens: %v", err)
+	}
+	return virtualMachine, sender, key
+}
+
+func TestVM_AccessListWarmCold(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_access_list")
+	coinbase, receiver, declared := common.Address{7}, common.Address{8}, common.Address{9}
+	virtualMachine.SetCoinbase(coinbase)
+	contract := &common.Account{Storage: map[string]string{hex.EncodeToString(common.Hash{1}.Bytes()): "2a"}}
+	if err := virtualMachine.SetAccount(declared, contract); err != nil {
+		t.Fatalf("SetAccount failed: %v", err)
+	}
+
+	accessList := tx.AccessList{{Address: declared, StorageKeys: []common.Hash{{1}}}}
+	transaction := tx.NewAccessListTransaction(1, receiver, big.NewInt(50), 30000, big.NewInt(1), nil, accessList, big.NewInt(1))
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(transaction); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	// 声明访问列表的费用算在固有gas里
+	receipts := virtualMachine.GetReceipts()
+	gasUsed := tx.TxGas + tx.TxAccessListAddressGas + tx.TxAccessListStorageKeyGas
+	if receipt := receipts[len(receipts)-1]; receipt.GasUsed != gasUsed || receipt.Type != tx.AccessListTxType {
+		t.Errorf("receipt gas used %d, type %d", receipt.GasUsed, receipt.Type)
+	}
+	if account, _ := virtualMachine.GetAccount(sender); account.Balance != 1000000-50-gasUsed {
+		t.Errorf("sender balance %d, want %d", account.Balance, 1000000-50-gasUsed)
+	}
+
+	// 交易访问过的账户和声明的账户是热的
+	for _, addr := range []common.Address{sender, receiver, coinbase, declared} {
+		if !virtualMachine.AddressInAccessList(addr) {
+			t.Errorf("%v not warm", addr)
+		}
+	}
+	if virtualMachine.AddressInAccessList(common.Address{10}) {
+		t.Error("undeclared account warm")
+	}
+
+	// vm 没有读存储的指令，声明的存储槽只多付固有gas，执行时不收也不省
+	withoutSlot := tx.NewAccessListTransaction(2, receiver, big.NewInt(50), 30000, big.NewInt(1), nil, tx.AccessList{{Address: declared}}, big.NewInt(1))
+	if err := withoutSlot.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(withoutSlot); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	receipts = virtualMachine.GetReceipts()
+	if slotGas := gasUsed - receipts[len(receipts)-1].GasUsed; slotGas != tx.TxAccessListStorageKeyGas {
+		t.Errorf("declared slot cost %d, want %d", slotGas, tx.TxAccessListStorageKeyGas)
+	}
+}
+
+func TestVM_CreateAccessList(t *testing.T) {
+	virtualMachine, sender, _ := newTestVM(t, "test_db_vm_create_access_list")
+	receiver := common.Address{8}
+
+	// 普通转账只访问发送者和接收者，不需要声明任何东西
+	msg := vm.CallMsg{From: sender, To: &receiver, Value: big.NewInt(1)}
+	accessList, gas, err := virtualMachine.CreateAccessList(msg)
+	if err != nil || len(accessList) != 0 || gas != tx.TxGas {
+		t.Errorf("transfer: %v %d %v", accessList, gas, err)
+	}
+
+	// 已经给出的列表保留下来，发送者和接收者本身不用声明，它们的存储槽仍然要声明
+	msg.AccessList = tx.AccessList{
+		{Address: receiver, StorageKeys: []common.Hash{{1}}},
+		{Address: sender},
+		{Address: common.Address{9}},
+	}
+	accessList, gas, err = virtualMachine.CreateAccessList(msg)
+	if err != nil {
+		t.Fatalf("CreateAccessList failed: %v", err)
+	}
+	if len(accessList) != 2 || accessList[0].Address != (common.Address{8}) || len(accessList[0].StorageKeys) != 1 || accessList[1].Address != (common.Address{9}) {
+		t.Errorf("access list %v", accessList)
+	}
+	if want := tx.TxGas + 2*tx.TxAccessListAddressGas + tx.TxAccessListStorageKeyGas; gas != want {
+		t.Errorf("gas %d, want %d", gas, want)
+	}
+	if account, _ := virtualMachine.GetAccount(receiver); account.Balance != 0 {
+		t.Error("CreateAccessList changed the state")
+	}
+}
+
+func TestVM_AccessGasChargedDuringExecution(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_access_gas")
+	target := common.Address{9}
+	calls := []tx.BatchCall{{To: target, Value: big.NewInt(1)}, {To: target, Value: big.NewInt(1)}}
+	execute := func(nonce uint64, accessList tx.AccessList) uint64 {
+		transaction := tx.NewBatchTransaction(nonce, calls, 100000, big.NewInt(1), big.NewInt(1))
+		transaction.Inner.(*tx.BatchTx).AccessList = accessList
+		if err := transaction.Sign(key); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		before, _ := virtualMachine.GetAccount(sender)
+		if err := virtualMachine.ExecuteTransaction(transaction); err != nil {
+			t.Fatalf("ExecuteTransaction failed: %v", err)
+		}
+		after, _ := virtualMachine.GetAccount(sender)
+		receipts := virtualMachine.GetReceipts()
+		if gasUsed := receipts[len(receipts)-1].GasUsed; before.Balance-after.Balance != gasUsed+2 {
+			t.Errorf("sender paid %d for %d gas", before.Balance-after.Balance, gasUsed)
+		}
+		return receipts[len(receipts)-1].GasUsed - transaction.IntrinsicGas()
+	}
+
+	// 没声明时第一次调用是冷访问，第二次是热的；声明过的两次都是热的，固有gas多付的比省下的少
+	if execGas := execute(1, nil); execGas != vm.ColdAccountAccessCost+vm.WarmStorageReadCost {
+		t.Errorf("undeclared target: execution gas %d", execGas)
+	}
+	if execGas := execute(2, tx.AccessList{{Address: target}}); execGas != 2*vm.WarmStorageReadCost {
+		t.Errorf("declared target: execution gas %d", execGas)
+	}
+	if tx.TxAccessListAddressGas+2*vm.WarmStorageReadCost >= vm.ColdAccountAccessCost+vm.WarmStorageReadCost {
+		t.Error("declaring the target does not pay off")
+	}
+
+	// 跟踪执行找出调用的目标，带上它后的gas就是实际执行的gas
+	accessList, gas, err := virtualMachine.CreateAccessList(vm.CallMsg{From: sender, Calls: calls})
+	if err != nil {
+		t.Fatalf("CreateAccessList failed: %v", err)
+	}
+	if len(accessList) != 1 || accessList[0].Address != target {
+		t.Fatalf("access list %v", accessList)
+	}
+	declared := tx.NewBatchTransaction(3, calls, 100000, big.NewInt(1), big.NewInt(1))
+	declared.Inner.(*tx.BatchTx).AccessList = accessList
+	if want := declared.IntrinsicGas() + 2*vm.WarmStorageReadCost; gas != want {
+		t.Errorf("gas %d, want %d", gas, want)
+	}
+}
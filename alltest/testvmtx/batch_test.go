@@ -0,0 +1,78 @@
+package testvmtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"blockchain/vm"
+	"math/big"
+	"testing"
+)
+
+func TestVM_BatchTransaction(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_batch")
+	balanceOf := func(addr common.Address) uint64 {
+		account, err := virtualMachine.GetAccount(addr)
+		if err != nil {
+			t.Fatalf("GetAccount failed: %v", err)
+		}
+		return account.Balance
+	}
+	execute := func(nonce uint64, calls []tx.BatchCall) (*tx.Transaction, *tx.Receipt) {
+		transaction := tx.NewBatchTransaction(nonce, calls, 100000, big.NewInt(1), big.NewInt(1))
+		if err := transaction.Sign(key); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		if err := virtualMachine.ExecuteTransaction(transaction); err != nil {
+			t.Fatalf("ExecuteTransaction failed: %v", err)
+		}
+		receipts := virtualMachine.GetReceipts()
+		return transaction, receipts[len(receipts)-1]
+	}
+
+	// 一个签名、一个nonce完成三笔转账；目标账户第一次访问是冷的，再次访问是热的
+	before := balanceOf(sender)
+	transaction, receipt := execute(1, []tx.BatchCall{
+		{To: common.Address{1}, Value: big.NewInt(10)},
+		{To: common.Address{2}, Value: big.NewInt(20)},
+		{To: common.Address{1}, Value: big.NewInt(30)},
+	})
+	gasUsed := transaction.IntrinsicGas() + 2*vm.ColdAccountAccessCost + vm.WarmStorageReadCost
+	if receipt.Status != tx.ReceiptStatusSuccessful || len(receipt.CallResults) != 3 || receipt.GasUsed != gasUsed {
+		t.Fatalf("receipt %+v", receipt)
+	}
+	if balanceOf(common.Address{1}) != 40 || balanceOf(common.Address{2}) != 20 {
+		t.Error("transfers not applied")
+	}
+	if got, want := balanceOf(sender), before-60-gasUsed; got != want {
+		t.Errorf("sender balance %d, want %d", got, want)
+	}
+
+	// 第二笔余额不够：全部回滚，交易仍然上链，收gas费（包括已执行调用的访问费）、消耗nonce
+	before = balanceOf(sender)
+	transaction, receipt = execute(2, []tx.BatchCall{
+		{To: common.Address{1}, Value: big.NewInt(1)},
+		{To: common.Address{2}, Value: big.NewInt(int64(before))},
+		{To: common.Address{3}, Value: big.NewInt(1)},
+	})
+	if receipt.Status != tx.ReceiptStatusFailed {
+		t.Errorf("receipt status %d", receipt.Status)
+	}
+	results := receipt.CallResults
+	if len(results) != 3 || results[0].Status != tx.ReceiptStatusSuccessful || results[1].Error != "insufficient balance" || results[2].Status != tx.ReceiptStatusFailed {
+		t.Errorf("call results %+v", results)
+	}
+	if balanceOf(common.Address{1}) != 40 || balanceOf(common.Address{3}) != 0 {
+		t.Error("failed batch not reverted")
+	}
+	account, _ := virtualMachine.GetAccount(sender)
+	if account.Balance != before-transaction.IntrinsicGas()-2*vm.ColdAccountAccessCost || account.Nonce != 2 {
+		t.Errorf("sender after failed batch: balance %d nonce %d", account.Balance, account.Nonce)
+	}
+
+	// 没有调用的批量交易不能执行
+	empty := tx.NewBatchTransaction(3, nil, 100000, big.NewInt(1), big.NewInt(1))
+	empty.Sign(key)
+	if err := virtualMachine.ExecuteTransaction(empty); err != tx.ErrEmptyBatch {
+		t.Errorf("empty batch: %v", err)
+	}
+}
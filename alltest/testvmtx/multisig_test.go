@@ -0,0 +1,88 @@
+package testvmtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVM_MultisigAccount(t *testing.T) {
+	virtualMachine, treasury, key := newTestVM(t, "test_db_vm_multisig")
+	keys := make([][]byte, 3)
+	owners := make([]common.Address, 3)
+	for i := range keys {
+		ownerKey, _ := crypto.GenerateKey()
+		keys[i] = crypto.FromECDSA(ownerKey)
+		owners[i] = common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&ownerKey.PublicKey))
+	}
+	receiver := common.Address{8}
+	multisigTx := func(nonce uint64, to common.Address, value int64, data []byte, signers ...[]byte) *tx.Transaction {
+		transaction := tx.NewMultisigTransaction(treasury, nonce, to, big.NewInt(value), 100000, big.NewInt(1), data, big.NewInt(1))
+		for _, signer := range signers {
+			if err := transaction.Sign(signer); err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+		}
+		return transaction
+	}
+
+	// 普通账户还不能发多签交易
+	if err := virtualMachine.ExecuteTransaction(multisigTx(1, receiver, 1, nil, keys[0], keys[1])); !errors.Is(err, tx.ErrNotMultisig) {
+		t.Fatalf("multisig transaction from a plain account: %v", err)
+	}
+
+	// 发给自己的所有者变更把账户变成 2/3 多签
+	convert := tx.NewTransaction(1, treasury, big.NewInt(0), 100000, big.NewInt(1), tx.EncodeOwnerUpdate(owners, 2), big.NewInt(1))
+	if err := convert.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(convert); err != nil {
+		t.Fatalf("convert to multisig: %v", err)
+	}
+	account, _ := virtualMachine.GetAccount(treasury)
+	if !account.IsMultisig() || account.Threshold != 2 || len(account.Owners) != 3 {
+		t.Fatalf("account after conversion: %+v", account)
+	}
+
+	// 之后原来的私钥单签无效，签名不够门限也不行
+	single := tx.NewTransaction(2, receiver, big.NewInt(1), 100000, big.NewInt(1), nil, big.NewInt(1))
+	single.Sign(key)
+	if err := virtualMachine.ExecuteTransaction(single); !errors.Is(err, tx.ErrMultisigRequired) {
+		t.Errorf("single signature: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(multisigTx(2, receiver, 1, nil, keys[0], keys[0])); !errors.Is(err, tx.ErrNotEnoughSignatures) {
+		t.Errorf("one owner signing twice: %v", err)
+	}
+
+	// 两个所有者签名后转账成功
+	before, _ := virtualMachine.GetAccount(treasury)
+	transfer := multisigTx(2, receiver, 100, nil, keys[0], keys[2])
+	if err := virtualMachine.ExecuteTransaction(transfer); err != nil {
+		t.Fatalf("2 of 3 transfer: %v", err)
+	}
+	after, _ := virtualMachine.GetAccount(treasury)
+	if got, want := after.Balance, before.Balance-100-transfer.IntrinsicGas(); got != want {
+		t.Errorf("treasury balance %d, want %d", got, want)
+	}
+	if received, _ := virtualMachine.GetAccount(receiver); received.Balance != 100 {
+		t.Errorf("receiver balance %d", received.Balance)
+	}
+
+	// 所有者变更也要多签，门限改成 3/3 后两个签名就不够了
+	if err := virtualMachine.ExecuteTransaction(multisigTx(3, treasury, 0, tx.EncodeOwnerUpdate(owners, 3), keys[1], keys[2])); err != nil {
+		t.Fatalf("owner update: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(multisigTx(4, receiver, 1, nil, keys[0], keys[1])); !errors.Is(err, tx.ErrNotEnoughSignatures) {
+		t.Errorf("2 signatures under a 3 of 3 threshold: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(multisigTx(4, treasury, 0, tx.EncodeOwnerUpdate(owners, 4), keys...)); err == nil {
+		t.Error("threshold above the number of owners accepted")
+	}
+	if account, _ := virtualMachine.GetAccount(treasury); account.Threshold != 3 || account.Nonce != 3 {
+		t.Errorf("failed update changed the account: %+v", account)
+	}
+}
@@ -0,0 +1,94 @@
+package testvmtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVM_SponsoredTransaction(t *testing.T) {
+	virtualMachine, payer, payerKey := newTestVM(t, "test_db_vm_sponsored")
+	receiver := common.Address{8}
+	userKey, _ := crypto.GenerateKey()
+	user := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&userKey.PublicKey))
+
+	// 没有余额的用户发交易，gas费全部由代付方付，nonce 记在用户身上
+	transaction := tx.NewSponsoredTransaction(1, receiver, big.NewInt(0), 30000, big.NewInt(2), nil, payer, big.NewInt(1))
+	if err := transaction.Sign(crypto.FromECDSA(userKey)); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(transaction); !errors.Is(err, tx.ErrInvalidFeePayer) {
+		t.Errorf("without payer signature: %v", err)
+	}
+	if err := transaction.SignFeePayer(payerKey); err != nil {
+		t.Fatalf("SignFeePayer failed: %v", err)
+	}
+	if err := virtualMachine.ExecuteTransaction(transaction); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	if account, _ := virtualMachine.GetAccount(payer); account.Balance != 1000000-2*tx.TxGas {
+		t.Errorf("payer balance %d, want %d", account.Balance, 1000000-2*tx.TxGas)
+	}
+	if account, _ := virtualMachine.GetAccount(user); account.Balance != 0 || account.Nonce != 1 {
+		t.Errorf("user balance %d nonce %d", account.Balance, account.Nonce)
+	}
+
+	// 转账金额仍然由用户自己付
+	transfer := tx.NewSponsoredTransaction(2, receiver, big.NewInt(10), 30000, big.NewInt(2), nil, payer, big.NewInt(1))
+	transfer.Sign(crypto.FromECDSA(userKey))
+	transfer.SignFeePayer(payerKey)
+	if err := virtualMachine.ExecuteTransaction(transfer); err == nil {
+		t.Error("user without balance transferred value")
+	}
+	if account, _ := virtualMachine.GetAccount(payer); account.Balance != 1000000-2*tx.TxGas {
+		t.Errorf("failed transaction charged the payer: %d", account.Balance)
+	}
+}
+
+func TestVM_SponsoredInsufficientPayer(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_sponsored_payer")
+	payerKey, _ := crypto.GenerateKey()
+	payer := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&payerKey.PublicKey))
+	if err := virtualMachine.SetAccount(payer, &common.Account{Balance: 29999}); err != nil {
+		t.Fatalf("SetAccount failed: %v", err)
+	}
+
+	// 代付方余额要够按 gasLimit 预付，发送者有钱也不替代付方垫付
+	transaction := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(5), 30000, big.NewInt(1), nil, payer, big.NewInt(1))
+	transaction.Sign(key)
+	transaction.SignFeePayer(crypto.FromECDSA(payerKey))
+	if err := virtualMachine.ExecuteTransaction(transaction); !errors.Is(err, tx.ErrInsufficientPayerFunds) {
+		t.Errorf("insufficient payer: %v", err)
+	}
+	if account, _ := virtualMachine.GetAccount(sender); account.Balance != 1000000 || account.Nonce != 0 {
+		t.Errorf("sender balance %d nonce %d", account.Balance, account.Nonce)
+	}
+}
+
+func TestVM_SponsoredMultisigPayer(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_sponsored_multisig")
+	payerKey, _ := crypto.GenerateKey()
+	payer := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&payerKey.PublicKey))
+	owners := []common.Address{payer, {5}}
+	if err := virtualMachine.SetAccount(payer, &common.Account{Balance: 1000000, Owners: owners, Threshold: 2}); err != nil {
+		t.Fatalf("SetAccount failed: %v", err)
+	}
+
+	// 多签账户自己的私钥签的代付不算所有者同意，不能用它的余额付gas费
+	transaction := tx.NewSponsoredTransaction(1, common.Address{8}, big.NewInt(5), 30000, big.NewInt(1), nil, payer, big.NewInt(1))
+	transaction.Sign(key)
+	transaction.SignFeePayer(crypto.FromECDSA(payerKey))
+	if err := virtualMachine.ExecuteTransaction(transaction); !errors.Is(err, tx.ErrMultisigFeePayer) {
+		t.Errorf("multisig payer: %v", err)
+	}
+	if account, _ := virtualMachine.GetAccount(payer); account.Balance != 1000000 {
+		t.Errorf("multisig payer charged: %d", account.Balance)
+	}
+	if account, _ := virtualMachine.GetAccount(sender); account.Balance != 1000000 || account.Nonce != 0 {
+		t.Errorf("sender balance %d nonce %d", account.Balance, account.Nonce)
+	}
+}
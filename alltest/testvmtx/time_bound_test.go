@@ -0,0 +1,38 @@
+package testvmtx
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestVM_TimeBoundTransaction(t *testing.T) {
+	virtualMachine, sender, key := newTestVM(t, "test_db_vm_time_bound")
+	transaction := tx.NewTimeBoundTransaction(1, common.Address{8}, big.NewInt(5), 21000, big.NewInt(1), nil, 10, 1700000000, big.NewInt(1))
+	if err := transaction.Sign(key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	// 高度还没到，或者时间已经过了，都不执行也不改状态
+	virtualMachine.SetBlock(9, 1600000000)
+	if err := virtualMachine.ExecuteTransaction(transaction); !errors.Is(err, tx.ErrTxNotYetValid) {
+		t.Errorf("before validAfter: %v", err)
+	}
+	virtualMachine.SetBlock(10, 1700000001)
+	if err := virtualMachine.ExecuteTransaction(transaction); !errors.Is(err, tx.ErrTxExpired) {
+		t.Errorf("after validUntil: %v", err)
+	}
+	if account, _ := virtualMachine.GetAccount(sender); account.Nonce != 0 || account.Balance != 1000000 {
+		t.Errorf("rejected transaction changed the sender: balance %d nonce %d", account.Balance, account.Nonce)
+	}
+
+	virtualMachine.SetBlock(10, 1700000000)
+	if err := virtualMachine.ExecuteTransaction(transaction); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	if account, _ := virtualMachine.GetAccount(common.Address{8}); account.Balance != 5 {
+		t.Errorf("receiver balance %d", account.Balance)
+	}
+}
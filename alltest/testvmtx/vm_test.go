@@ -66,7 +66,7 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 			1,              // nonce
 			receiver,       // to
 			big.NewInt(50), // value
-			1000,           // gasLimit
+			30000,          // gasLimit
 			big.NewInt(1),  // gasPrice
 			[]byte{},       // data
 			big.NewInt(1),  // chainID
@@ -94,8 +94,8 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 			t.Errorf("Failed to get receiver account: %v", err)
 		}
 
-		// 计算gas费用
-		gasCost := uint64(transferTx.GasLimit) * transferTx.GasPrice.Uint64()
+		// 计算gas费用，只按实际消耗收取，多出的gas退还
+		gasCost := transferTx.IntrinsicGas() * transferTx.GasPrice.Uint64()
 		expectedSenderBalance := uint64(1000000) - (uint64(50) + gasCost)
 		expectedReceiverBalance := uint64(50)
 
@@ -117,10 +117,10 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 
 		// 创建合约创建交易
 		contractTx := tx.NewTransaction(
-			0,                       // nonce
+			2,                       // nonce
 			common.Address{},        // to address is empty for contract creation
 			big.NewInt(0),           // value
-			1000,                    // 降低gasLimit
+			60000,                   // gasLimit
 			big.NewInt(1),           // gasPrice
 			[]byte("contract code"), // data
 			big.NewInt(1),           // chainID
@@ -157,9 +157,9 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 		}
 
 		// 计算gas费用
-		gasCost := uint64(contractTx.GasLimit) * contractTx.GasPrice.Uint64()
-		// 2000000 (两次mint) - 50 (第一次转账) - 1000 (第一次gas) - gasCost (本次合约创建gas)
-		expectedSenderBalance := uint64(2000000) - 50 - 1000 - gasCost
+		gasCost := contractTx.IntrinsicGas() * contractTx.GasPrice.Uint64()
+		// 2000000 (两次mint) - 50 (第一次转账) - 21000 (第一次gas) - gasCost (本次合约创建gas)
+		expectedSenderBalance := uint64(2000000) - 50 - tx.TxGas - gasCost
 
 		if senderAccount.Balance != expectedSenderBalance {
 			t.Errorf("Sender balance incorrect after contract creation. Got %v, want %v", senderAccount.Balance, expectedSenderBalance)
@@ -175,7 +175,7 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 
 		// 创建转账交易
 		transferTx := tx.NewTransaction(
-			0, // nonce
+			3, // nonce
 			receiver,
 			big.NewInt(1000000000000000000), // value
 			21000,                           // gasLimit
@@ -201,7 +201,7 @@ func TestVM_ExecuteTransaction(t *testing.T) {
 	t.Run("Invalid Transaction", func(t *testing.T) {
 		// 创建无效交易
 		invalidTx := tx.NewTransaction(
-			0,                // nonce
+			3,                // nonce
 			common.Address{}, // to address
 			big.NewInt(0),    // value
 			0,                // invalid gasLimit
@@ -2,24 +2,39 @@ package block
 
 import (
 	"blockchain/common"
+	"blockchain/mmr"
 	"blockchain/mpt"
 	"blockchain/tx"
+	"errors"
 	"fmt"
+	"math/big"
+	"sync"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
 type Header struct {
 	Root       common.Hash//状态树的根节点
+	ReceiptRoot common.Hash //区块内交易收据的默克尔根
+	Bloom       tx.Bloom    //区块内所有日志的布隆过滤器
+	MMRRoot     common.Hash //之前所有区块哈希组成的MMR的根，轻节点据此验证祖先区块
 	ParentHash common.Hash //前一个区块的哈希值
 	Height     uint64
 	Coinbase   common.Address//矿工地址
+	GasLimit   uint64 //区块内交易消耗gas的上限
+	GasUsed    uint64 //区块内交易实际消耗的gas
 
 	Timestamp  uint64
+	Difficulty uint64 //由共识引擎解释，pow下为哈希前导零比特数
 	Nonce      uint64
+	ExtraData  []byte //共识引擎的附加数据，如poa的签名者列表和区块签名
+
+	BaseFee *big.Int `rlp:"optional"` //EIP-1559 每单位gas销毁的手续费，启用前为nil，nil 时不参与编码，旧区块哈希不变
 }
 
 type Body struct {
-	Transactions []tx.Transaction
+	Transactions []*tx.Transaction
 }
 
 func (header Header) Hash() common.Hash {
@@ -30,8 +45,9 @@ func (header Header) Hash() common.Hash {
 	return common.Hash{}.NewHash(data)
 }
 
-func NewHeader(parent Header) *Header {
-	if parent.Height==0{
+// NewHeader creates the header following parent, a nil parent yields the genesis header
+func NewHeader(parent *Header) *Header {
+	if parent == nil {
 		fmt.Println("parent为空，创建空区块头")
 		return &Header{
 			Root:       common.Hash{},
@@ -49,7 +65,7 @@ func NewHeader(parent Header) *Header {
 
 func NewBlock() *Body {
 	return &Body{
-		Transactions: make([]tx.Transaction, 0),
+		Transactions: make([]*tx.Transaction, 0),
 	}
 }
 
@@ -57,18 +73,243 @@ type Blockchain struct {
 	CurrentHeader Header
 	Statedb      *mpt.MPT
 	Txpool       *tx.TxPool
+
+	headers []*Header                //规范链，下标即高度
+	byHash  map[common.Hash]*Header
+	bodies  map[common.Hash]*Body
+	supply  map[common.Hash]uint64 //每个区块执行完后的总发行量
+	history *mmr.PersistentMMR     //规范链上所有区块哈希，按高度追加
+
+	headFeed     event.Feed //链头变化时通知订阅者
+	deferHeads   bool       //链头事件先记下来，由 PostHeadEvents 在调用方的锁外发出
+	headMu       sync.Mutex //保护 pendingHeads
+	pendingHeads []*Header
+	postMu       sync.Mutex //多个协程同时 PostHeadEvents 时按记录的顺序发出
+}
+
+// ChainHeadEvent 规范链的链头变化时发出
+type ChainHeadEvent struct {
+	Header *Header
 }
 
+// SubscribeChainHeadEvent registers a subscription of ChainHeadEvent, the channel should be buffered
+func (chain *Blockchain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
+	return chain.headFeed.Subscribe(ch)
+}
+
+// DeferHeadEvents makes AddBlock and SetHead record head events instead of sending them,
+// the owner sends them with PostHeadEvents after releasing its own lock
+func (chain *Blockchain) DeferHeadEvents() {
+	chain.headMu.Lock()
+	defer chain.headMu.Unlock()
+	chain.deferHeads = true
+}
 
+// PostHeadEvents sends the head events recorded since the last call, oldest first
+func (chain *Blockchain) PostHeadEvents() {
+	chain.postMu.Lock()
+	defer chain.postMu.Unlock()
+	chain.headMu.Lock()
+	heads := chain.pendingHeads
+	chain.pendingHeads = nil
+	chain.headMu.Unlock()
+	for _, header := range heads {
+		chain.headFeed.Send(ChainHeadEvent{Header: header})
+	}
+}
 
+// sendHead 订阅者可能回头调用链的所有者，推迟发送时只记下来
+func (chain *Blockchain) sendHead(header *Header) {
+	chain.headMu.Lock()
+	if chain.deferHeads {
+		chain.pendingHeads = append(chain.pendingHeads, header)
+		chain.headMu.Unlock()
+		return
+	}
+	chain.headMu.Unlock()
+	chain.headFeed.Send(ChainHeadEvent{Header: header})
+}
+
+
+
+
+// AddBlock makes header the new head, replacing the canonical blocks from its height on.
+// The height must not skip past the current chain
+func (chain *Blockchain) AddBlock(header *Header, body *Body, state *mpt.MPT, txpool *tx.TxPool) error {
+	if header.Height > uint64(len(chain.headers)) {
+		return fmt.Errorf("block %d leaves a gap, the chain has %d blocks", header.Height, len(chain.headers))
+	}
+	if chain.byHash == nil {
+		chain.byHash = make(map[common.Hash]*Header)
+		chain.bodies = make(map[common.Hash]*Body)
+	}
+	hash := header.Hash()
+	//先更新区块哈希累加器，失败时规范链不变；重组时先退回到新区块的父区块
+	history := chain.getHistory()
+	if history.LeafCount() > header.Height {
+		if err := history.Rewind(header.Height); err != nil {
+			return err
+		}
+	}
+	if err := history.AddLeaf(hash.Bytes()); err != nil {
+		return err
+	}
+	chain.headers = append(chain.headers[:header.Height], header)
+	chain.byHash[hash] = header
+	chain.bodies[hash] = body
 
-func (chain *Blockchain) AddBlock(header *Header,state *mpt.MPT,txpool *tx.TxPool) {
 	chain.CurrentHeader = *header
 	chain.Statedb=state
 	chain.Txpool=txpool
+	chain.sendHead(header)
+	return nil
+}
+
+// SetHead rewinds the canonical chain so that the block at height becomes the head,
+// the blocks above it stay known by hash but leave the canonical chain
+func (chain *Blockchain) SetHead(height uint64) error {
+	if height >= uint64(len(chain.headers)) {
+		return fmt.Errorf("cannot rewind to block %d, the chain has %d blocks", height, len(chain.headers))
+	}
+	if history := chain.getHistory(); history.LeafCount() > height+1 {
+		if err := history.Rewind(height + 1); err != nil {
+			return err
+		}
+	}
+	chain.headers = chain.headers[:height+1]
+	header := chain.headers[height]
+	chain.CurrentHeader = *header
+	chain.sendHead(header)
+	return nil
+}
+
+// Empty reports whether no block (not even genesis) has been added yet
+func (chain *Blockchain) Empty() bool {
+	return len(chain.headers) == 0
+}
+
+// GetCurrentHeader returns the head of the canonical chain, nil before genesis
+func (chain *Blockchain) GetCurrentHeader() *Header {
+	if chain.Empty() {
+		return nil
+	}
+	return chain.headers[len(chain.headers)-1]
+}
+
+// GetHeaderByHeight returns the canonical header at the given height
+func (chain *Blockchain) GetHeaderByHeight(height uint64) *Header {
+	if height >= uint64(len(chain.headers)) {
+		return nil
+	}
+	return chain.headers[height]
+}
+
+// GetHeaderByHash returns a known header by its hash
+func (chain *Blockchain) GetHeaderByHash(hash common.Hash) *Header {
+	return chain.byHash[hash]
+}
+
+// GetBody returns the body of a known block
+func (chain *Blockchain) GetBody(hash common.Hash) *Body {
+	return chain.bodies[hash]
+}
+
+// SetTotalSupply records the total coins in existence after the given block
+func (chain *Blockchain) SetTotalSupply(hash common.Hash, supply uint64) {
+	if chain.supply == nil {
+		chain.supply = make(map[common.Hash]uint64)
+	}
+	chain.supply[hash] = supply
+}
+
+// GetTotalSupply returns the total supply after the canonical block at the given height
+func (chain *Blockchain) GetTotalSupply(height uint64) (uint64, bool) {
+	header := chain.GetHeaderByHeight(height)
+	if header == nil {
+		return 0, false
+	}
+	supply, ok := chain.supply[header.Hash()]
+	return supply, ok
+}
+
+// historyPrefix 区块哈希累加器在数据库里的键前缀
+var historyPrefix = []byte("history-mmr-")
+
+// SetHistoryStore keeps the MMR of block hashes in db instead of memory, the stored accumulator
+// is rewound to the blocks the chain currently holds
+func (chain *Blockchain) SetHistoryStore(db mmr.KeyValueStore) error {
+	history, err := mmr.NewPersistent(db, historyPrefix, mimc.NewMiMC())
+	if err != nil {
+		return err
+	}
+	if leaves := uint64(len(chain.headers)); history.LeafCount() > leaves {
+		if err := history.Rewind(leaves); err != nil {
+			return err
+		}
+	}
+	if history.LeafCount() != uint64(len(chain.headers)) {
+		return errors.New("stored block history does not match the chain")
+	}
+	chain.history = history
+	return nil
+}
+
+func (chain *Blockchain) getHistory() *mmr.PersistentMMR {
+	if chain.history == nil {
+		//空的内存存储不会出错
+		chain.history, _ = mmr.NewPersistent(mmr.NewMemoryStore(), historyPrefix, mimc.NewMiMC())
+	}
+	return chain.history
+}
+
+// GetMMRRoot returns the MMR root over the hashes of all canonical blocks, the next header commits to it
+func (chain *Blockchain) GetMMRRoot() common.Hash {
+	var root common.Hash
+	copy(root[:], chain.getHistory().Root())
+	return root
+}
+
+// GetMMRRootAt returns the MMR root over the canonical blocks below height, which the header at height commits to
+func (chain *Blockchain) GetMMRRootAt(height uint64) (common.Hash, error) {
+	var root common.Hash
+	view, err := chain.getHistory().AtLeaves(height)
+	if err != nil {
+		return root, err
+	}
+	copy(root[:], view.Root())
+	return root, nil
+}
+
+// GetAncestorProof proves that the canonical block at height is an ancestor of the current head,
+// the proof verifies against the head's MMRRoot
+func (chain *Blockchain) GetAncestorProof(height uint64) (*mmr.MMRProof, error) {
+	head := chain.GetCurrentHeader()
+	if head == nil || height >= head.Height {
+		return nil, errors.New("not an ancestor of the current head")
+	}
+	//链头提交的是它之前的区块，即链头加入前的MMR
+	view, err := chain.getHistory().AtLeaves(head.Height)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := view.GetProof(mmr.LeafIndex(height))
+	if err != nil {
+		return nil, err
+	}
+	proof.Hash = mimc.NewMiMC()
+	return &proof, nil
+}
+
+// VerifyAncestorProof checks a proof that ancestor is an earlier block of the chain ending at head
+func VerifyAncestorProof(head, ancestor *Header, proof *mmr.MMRProof) bool {
+	if proof == nil || ancestor.Height >= head.Height {
+		return false
+	}
+	hash := ancestor.Hash()
+	return proof.Verify(hash.Bytes(), head.MMRRoot.Bytes(), mimc.NewMiMC())
 }
 
 func (chain *Blockchain) Broadcast(header *Header, body *Body) error{
 	//要广播，但是没实现这里，这里先空着
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,61 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// EIP-1559 的参数，沿用以太坊的取值
+const (
+	BaseFeeChangeDenominator = 8 //每个区块 baseFee 最多变化 1/8
+	ElasticityMultiplier     = 2 //gas目标是区块gas上限的一半
+)
+
+// ErrInvalidBaseFee 区块头的 BaseFee 和按父区块算出的不一致
+var ErrInvalidBaseFee = errors.New("invalid base fee")
+
+// CalcBaseFee returns the base fee of the block following parent: it rises when the parent used more
+// than half of its gas limit and falls when it used less. initial is used when parent has no base fee
+func CalcBaseFee(parent *Header, initial *big.Int) *big.Int {
+	if parent == nil || parent.BaseFee == nil {
+		return new(big.Int).Set(initial)
+	}
+	target := parent.GasLimit / ElasticityMultiplier
+	if target == 0 || parent.GasUsed == target {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+	var delta uint64
+	if parent.GasUsed > target {
+		delta = parent.GasUsed - target
+	} else {
+		delta = target - parent.GasUsed
+	}
+	//baseFee * delta / target / 8
+	change := new(big.Int).Mul(parent.BaseFee, new(big.Int).SetUint64(delta))
+	change.Div(change, new(big.Int).SetUint64(target))
+	change.Div(change, big.NewInt(BaseFeeChangeDenominator))
+	if parent.GasUsed > target {
+		//涨的时候至少涨1
+		if change.Sign() == 0 {
+			change.SetUint64(1)
+		}
+		return change.Add(parent.BaseFee, change)
+	}
+	fee := new(big.Int).Sub(parent.BaseFee, change)
+	if fee.Sign() < 0 {
+		fee.SetUint64(0)
+	}
+	return fee
+}
+
+// VerifyBaseFee checks that header carries the base fee expected after parent, want is nil before EIP-1559 is enabled
+func VerifyBaseFee(header *Header, want *big.Int) error {
+	if want == nil && header.BaseFee == nil {
+		return nil
+	}
+	if want == nil || header.BaseFee == nil || want.Cmp(header.BaseFee) != 0 {
+		return fmt.Errorf("%w: have %v, want %v", ErrInvalidBaseFee, header.BaseFee, want)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package block
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 收据和状态树节点存在同一个数据库里，用前缀区分
+var (
+	receiptsPrefix = []byte("receipts-")  //receiptsPrefix + 区块哈希 -> 区块内全部收据
+	txLookupPrefix = []byte("tx-lookup-") //txLookupPrefix + 交易哈希 -> 所在区块哈希
+)
+
+// ErrReceiptNotFound 交易不在任何已保存的区块里
+var ErrReceiptNotFound = errors.New("receipt not found")
+
+func receiptsKey(blockHash common.Hash) []byte {
+	return append(append([]byte{}, receiptsPrefix...), blockHash.Bytes()...)
+}
+
+func txLookupKey(txHash common.Hash) []byte {
+	return append(append([]byte{}, txLookupPrefix...), txHash.Bytes()...)
+}
+
+// WriteReceipts stores the receipts of a sealed block and indexes them by transaction hash
+func WriteReceipts(db *mpt.DB, blockHash common.Hash, receipts []*tx.Receipt) error {
+	data, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return err
+	}
+	kvs := map[string][]byte{string(receiptsKey(blockHash)): data}
+	for _, receipt := range receipts {
+		//重组后同一笔交易以最后写入的区块为准
+		kvs[string(txLookupKey(receipt.TxHash))] = blockHash.Bytes()
+	}
+	return db.BatchPut(kvs)
+}
+
+// ReadReceipts returns the receipts stored for a block, nil when there are none
+func ReadReceipts(db *mpt.DB, blockHash common.Hash) ([]*tx.Receipt, error) {
+	data, err := db.Get(receiptsKey(blockHash))
+	if err != nil {
+		return nil, ErrReceiptNotFound
+	}
+	var receipts []*tx.Receipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// ReadReceipt returns the receipt of a transaction included in a stored block
+func ReadReceipt(db *mpt.DB, txHash common.Hash) (*tx.Receipt, error) {
+	data, err := db.Get(txLookupKey(txHash))
+	if err != nil {
+		return nil, ErrReceiptNotFound
+	}
+	var blockHash common.Hash
+	copy(blockHash[:], data)
+	receipts, err := ReadReceipts(db, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, receipt := range receipts {
+		if receipt.TxHash == txHash {
+			return receipt, nil
+		}
+	}
+	return nil, ErrReceiptNotFound
+}
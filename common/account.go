@@ -11,6 +11,14 @@ type Account struct {
 	Code     []byte	`json:"code"`
 	Storage  map[string]string	`json:"storage"`
 	IsEoa    bool	`json:"isEoa"`
+
+	Owners    []Address `json:"owners,omitempty"`    //多签账户的所有者，普通账户为空
+	Threshold uint64    `json:"threshold,omitempty"` //多签账户发交易需要的所有者签名数，0 表示普通账户
+}
+
+// IsMultisig reports whether the account is controlled by its owners rather than its own key
+func (a *Account) IsMultisig() bool {
+	return a.Threshold > 0
 }
 
 // NewEOA creates a new externally owned account
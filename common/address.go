@@ -33,6 +33,24 @@ func (a Address) String() string {
 	return hex.EncodeToString(a[:])
 }
 
+// MarshalText encodes the address as hex, so it can be used as a JSON map key
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes a hex address, with or without 0x prefix
+func (a *Address) UnmarshalText(input []byte) error {
+	data, err := hex.DecodeString(strings.TrimPrefix(string(input), "0x"))
+	if err != nil {
+		return err
+	}
+	if len(data) != AddressLength {
+		return fmt.Errorf("invalid address length %d", len(data))
+	}
+	copy(a[:], data)
+	return nil
+}
+
 // IsZero returns true if the address is the zero address
 func (a Address) IsZero() bool {
 	for _, b := range a {
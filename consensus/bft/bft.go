@@ -0,0 +1,242 @@
+package bft
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/vm"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	errNoCandidate     = errors.New("no block to propose at this height")
+	errCommittedOther  = errors.New("another proposal was committed at this height")
+	errWrongProposer   = errors.New("block coinbase is not a validator")
+	errInvalidGenesis  = errors.New("genesis must not carry a certificate")
+	errGenesisProposal = errors.New("genesis cannot be proposed")
+)
+
+// Config bft链的参数：固定的验证者集合和各阶段超时
+type Config struct {
+	Validators []common.Address
+
+	TimeoutPropose   time.Duration //等待提议的时长
+	TimeoutPrevote   time.Duration //收到任意2/3预投票后再等待的时长
+	TimeoutPrecommit time.Duration //收到任意2/3预提交后再等待的时长
+	TimeoutDelta     time.Duration //每多一轮各超时增加的时长
+}
+
+// timeout 轮次越高等待越久，保证网络恢复后最终能达成一致
+func (c *Config) timeout(base time.Duration, round uint64) time.Duration {
+	return base + time.Duration(round)*c.TimeoutDelta
+}
+
+// BFT 有即时最终性的共识引擎：每个区块要经过一轮或多轮 propose/prevote/precommit，
+// 超过2/3验证者预提交后写入提交证书，之后不会再被回滚
+type BFT struct {
+	config     *Config
+	validators *ValidatorSet
+	self       common.Address
+	core       *Core
+
+	lock       sync.Mutex
+	candidates map[uint64]*Message           //Seal 交给共识的待提议区块
+	waiters    map[uint64]chan *block.Header //Seal 在等待的高度
+	committed  *block.Header                 //最近一次确认的区块，Seal 登记等待之前就确认了也能看到
+	onCommit   func(header *block.Header, body *block.Body)
+	chain      consensus.ChainReader //校验提议时查父区块，为nil时只检查 coinbase
+	validate   BlockValidator
+}
+
+// BlockValidator 在父区块的状态上试执行提议的区块，检查gas、收据根和状态根与区块头一致
+type BlockValidator func(header *block.Header, body *block.Body) error
+
+// New creates a BFT engine for the local validator, wiring its core to the given clock and transport
+func New(config *Config, self common.Address, signFn consensus.SignerFn, clock Clock, transport Transport) *BFT {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	b := &BFT{
+		config:     config,
+		validators: NewValidatorSet(config.Validators),
+		self:       self,
+		candidates: make(map[uint64]*Message),
+		waiters:    make(map[uint64]chan *block.Header),
+	}
+	b.core = NewCore(config, self, signFn, clock, transport, b)
+	return b
+}
+
+var _ consensus.Engine = (*BFT)(nil)
+var _ Backend = (*BFT)(nil)
+
+// Start begins participating in consensus from the given height
+func (b *BFT) Start(height uint64) { b.core.Start(height) }
+
+// Stop leaves consensus
+func (b *BFT) Stop() { b.core.Stop() }
+
+// Core exposes the state machine, mainly for monitoring
+func (b *BFT) Core() *Core { return b.core }
+
+// OnCommit registers a hook receiving every finalized block, including ones proposed by others
+func (b *BFT) OnCommit(hook func(header *block.Header, body *block.Body)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.onCommit = hook
+}
+
+// SetBlockValidator makes the engine check proposals against the local chain and execute
+// their bodies with validate before voting for them
+func (b *BFT) SetBlockValidator(chain consensus.ChainReader, validate BlockValidator) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.chain, b.validate = chain, validate
+}
+
+func (b *BFT) Author(header *block.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+func (b *BFT) VerifyHeader(chain consensus.ChainReader, header *block.Header) error {
+	if header.Height == 0 {
+		if len(header.ExtraData) != 0 {
+			return errInvalidGenesis
+		}
+		return nil
+	}
+	if err := b.verifyUnsealed(chain, header); err != nil {
+		return err
+	}
+	cert, err := DecodeCertificate(header)
+	if err != nil {
+		return err
+	}
+	return b.validators.VerifyCertificate(cert, header.Height, SealHash(header))
+}
+
+// verifyUnsealed 证书以外的检查，提议的区块还没有证书
+func (b *BFT) verifyUnsealed(chain consensus.ChainReader, header *block.Header) error {
+	if _, err := consensus.VerifyParent(chain, header); err != nil {
+		return err
+	}
+	if !b.validators.Contains(header.Coinbase) {
+		return errWrongProposer
+	}
+	return nil
+}
+
+func (b *BFT) Prepare(chain consensus.ChainReader, header *block.Header) error {
+	header.Coinbase = b.self
+	header.Difficulty = 1
+	header.Nonce = 0
+	header.ExtraData = nil
+	return nil
+}
+
+// Finalize bft链没有出块奖励
+func (b *BFT) Finalize(chain consensus.ChainReader, header *block.Header, state *vm.VM, body *block.Body) error {
+	return nil
+}
+
+// Seal 把区块交给共识，阻塞到该高度被最终确认；确认的若是别人的提议则返回 errCommittedOther，
+// 那个区块会通过 OnCommit 交付
+func (b *BFT) Seal(chain consensus.ChainReader, header *block.Header, body *block.Body, stop <-chan struct{}) (*block.Header, error) {
+	if header.Height == 0 {
+		sealed := *header
+		return &sealed, nil
+	}
+	hash := SealHash(header)
+	//先登记等待再提议，否则提议在登记前就被确认时 Seal 会一直等下去
+	wait := make(chan *block.Header, 1)
+	b.lock.Lock()
+	if b.committed != nil && b.committed.Height >= header.Height {
+		//这个高度已经确认了别人的提议，正在交付
+		b.lock.Unlock()
+		return nil, errCommittedOther
+	}
+	b.waiters[header.Height] = wait
+	b.lock.Unlock()
+	defer func() {
+		b.lock.Lock()
+		delete(b.candidates, header.Height)
+		delete(b.waiters, header.Height)
+		b.lock.Unlock()
+	}()
+	b.Propose(header, body)
+	b.core.NewCandidate(header.Height)
+
+	select {
+	case <-stop:
+		return nil, consensus.ErrStopped
+	case committed := <-wait:
+		if SealHash(committed) != hash {
+			return nil, errCommittedOther
+		}
+		return committed, nil
+	}
+}
+
+// Propose hands a block to consensus without waiting, it is used whenever we are proposer at its height
+func (b *BFT) Propose(header *block.Header, body *block.Body) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.candidates[header.Height] = &Message{BlockHash: SealHash(header), Header: header, Body: body}
+}
+
+// BuildProposal 轮到本节点提议时取 Seal 交进来的区块
+func (b *BFT) BuildProposal(height uint64) (*block.Header, *block.Body, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	candidate, ok := b.candidates[height]
+	if !ok {
+		return nil, nil, errNoCandidate
+	}
+	return candidate.Header, candidate.Body, nil
+}
+
+// VerifyProposal 提议的区块头除证书外要通过 VerifyHeader 的检查，区块体要能执行出区块头里的结果；
+// 没有设置 SetBlockValidator 时只检查 coinbase 是验证者
+func (b *BFT) VerifyProposal(header *block.Header, body *block.Body) error {
+	b.lock.Lock()
+	chain, validate := b.chain, b.validate
+	b.lock.Unlock()
+	if chain == nil {
+		if !b.validators.Contains(header.Coinbase) {
+			return errWrongProposer
+		}
+		return nil
+	}
+	if header.Height == 0 {
+		return errGenesisProposal
+	}
+	if err := b.verifyUnsealed(chain, header); err != nil {
+		return err
+	}
+	if validate != nil {
+		return validate(header, body)
+	}
+	return nil
+}
+
+// Commit 把证书写进区块头，唤醒等待的 Seal 并通知订阅者；core 在它自己的锁外调用，
+// 订阅者可以拿链的锁导入区块
+func (b *BFT) Commit(header *block.Header, body *block.Body, cert *Certificate) {
+	committed := *header
+	if err := EncodeCertificate(&committed, cert); err != nil {
+		return
+	}
+	b.lock.Lock()
+	b.committed = &committed
+	wait := b.waiters[header.Height]
+	hook := b.onCommit
+	b.lock.Unlock()
+	if wait != nil {
+		wait <- &committed
+	}
+	if hook != nil {
+		hook(&committed, body)
+	}
+}
@@ -0,0 +1,107 @@
+package bft
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 超时都通过它调度，测试里换成 MockClock 就能确定性地推进时间
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer 已调度的超时
+type Timer interface {
+	Stop() bool
+}
+
+// SystemClock 使用真实时间
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// MockClock 手动推进的时钟，到期的回调在 Advance 的调用方协程里按到期顺序同步执行
+type MockClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*mockTimer
+	seq    uint64
+}
+
+type mockTimer struct {
+	clock   *MockClock
+	at      time.Time
+	seq     uint64 //同一时刻到期的按调度顺序执行
+	f       func()
+	stopped bool
+}
+
+// NewMockClock creates a mock clock starting at the given time
+func NewMockClock(start time.Time) *MockClock {
+	return &MockClock{now: start}
+}
+
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *MockClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &mockTimer{clock: c, at: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward, firing every timer that becomes due
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.Slice(c.timers, func(i, j int) bool {
+			if c.timers[i].at.Equal(c.timers[j].at) {
+				return c.timers[i].seq < c.timers[j].seq
+			}
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(target) {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		c.mu.Unlock()
+		//回调里可能再调度新的超时，所以不能持有锁
+		if !t.stopped {
+			t.f()
+		}
+	}
+}
+
+// Pending returns the number of timers not yet fired
+func (c *MockClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *mockTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
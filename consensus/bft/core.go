@@ -0,0 +1,455 @@
+package bft
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Backend core 和链之间的接口：向它要提议的区块、校验别人的提议、交付已最终确认的区块
+type Backend interface {
+	BuildProposal(height uint64) (*block.Header, *block.Body, error)
+	VerifyProposal(header *block.Header, body *block.Body) error
+	Commit(header *block.Header, body *block.Body, cert *Certificate)
+}
+
+type step uint8
+
+const (
+	stepPropose step = iota
+	stepPrevote
+	stepPrecommit
+)
+
+// roundState 某一轮收到的消息
+type roundState struct {
+	proposal   *Message
+	prevotes   map[common.Address]*Message
+	precommits map[common.Address]*Message
+
+	prevoteWait   bool //已经调度过 timeoutPrevote
+	precommitWait bool //已经调度过 timeoutPrecommit
+	polSeen       bool //已经处理过“提议+2/3预投票”
+	proposed      bool //本节点已经在这一轮广播过提议
+}
+
+func newRoundState() *roundState {
+	return &roundState{
+		prevotes:   make(map[common.Address]*Message),
+		precommits: make(map[common.Address]*Message),
+	}
+}
+
+// Core Tendermint 的 propose/prevote/precommit 状态机，单个验证者一份。
+// 所有入口都持有同一把锁，消息和超时的处理顺序完全由 Transport 和 Clock 决定；
+// 最终确认的区块在释放这把锁之后才交给 backend，见 deliver
+type Core struct {
+	mu sync.Mutex
+
+	config     *Config
+	validators *ValidatorSet
+	self       common.Address
+	signFn     consensus.SignerFn
+	clock      Clock
+	transport  Transport
+	backend    Backend
+
+	running bool
+	height  uint64
+	round   uint64
+	step    step
+
+	lockedRound int64
+	lockedValue *Message //锁定的提议
+	validRound  int64
+	validValue  *Message
+
+	rounds map[uint64]*roundState
+	valid  map[common.Hash]error //提议校验结果缓存
+	future []*Message            //更高高度的消息，进入该高度后重放
+
+	decided    *decision //已经确认、还没交付的区块，交付完才进入下一个高度
+	delivering bool      //有协程正在交付 decided
+}
+
+// decision 一个高度最终确认的区块和它的提交证书
+type decision struct {
+	header *block.Header
+	body   *block.Body
+	cert   *Certificate
+}
+
+// NewCore creates the consensus state machine of one validator
+func NewCore(config *Config, self common.Address, signFn consensus.SignerFn, clock Clock, transport Transport, backend Backend) *Core {
+	c := &Core{
+		config:     config,
+		validators: NewValidatorSet(config.Validators),
+		self:       self,
+		signFn:     signFn,
+		clock:      clock,
+		transport:  transport,
+		backend:    backend,
+	}
+	transport.Subscribe(c.HandleMessage)
+	return c
+}
+
+// Start begins consensus at the given height
+func (c *Core) Start(height uint64) {
+	defer c.deliver()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = true
+	c.startHeight(height)
+}
+
+// Stop halts the state machine, pending timeouts become no-ops
+func (c *Core) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+}
+
+// State returns the current height, round and step, for tests and monitoring
+func (c *Core) State() (uint64, uint64, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height, c.round, [...]string{"propose", "prevote", "precommit"}[c.step]
+}
+
+// HandleMessage 处理一条来自网络的共识消息
+func (c *Core) HandleMessage(msg *Message) {
+	defer c.deliver()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running {
+		return
+	}
+	if err := c.validators.verifyMessage(msg); err != nil {
+		return
+	}
+	if msg.Height > c.height {
+		c.future = append(c.future, msg)
+		return
+	}
+	if msg.Height < c.height {
+		return
+	}
+	c.addMessage(msg)
+	c.process()
+}
+
+func (c *Core) startHeight(height uint64) {
+	c.height = height
+	c.decided = nil
+	c.lockedRound, c.lockedValue = -1, nil
+	c.validRound, c.validValue = -1, nil
+	c.rounds = make(map[uint64]*roundState)
+	c.valid = make(map[common.Hash]error)
+	c.startRound(0)
+
+	future := c.future
+	c.future = nil
+	for _, msg := range future {
+		if msg.Height == height {
+			c.addMessage(msg)
+		} else if msg.Height > height {
+			c.future = append(c.future, msg)
+		}
+	}
+	c.process()
+}
+
+func (c *Core) startRound(round uint64) {
+	c.round = round
+	c.step = stepPropose
+	c.propose()
+	height := c.height
+	c.schedule(c.config.timeout(c.config.TimeoutPropose, round), func() { c.onTimeoutPropose(height, round) })
+}
+
+// propose 轮到本节点提议、本轮还没提议过时广播提议；没有待提议的区块就等 NewCandidate
+func (c *Core) propose() {
+	rs := c.roundState(c.round)
+	if rs.proposed || c.step != stepPropose || c.validators.Proposer(c.height, c.round) != c.self {
+		return
+	}
+	header, body := c.proposalValue()
+	if header == nil {
+		return
+	}
+	rs.proposed = true
+	c.broadcast(&Message{
+		Type:       MsgProposal,
+		Height:     c.height,
+		Round:      c.round,
+		BlockHash:  SealHash(header),
+		ValidRound: c.validRound,
+		Header:     header,
+		Body:       body,
+	})
+}
+
+// NewCandidate tells the core a block for height became available after the round started,
+// so the proposer of the current round does not have to wait for the next one.
+// The caller may hold the lock of its chain, a block decided here is delivered from another goroutine
+func (c *Core) NewCandidate(height uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running || height != c.height || c.decided != nil {
+		return
+	}
+	c.propose()
+	c.process()
+	if c.decided != nil {
+		go c.deliver()
+	}
+}
+
+// deliver 在不持有 c.mu 的情况下把确认的区块交给 backend，交付完再进入下一个高度。
+// backend 导入区块时要拿链的锁，而本节点 Seal 持有链的锁调用 NewCandidate，
+// 在 c.mu 里交付两边会互相等待；下一个高度也要等区块上链后才能校验提议
+func (c *Core) deliver() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.decided != nil && !c.delivering {
+		d := c.decided
+		c.delivering = true
+		c.mu.Unlock()
+		c.backend.Commit(d.header, d.body, d.cert)
+		c.mu.Lock()
+		c.delivering = false
+		if c.decided == d {
+			c.startHeight(d.cert.Height + 1)
+		}
+	}
+}
+
+// proposalValue 有 validValue 时必须重新提议它，否则向 backend 要新区块
+func (c *Core) proposalValue() (*block.Header, *block.Body) {
+	if c.validValue != nil {
+		return c.validValue.Header, c.validValue.Body
+	}
+	header, body, err := c.backend.BuildProposal(c.height)
+	if err != nil {
+		fmt.Println("bft: 构造提议失败:", err)
+		return nil, nil
+	}
+	return header, body
+}
+
+func (c *Core) roundState(round uint64) *roundState {
+	rs, ok := c.rounds[round]
+	if !ok {
+		rs = newRoundState()
+		c.rounds[round] = rs
+	}
+	return rs
+}
+
+func (c *Core) addMessage(msg *Message) {
+	rs := c.roundState(msg.Round)
+	switch msg.Type {
+	case MsgProposal:
+		if rs.proposal == nil {
+			rs.proposal = msg
+		}
+	case MsgPrevote:
+		if _, ok := rs.prevotes[msg.Validator]; !ok {
+			rs.prevotes[msg.Validator] = msg
+		}
+	case MsgPrecommit:
+		if _, ok := rs.precommits[msg.Validator]; !ok {
+			rs.precommits[msg.Validator] = msg
+		}
+	}
+}
+
+func count(votes map[common.Address]*Message, hash common.Hash) int {
+	n := 0
+	for _, vote := range votes {
+		if vote.BlockHash == hash {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Core) isValid(proposal *Message) bool {
+	err, ok := c.valid[proposal.BlockHash]
+	if !ok {
+		err = c.backend.VerifyProposal(proposal.Header, proposal.Body)
+		c.valid[proposal.BlockHash] = err
+	}
+	return err == nil
+}
+
+// process 反复检查各条规则，直到状态不再变化；本高度已经确认时等交付完再继续
+func (c *Core) process() {
+	for c.running && c.decided == nil && c.applyRules() {
+	}
+}
+
+func (c *Core) applyRules() bool {
+	quorum := c.validators.Quorum()
+
+	// 任意一轮里提议+2/3预提交：最终确认
+	for round, rs := range c.rounds {
+		if p := rs.proposal; p != nil && count(rs.precommits, p.BlockHash) >= quorum && c.isValid(p) {
+			c.decide(round, p)
+			return true
+		}
+	}
+
+	// 看到更高轮次里f+1个验证者的消息，说明自己落后了，直接跳到其中最高的一轮
+	skip, found := c.round, false
+	for round, rs := range c.rounds {
+		if round <= skip {
+			continue
+		}
+		senders := make(map[common.Address]bool)
+		for v := range rs.prevotes {
+			senders[v] = true
+		}
+		for v := range rs.precommits {
+			senders[v] = true
+		}
+		if rs.proposal != nil {
+			senders[rs.proposal.Validator] = true
+		}
+		if len(senders) > c.validators.FaultTolerance() {
+			skip, found = round, true
+		}
+	}
+	if found {
+		c.startRound(skip)
+		return true
+	}
+
+	rs := c.roundState(c.round)
+	p := rs.proposal
+
+	if c.step == stepPropose && p != nil {
+		if p.ValidRound < 0 {
+			vote := common.Hash{}
+			if c.isValid(p) && (c.lockedRound == -1 || c.lockedValue.BlockHash == p.BlockHash) {
+				vote = p.BlockHash
+			}
+			c.vote(MsgPrevote, vote)
+			c.step = stepPrevote
+			return true
+		}
+		if vr := uint64(p.ValidRound); vr < c.round {
+			if pol, ok := c.rounds[vr]; ok && count(pol.prevotes, p.BlockHash) >= quorum {
+				vote := common.Hash{}
+				if c.isValid(p) && (c.lockedRound <= p.ValidRound || c.lockedValue.BlockHash == p.BlockHash) {
+					vote = p.BlockHash
+				}
+				c.vote(MsgPrevote, vote)
+				c.step = stepPrevote
+				return true
+			}
+		}
+	}
+
+	if c.step == stepPrevote && len(rs.prevotes) >= quorum && !rs.prevoteWait {
+		rs.prevoteWait = true
+		height, round := c.height, c.round
+		c.schedule(c.config.timeout(c.config.TimeoutPrevote, round), func() { c.onTimeoutPrevote(height, round) })
+	}
+
+	if c.step >= stepPrevote && p != nil && !rs.polSeen && count(rs.prevotes, p.BlockHash) >= quorum && c.isValid(p) {
+		rs.polSeen = true
+		if c.step == stepPrevote {
+			c.lockedRound, c.lockedValue = int64(c.round), p
+			c.vote(MsgPrecommit, p.BlockHash)
+			c.step = stepPrecommit
+		}
+		c.validRound, c.validValue = int64(c.round), p
+		return true
+	}
+
+	if c.step == stepPrevote && count(rs.prevotes, common.Hash{}) >= quorum {
+		c.vote(MsgPrecommit, common.Hash{})
+		c.step = stepPrecommit
+		return true
+	}
+
+	if len(rs.precommits) >= quorum && !rs.precommitWait {
+		rs.precommitWait = true
+		height, round := c.height, c.round
+		c.schedule(c.config.timeout(c.config.TimeoutPrecommit, round), func() { c.onTimeoutPrecommit(height, round) })
+	}
+	return false
+}
+
+// decide 收集预提交签名组成证书，等 deliver 在锁外交给 backend
+func (c *Core) decide(round uint64, proposal *Message) {
+	cert := &Certificate{Height: c.height, Round: round, BlockHash: proposal.BlockHash}
+	for _, validator := range c.validators.List() {
+		if vote, ok := c.rounds[round].precommits[validator]; ok && vote.BlockHash == proposal.BlockHash {
+			cert.Signatures = append(cert.Signatures, CommitSig{Validator: validator, Signature: vote.Signature})
+		}
+	}
+	c.decided = &decision{header: proposal.Header, body: proposal.Body, cert: cert}
+}
+
+func (c *Core) onTimeoutPropose(height, round uint64) {
+	defer c.deliver()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running || c.decided != nil || height != c.height || round != c.round || c.step != stepPropose {
+		return
+	}
+	c.vote(MsgPrevote, common.Hash{})
+	c.step = stepPrevote
+	c.process()
+}
+
+func (c *Core) onTimeoutPrevote(height, round uint64) {
+	defer c.deliver()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running || c.decided != nil || height != c.height || round != c.round || c.step != stepPrevote {
+		return
+	}
+	c.vote(MsgPrecommit, common.Hash{})
+	c.step = stepPrecommit
+	c.process()
+}
+
+func (c *Core) onTimeoutPrecommit(height, round uint64) {
+	defer c.deliver()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running || c.decided != nil || height != c.height || round != c.round {
+		return
+	}
+	c.startRound(round + 1)
+	c.process()
+}
+
+func (c *Core) vote(t MsgType, hash common.Hash) {
+	c.broadcast(&Message{Type: t, Height: c.height, Round: c.round, BlockHash: hash})
+}
+
+// broadcast 签名后发出，自己的消息也经由网络回到 HandleMessage
+func (c *Core) broadcast(msg *Message) {
+	msg.Validator = c.self
+	sig, err := c.signFn(c.self, msg.payload())
+	if err != nil {
+		fmt.Println("bft: 签名失败:", err)
+		return
+	}
+	msg.Signature = sig
+	if err := c.transport.Broadcast(msg); err != nil {
+		fmt.Println("bft: 广播失败:", err)
+	}
+}
+
+func (c *Core) schedule(d time.Duration, f func()) {
+	c.clock.AfterFunc(d, f)
+}
@@ -0,0 +1,201 @@
+package bft
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// MsgType 共识消息的类型
+type MsgType uint8
+
+const (
+	MsgProposal MsgType = iota
+	MsgPrevote
+	MsgPrecommit
+)
+
+func (t MsgType) String() string {
+	switch t {
+	case MsgProposal:
+		return "proposal"
+	case MsgPrevote:
+		return "prevote"
+	case MsgPrecommit:
+		return "precommit"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+var (
+	errInvalidSignature = errors.New("invalid message signature")
+	errNotValidator     = errors.New("sender is not a validator")
+	errNotProposer      = errors.New("proposal from wrong proposer")
+	errProposalMismatch = errors.New("proposal hash does not match block")
+	errInsufficientVote = errors.New("commit certificate lacks 2/3+ precommits")
+	errMissingCert      = errors.New("missing commit certificate")
+)
+
+// Message 提议、预投票或预提交；投票的 BlockHash 为零表示投 nil
+type Message struct {
+	Type       MsgType
+	Height     uint64
+	Round      uint64
+	BlockHash  common.Hash
+	ValidRound int64 //只对提议有意义，-1 表示全新的提议
+
+	Header *block.Header //只有提议携带区块
+	Body   *block.Body
+
+	Validator common.Address
+	Signature []byte
+}
+
+// payload 签名覆盖的内容
+func (m *Message) payload() []byte {
+	return votePayload(m.Type, m.Height, m.Round, m.BlockHash, m.ValidRound)
+}
+
+func votePayload(t MsgType, height, round uint64, hash common.Hash, validRound int64) []byte {
+	data, _ := rlp.EncodeToBytes([]interface{}{uint8(t), height, round, hash, uint64(validRound + 1)})
+	return common.Hash{}.NewHash(data).Bytes()
+}
+
+// SealHash 提议和投票所针对的区块哈希，不含 ExtraData 中的提交证书
+func SealHash(header *block.Header) common.Hash {
+	cpy := *header
+	cpy.ExtraData = nil
+	return cpy.Hash()
+}
+
+// CommitSig 一个验证者对区块的预提交签名
+type CommitSig struct {
+	Validator common.Address
+	Signature []byte
+}
+
+// Certificate 提交证书：同一轮里超过2/3验证者对同一区块的预提交签名
+type Certificate struct {
+	Height     uint64
+	Round      uint64
+	BlockHash  common.Hash
+	Signatures []CommitSig
+}
+
+// EncodeCertificate 把证书写进区块头的 ExtraData，和区块一起存储和传播
+func EncodeCertificate(header *block.Header, cert *Certificate) error {
+	data, err := rlp.EncodeToBytes(cert)
+	if err != nil {
+		return err
+	}
+	header.ExtraData = data
+	return nil
+}
+
+// DecodeCertificate 从区块头中取出提交证书
+func DecodeCertificate(header *block.Header) (*Certificate, error) {
+	if len(header.ExtraData) == 0 {
+		return nil, errMissingCert
+	}
+	cert := new(Certificate)
+	if err := rlp.DecodeBytes(header.ExtraData, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// ValidatorSet 固定的验证者集合，按地址排序后轮流担任提议者
+type ValidatorSet struct {
+	validators []common.Address
+	index      map[common.Address]int
+}
+
+// NewValidatorSet creates a validator set from the chain config
+func NewValidatorSet(validators []common.Address) *ValidatorSet {
+	sorted := append([]common.Address{}, validators...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+	index := make(map[common.Address]int, len(sorted))
+	for i, v := range sorted {
+		index[v] = i
+	}
+	return &ValidatorSet{validators: sorted, index: index}
+}
+
+func (vs *ValidatorSet) Size() int { return len(vs.validators) }
+
+func (vs *ValidatorSet) Contains(addr common.Address) bool {
+	_, ok := vs.index[addr]
+	return ok
+}
+
+// List returns the validators in proposer order
+func (vs *ValidatorSet) List() []common.Address {
+	return append([]common.Address{}, vs.validators...)
+}
+
+// Quorum 超过2/3所需的票数
+func (vs *ValidatorSet) Quorum() int {
+	return 2*len(vs.validators)/3 + 1
+}
+
+// FaultTolerance 最多可容忍的拜占庭节点数f，f+1票意味着至少一个诚实节点
+func (vs *ValidatorSet) FaultTolerance() int {
+	return (len(vs.validators) - 1) / 3
+}
+
+// Proposer 某高度某轮的提议者
+func (vs *ValidatorSet) Proposer(height, round uint64) common.Address {
+	return vs.validators[(height+round)%uint64(len(vs.validators))]
+}
+
+// verifyMessage 检查消息签名来自声明的验证者
+func (vs *ValidatorSet) verifyMessage(msg *Message) error {
+	if !vs.Contains(msg.Validator) {
+		return errNotValidator
+	}
+	signer, err := consensus.Ecrecover(msg.payload(), msg.Signature)
+	if err != nil || signer != msg.Validator {
+		return errInvalidSignature
+	}
+	if msg.Type == MsgProposal {
+		if msg.Validator != vs.Proposer(msg.Height, msg.Round) {
+			return errNotProposer
+		}
+		if msg.Header == nil || SealHash(msg.Header) != msg.BlockHash {
+			return errProposalMismatch
+		}
+	}
+	return nil
+}
+
+// VerifyCertificate 检查证书里有足够多不同验证者对该区块的有效预提交
+func (vs *ValidatorSet) VerifyCertificate(cert *Certificate, height uint64, hash common.Hash) error {
+	if cert.Height != height || cert.BlockHash != hash {
+		return errProposalMismatch
+	}
+	seen := make(map[common.Address]bool)
+	for _, sig := range cert.Signatures {
+		if !vs.Contains(sig.Validator) || seen[sig.Validator] {
+			continue
+		}
+		payload := votePayload(MsgPrecommit, cert.Height, cert.Round, cert.BlockHash, 0)
+		signer, err := consensus.Ecrecover(payload, sig.Signature)
+		if err != nil || signer != sig.Validator {
+			return errInvalidSignature
+		}
+		seen[sig.Validator] = true
+	}
+	if len(seen) < vs.Quorum() {
+		return errInsufficientVote
+	}
+	return nil
+}
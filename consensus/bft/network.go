@@ -0,0 +1,97 @@
+package bft
+
+import (
+	"blockchain/common"
+	"sync"
+)
+
+// Transport 共识消息的传输层，Broadcast 必须把消息也投递给发送者自己
+type Transport interface {
+	Broadcast(msg *Message) error
+	Subscribe(handler func(msg *Message))
+}
+
+// Network 进程内的模拟网络：消息先排队，由测试调用 Flush 按先进先出的顺序投递，
+// 可以让某些节点掉线来模拟故障
+type Network struct {
+	mu      sync.Mutex
+	queue   []*envelope
+	peers   []*memTransport
+	offline map[common.Address]bool
+}
+
+type envelope struct {
+	from common.Address
+	msg  *Message
+}
+
+type memTransport struct {
+	network *Network
+	self    common.Address
+	handler func(msg *Message)
+}
+
+// NewNetwork creates an empty simulated network
+func NewNetwork() *Network {
+	return &Network{offline: make(map[common.Address]bool)}
+}
+
+// Join attaches a validator to the network and returns its transport
+func (n *Network) Join(self common.Address) Transport {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t := &memTransport{network: n, self: self}
+	n.peers = append(n.peers, t)
+	return t
+}
+
+// SetOffline drops every message sent by or to the validator while offline
+func (n *Network) SetOffline(validator common.Address, offline bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.offline[validator] = offline
+}
+
+// Flush delivers queued messages until the network is quiet, returning how many were delivered
+func (n *Network) Flush() int {
+	delivered := 0
+	for {
+		n.mu.Lock()
+		if len(n.queue) == 0 {
+			n.mu.Unlock()
+			return delivered
+		}
+		env := n.queue[0]
+		n.queue = n.queue[1:]
+		peers := append([]*memTransport{}, n.peers...)
+		offline := n.offline[env.from]
+		n.mu.Unlock()
+
+		if offline {
+			continue
+		}
+		for _, peer := range peers {
+			n.mu.Lock()
+			skip := n.offline[peer.self] || peer.handler == nil
+			n.mu.Unlock()
+			if skip {
+				continue
+			}
+			peer.handler(env.msg)
+			delivered++
+		}
+	}
+}
+
+func (t *memTransport) Broadcast(msg *Message) error {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	t.network.queue = append(t.network.queue, &envelope{from: t.self, msg: msg})
+	return nil
+}
+
+func (t *memTransport) Subscribe(handler func(msg *Message)) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	t.handler = handler
+}
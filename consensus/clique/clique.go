@@ -0,0 +1,407 @@
+package clique
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/mpt"
+	"blockchain/vm"
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	extraVanity = 32 //ExtraData开头留给出块者自定义的字节数
+	extraSeal   = 65 //ExtraData结尾的secp256k1签名长度
+
+	nonceAuthVote = uint64(0xffffffffffffffff) //投票加入coinbase
+	nonceDropVote = uint64(0)                  //投票踢出coinbase
+
+	diffInTurn = uint64(2) //轮到自己出块时的难度
+	diffNoTurn = uint64(1) //抢着出块时的难度
+
+	wiggleTime = 500 * time.Millisecond //非轮值签名者每多一个签名者随机推迟的时长
+)
+
+var (
+	errMissingVanity            = errors.New("extra-data 32 byte vanity prefix missing")
+	errMissingSignature         = errors.New("extra-data 65 byte signature suffix missing")
+	errExtraSigners             = errors.New("non-checkpoint block contains extra signer list")
+	errInvalidCheckpointSigners = errors.New("invalid signer list on checkpoint block")
+	errInvalidCheckpointVote    = errors.New("vote nonce in checkpoint block non-zero")
+	errInvalidVote              = errors.New("vote nonce not 0x00..0 or 0xff..f")
+	errInvalidDifficulty        = errors.New("invalid difficulty")
+	errInvalidPeriod            = errors.New("block timestamp too close to parent")
+	errUnauthorizedSigner       = errors.New("unauthorized signer")
+	errRecentlySigned           = errors.New("recently signed")
+	errNoSigner                 = errors.New("no signer authorized")
+)
+
+// Config poa链的参数
+type Config struct {
+	Period  uint64           //两个区块之间的最短间隔（秒）
+	Epoch   uint64           //多少个区块做一次检查点：清空投票并持久化签名者快照
+	Signers []common.Address //创世区块里的初始签名者
+}
+
+// Clique 基于授权签名者轮流出块的poa引擎，签名者的增减通过区块头投票完成
+type Clique struct {
+	config *Config
+	db     *mpt.DB //检查点快照的持久化位置
+
+	lock      sync.RWMutex
+	snapshots map[common.Hash]*Snapshot //最近用到的快照
+	proposals map[common.Address]bool   //本节点想投的票，true为加入
+
+	signer common.Address
+	signFn consensus.SignerFn
+}
+
+// New creates a proof-of-authority engine persisting checkpoint snapshots into db
+func New(config *Config, db *mpt.DB) *Clique {
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = 30000
+	}
+	return &Clique{
+		config:    &conf,
+		db:        db,
+		snapshots: make(map[common.Hash]*Snapshot),
+		proposals: make(map[common.Address]bool),
+	}
+}
+
+var _ consensus.Engine = (*Clique)(nil)
+
+// Authorize sets the local signer used when sealing blocks
+func (c *Clique) Authorize(signer common.Address, signFn consensus.SignerFn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.signer = signer
+	c.signFn = signFn
+}
+
+// Propose queues a vote to add (auth true) or remove a signer in blocks we seal
+func (c *Clique) Propose(address common.Address, auth bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.proposals[address] = auth
+}
+
+// Discard drops a pending proposal
+func (c *Clique) Discard(address common.Address) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.proposals, address)
+}
+
+// SealHash 签名所覆盖的哈希，即去掉结尾签名后的区块头哈希
+func SealHash(header *block.Header) common.Hash {
+	cpy := *header
+	if len(cpy.ExtraData) >= extraSeal {
+		cpy.ExtraData = cpy.ExtraData[:len(cpy.ExtraData)-extraSeal]
+	}
+	return cpy.Hash()
+}
+
+// ecrecover 从区块头的签名中恢复签名者地址
+func ecrecover(header *block.Header) (common.Address, error) {
+	if len(header.ExtraData) < extraSeal {
+		return common.Address{}, errMissingSignature
+	}
+	signature := header.ExtraData[len(header.ExtraData)-extraSeal:]
+	return consensus.Ecrecover(SealHash(header).Bytes(), signature)
+}
+
+// genesisSigners 解析创世区块ExtraData里的签名者列表
+func genesisSigners(header *block.Header) ([]common.Address, error) {
+	if len(header.ExtraData) < extraVanity {
+		return nil, errMissingVanity
+	}
+	list := header.ExtraData[extraVanity:]
+	if len(list)%common.AddressLength != 0 {
+		return nil, errInvalidCheckpointSigners
+	}
+	signers := make([]common.Address, len(list)/common.AddressLength)
+	for i := range signers {
+		copy(signers[i][:], list[i*common.AddressLength:])
+	}
+	return signers, nil
+}
+
+func (c *Clique) Author(header *block.Header) (common.Address, error) {
+	return ecrecover(header)
+}
+
+func (c *Clique) VerifyHeader(chain consensus.ChainReader, header *block.Header) error {
+	if header.Height == 0 {
+		signers, err := genesisSigners(header)
+		if err != nil {
+			return err
+		}
+		snap := newSnapshot(c.config, 0, header.Hash(), c.config.Signers)
+		if !sameSigners(signers, snap.SignerList()) {
+			return errInvalidCheckpointSigners
+		}
+		return nil
+	}
+	parent, err := consensus.VerifyParent(chain, header)
+	if err != nil {
+		return err
+	}
+	if header.Timestamp < parent.Timestamp+c.config.Period {
+		return errInvalidPeriod
+	}
+	checkpoint := header.Height%c.config.Epoch == 0
+	if checkpoint && header.Nonce != nonceDropVote {
+		return errInvalidCheckpointVote
+	}
+	if header.Nonce != nonceAuthVote && header.Nonce != nonceDropVote {
+		return errInvalidVote
+	}
+	if len(header.ExtraData) < extraVanity {
+		return errMissingVanity
+	}
+	if len(header.ExtraData) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	signersBytes := len(header.ExtraData) - extraVanity - extraSeal
+	if !checkpoint && signersBytes != 0 {
+		return errExtraSigners
+	}
+	if checkpoint && signersBytes%common.AddressLength != 0 {
+		return errInvalidCheckpointSigners
+	}
+
+	snap, err := c.snapshot(chain, header.Height-1, header.ParentHash)
+	if err != nil {
+		return err
+	}
+	// 检查点区块携带的签名者列表必须和快照一致
+	if checkpoint {
+		list := header.ExtraData[extraVanity : extraVanity+signersBytes]
+		if !bytes.Equal(list, signersToBytes(snap.SignerList())) {
+			return errInvalidCheckpointSigners
+		}
+	}
+	signer, err := ecrecover(header)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Signers[signer]; !ok {
+		return errUnauthorizedSigner
+	}
+	for seen, recent := range snap.Recents {
+		if recent == signer {
+			if limit := uint64(len(snap.Signers)/2 + 1); header.Height < limit || seen > header.Height-limit {
+				return errRecentlySigned
+			}
+		}
+	}
+	inturn := snap.inturn(header.Height, signer)
+	if inturn && header.Difficulty != diffInTurn {
+		return errInvalidDifficulty
+	}
+	if !inturn && header.Difficulty != diffNoTurn {
+		return errInvalidDifficulty
+	}
+	return nil
+}
+
+func (c *Clique) Prepare(chain consensus.ChainReader, header *block.Header) error {
+	vanity := make([]byte, extraVanity)
+	if header.Height == 0 {
+		//创世区块只记录初始签名者，不需要签名
+		snap := newSnapshot(c.config, 0, common.Hash{}, c.config.Signers)
+		header.ExtraData = append(vanity, signersToBytes(snap.SignerList())...)
+		header.Coinbase = common.Address{}
+		header.Nonce = nonceDropVote
+		return nil
+	}
+	header.Coinbase = common.Address{}
+	header.Nonce = nonceDropVote
+
+	snap, err := c.snapshot(chain, header.Height-1, header.ParentHash)
+	if err != nil {
+		return err
+	}
+	checkpoint := header.Height%c.config.Epoch == 0
+	if !checkpoint {
+		c.lock.RLock()
+		addresses := make([]common.Address, 0, len(c.proposals))
+		for address, authorize := range c.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if c.proposals[header.Coinbase] {
+				header.Nonce = nonceAuthVote
+			}
+		}
+		c.lock.RUnlock()
+	}
+
+	c.lock.RLock()
+	signer := c.signer
+	c.lock.RUnlock()
+	header.Difficulty = diffNoTurn
+	if snap.inturn(header.Height, signer) {
+		header.Difficulty = diffInTurn
+	}
+
+	header.ExtraData = vanity
+	if checkpoint {
+		header.ExtraData = append(header.ExtraData, signersToBytes(snap.SignerList())...)
+	}
+	header.ExtraData = append(header.ExtraData, make([]byte, extraSeal)...)
+
+	parent := chain.GetHeaderByHash(header.ParentHash)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	if min := parent.Timestamp + c.config.Period; header.Timestamp < min {
+		header.Timestamp = min
+	}
+	return nil
+}
+
+// Finalize poa没有出块奖励，coinbase被用作投票对象
+func (c *Clique) Finalize(chain consensus.ChainReader, header *block.Header, state *vm.VM, body *block.Body) error {
+	return nil
+}
+
+func (c *Clique) Seal(chain consensus.ChainReader, header *block.Header, body *block.Body, stop <-chan struct{}) (*block.Header, error) {
+	sealed := *header
+	if sealed.Height == 0 {
+		return &sealed, nil
+	}
+	c.lock.RLock()
+	signer, signFn := c.signer, c.signFn
+	c.lock.RUnlock()
+	if signFn == nil {
+		return nil, errNoSigner
+	}
+
+	snap, err := c.snapshot(chain, sealed.Height-1, sealed.ParentHash)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := snap.Signers[signer]; !ok {
+		return nil, errUnauthorizedSigner
+	}
+	for seen, recent := range snap.Recents {
+		if recent == signer {
+			if limit := uint64(len(snap.Signers)/2 + 1); sealed.Height < limit || seen > sealed.Height-limit {
+				return nil, errRecentlySigned
+			}
+		}
+	}
+
+	// 等到出块时间，不在轮值上的签名者再随机推迟一会，减少同时出块
+	delay := time.Until(time.Unix(int64(sealed.Timestamp), 0))
+	if sealed.Difficulty == diffNoTurn {
+		wiggle := time.Duration(len(snap.Signers)/2+1) * wiggleTime
+		delay += time.Duration(rand.Int63n(int64(wiggle)))
+	}
+	if delay > 0 {
+		select {
+		case <-stop:
+			return nil, consensus.ErrStopped
+		case <-time.After(delay):
+		}
+	}
+
+	sighash, err := signFn(signer, SealHash(&sealed).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	sealed.ExtraData = append([]byte{}, sealed.ExtraData...)
+	copy(sealed.ExtraData[len(sealed.ExtraData)-extraSeal:], sighash)
+	return &sealed, nil
+}
+
+// GetSnapshot returns the signer snapshot after the given block
+func (c *Clique) GetSnapshot(chain consensus.ChainReader, number uint64, hash common.Hash) (*Snapshot, error) {
+	return c.snapshot(chain, number, hash)
+}
+
+// snapshot 找到最近的已知快照（内存、数据库检查点或创世区块），再把之后的区块头应用上去
+func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash) (*Snapshot, error) {
+	var (
+		headers []*block.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		c.lock.RLock()
+		s, ok := c.snapshots[hash]
+		c.lock.RUnlock()
+		if ok {
+			snap = s
+			break
+		}
+		if number%c.config.Epoch == 0 && c.db != nil {
+			if s, err := loadSnapshot(c.config, c.db, hash); err == nil {
+				snap = s
+				break
+			}
+		}
+		if number == 0 {
+			genesis := chain.GetHeaderByHeight(0)
+			if genesis == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			signers, err := genesisSigners(genesis)
+			if err != nil {
+				return nil, err
+			}
+			snap = newSnapshot(c.config, 0, genesis.Hash(), signers)
+			if c.db != nil {
+				if err := snap.store(c.db); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		header := chain.GetHeaderByHash(hash)
+		if header == nil || header.Height != number {
+			return nil, consensus.ErrUnknownAncestor
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// 收集的区块头是倒序的
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.snapshots[snap.Hash] = snap
+	c.lock.Unlock()
+
+	if len(headers) > 0 && snap.Number%c.config.Epoch == 0 && c.db != nil {
+		if err := snap.store(c.db); err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+func signersToBytes(signers []common.Address) []byte {
+	data := make([]byte, 0, len(signers)*common.AddressLength)
+	for _, signer := range signers {
+		data = append(data, signer[:]...)
+	}
+	return data
+}
+
+func sameSigners(a, b []common.Address) bool {
+	return bytes.Equal(signersToBytes(a), signersToBytes(b))
+}
@@ -0,0 +1,262 @@
+package clique
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/mpt"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// Vote 某个签名者在某个区块里投出的一票
+type Vote struct {
+	Signer    common.Address `json:"signer"`    //投票的签名者
+	Block     uint64         `json:"block"`     //投票所在区块高度
+	Address   common.Address `json:"address"`   //被投票的账户
+	Authorize bool           `json:"authorize"` //加入还是踢出
+}
+
+// Tally 对某个账户的计票
+type Tally struct {
+	Authorize bool `json:"authorize"`
+	Votes     int  `json:"votes"`
+}
+
+// Snapshot 某个区块处的授权状态
+type Snapshot struct {
+	config *Config
+
+	Number  uint64                      `json:"number"`
+	Hash    common.Hash                 `json:"hash"`
+	Signers map[common.Address]struct{} `json:"signers"`
+	Recents map[uint64]common.Address   `json:"recents"` //最近出块的签名者，用于防止同一个人连续出块
+	Votes   []*Vote                     `json:"votes"`
+	Tally   map[common.Address]Tally    `json:"tally"`
+}
+
+var errInvalidVotingChain = errors.New("invalid voting chain")
+
+func newSnapshot(config *Config, number uint64, hash common.Hash, signers []common.Address) *Snapshot {
+	snap := &Snapshot{
+		config:  config,
+		Number:  number,
+		Hash:    hash,
+		Signers: make(map[common.Address]struct{}),
+		Recents: make(map[uint64]common.Address),
+		Tally:   make(map[common.Address]Tally),
+	}
+	for _, signer := range signers {
+		snap.Signers[signer] = struct{}{}
+	}
+	return snap
+}
+
+func snapshotKey(hash common.Hash) []byte {
+	return append([]byte("clique-"), hash[:]...)
+}
+
+// loadSnapshot 从数据库读取检查点快照
+func loadSnapshot(config *Config, db *mpt.DB, hash common.Hash) (*Snapshot, error) {
+	data, err := db.Get(snapshotKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	snap.config = config
+	return snap, nil
+}
+
+// store 把快照写入数据库
+func (s *Snapshot) store(db *mpt.DB) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.Put(snapshotKey(s.Hash), data)
+}
+
+func (s *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		config:  s.config,
+		Number:  s.Number,
+		Hash:    s.Hash,
+		Signers: make(map[common.Address]struct{}),
+		Recents: make(map[uint64]common.Address),
+		Votes:   make([]*Vote, len(s.Votes)),
+		Tally:   make(map[common.Address]Tally),
+	}
+	for signer := range s.Signers {
+		cpy.Signers[signer] = struct{}{}
+	}
+	for block, signer := range s.Recents {
+		cpy.Recents[block] = signer
+	}
+	for address, tally := range s.Tally {
+		cpy.Tally[address] = tally
+	}
+	copy(cpy.Votes, s.Votes)
+	return cpy
+}
+
+// validVote 只有加入非签名者或踢出签名者的票才有意义
+func (s *Snapshot) validVote(address common.Address, authorize bool) bool {
+	_, signer := s.Signers[address]
+	return (signer && !authorize) || (!signer && authorize)
+}
+
+func (s *Snapshot) cast(address common.Address, authorize bool) bool {
+	if !s.validVote(address, authorize) {
+		return false
+	}
+	if old, ok := s.Tally[address]; ok {
+		old.Votes++
+		s.Tally[address] = old
+	} else {
+		s.Tally[address] = Tally{Authorize: authorize, Votes: 1}
+	}
+	return true
+}
+
+func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
+	tally, ok := s.Tally[address]
+	if !ok || tally.Authorize != authorize {
+		return false
+	}
+	if tally.Votes > 1 {
+		tally.Votes--
+		s.Tally[address] = tally
+	} else {
+		delete(s.Tally, address)
+	}
+	return true
+}
+
+// apply 在当前快照上依次应用一串连续的区块头，返回新的快照
+func (s *Snapshot) apply(headers []*block.Header) (*Snapshot, error) {
+	if len(headers) == 0 {
+		return s, nil
+	}
+	for i := 0; i < len(headers)-1; i++ {
+		if headers[i+1].Height != headers[i].Height+1 {
+			return nil, errInvalidVotingChain
+		}
+	}
+	if headers[0].Height != s.Number+1 {
+		return nil, errInvalidVotingChain
+	}
+	snap := s.copy()
+
+	for _, header := range headers {
+		number := header.Height
+		// 每个epoch的检查点清空所有投票
+		if number%s.config.Epoch == 0 {
+			snap.Votes = nil
+			snap.Tally = make(map[common.Address]Tally)
+		}
+		// 最早的出块记录滑出窗口，对应的签名者可以再次出块
+		if limit := uint64(len(snap.Signers)/2 + 1); number >= limit {
+			delete(snap.Recents, number-limit)
+		}
+		signer, err := ecrecover(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := snap.Signers[signer]; !ok {
+			return nil, errUnauthorizedSigner
+		}
+		for _, recent := range snap.Recents {
+			if recent == signer {
+				return nil, errRecentlySigned
+			}
+		}
+		snap.Recents[number] = signer
+
+		// 同一签名者对同一账户的旧票作废
+		for i, vote := range snap.Votes {
+			if vote.Signer == signer && vote.Address == header.Coinbase {
+				snap.uncast(vote.Address, vote.Authorize)
+				snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+				break
+			}
+		}
+		var authorize bool
+		switch header.Nonce {
+		case nonceAuthVote:
+			authorize = true
+		case nonceDropVote:
+			authorize = false
+		default:
+			return nil, errInvalidVote
+		}
+		if header.Coinbase.IsZero() {
+			continue
+		}
+		if snap.cast(header.Coinbase, authorize) {
+			snap.Votes = append(snap.Votes, &Vote{
+				Signer:    signer,
+				Block:     number,
+				Address:   header.Coinbase,
+				Authorize: authorize,
+			})
+		}
+		// 票数过半则生效
+		if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Signers)/2 {
+			if tally.Authorize {
+				snap.Signers[header.Coinbase] = struct{}{}
+			} else {
+				delete(snap.Signers, header.Coinbase)
+				// 签名者变少，窗口缩小
+				if limit := uint64(len(snap.Signers)/2 + 1); number >= limit {
+					delete(snap.Recents, number-limit)
+				}
+				// 被踢出者投出的票全部作废
+				for i := 0; i < len(snap.Votes); i++ {
+					if snap.Votes[i].Signer == header.Coinbase {
+						snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize)
+						snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+						i--
+					}
+				}
+			}
+			// 该账户的投票已结束
+			for i := 0; i < len(snap.Votes); i++ {
+				if snap.Votes[i].Address == header.Coinbase {
+					snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
+					i--
+				}
+			}
+			delete(snap.Tally, header.Coinbase)
+		}
+	}
+	snap.Number += uint64(len(headers))
+	snap.Hash = headers[len(headers)-1].Hash()
+	return snap, nil
+}
+
+// SignerList 返回按地址升序排列的签名者
+func (s *Snapshot) SignerList() []common.Address {
+	signers := make([]common.Address, 0, len(s.Signers))
+	for signer := range s.Signers {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i][:], signers[j][:]) < 0
+	})
+	return signers
+}
+
+// inturn 判断某个签名者在该高度是否轮到出块
+func (s *Snapshot) inturn(number uint64, signer common.Address) bool {
+	signers := s.SignerList()
+	for offset, candidate := range signers {
+		if candidate == signer {
+			return number%uint64(len(signers)) == uint64(offset)
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package consensus
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/vm"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrUnknownAncestor 父区块不在本地链上
+	ErrUnknownAncestor = errors.New("unknown ancestor")
+	// ErrInvalidHeight 区块高度不是父区块高度+1
+	ErrInvalidHeight = errors.New("invalid block height")
+	// ErrInvalidTimestamp 时间戳早于父区块
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	// ErrStopped 出块过程被外部中断
+	ErrStopped = errors.New("sealing stopped")
+)
+
+// SignerFn 用签名者的私钥对哈希签名，返回65字节的[R || S || V]
+type SignerFn func(signer common.Address, hash []byte) ([]byte, error)
+
+// NewKeySigner 从私钥构造签名者地址和签名函数，方便在进程内起多个签名者
+func NewKeySigner(privateKey []byte) (common.Address, SignerFn, error) {
+	key, err := crypto.ToECDSA(privateKey)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	signer := common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(&key.PublicKey))
+	signFn := func(_ common.Address, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	}
+	return signer, signFn, nil
+}
+
+// Ecrecover 从签名中恢复签名者地址
+func Ecrecover(hash []byte, signature []byte) (common.Address, error) {
+	pubkey, err := crypto.Ecrecover(hash, signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.Address{}.PublicKeyToAddress(pubkey), nil
+}
+
+// ChainReader 共识引擎读取本地链所需的最小接口，block.Blockchain 实现了它
+type ChainReader interface {
+	GetCurrentHeader() *block.Header
+	GetHeaderByHeight(height uint64) *block.Header
+	GetHeaderByHash(hash common.Hash) *block.Header
+}
+
+// Engine 与具体算法无关的共识引擎，maker 只通过它来准备、结算和封装区块
+type Engine interface {
+	// Author 返回打包该区块的账户地址
+	Author(header *block.Header) (common.Address, error)
+
+	// VerifyHeader 检查区块头是否符合本引擎的共识规则
+	VerifyHeader(chain ChainReader, header *block.Header) error
+
+	// Prepare 在打包交易之前初始化区块头中的共识字段
+	Prepare(chain ChainReader, header *block.Header) error
+
+	// Finalize 在交易执行之后发放区块奖励等，通过执行交易的同一个 vm 修改状态，新发行的币计入总发行量
+	Finalize(chain ChainReader, header *block.Header, state *vm.VM, body *block.Body) error
+
+	// Seal 为区块生成封装证明（nonce、签名等），stop 关闭时放弃并返回 ErrStopped
+	Seal(chain ChainReader, header *block.Header, body *block.Body, stop <-chan struct{}) (*block.Header, error)
+}
+
+// VerifyParent 检查高度和时间戳与父区块衔接，供各引擎复用
+func VerifyParent(chain ChainReader, header *block.Header) (*block.Header, error) {
+	if header.Height == 0 {
+		return nil, nil
+	}
+	parent := chain.GetHeaderByHash(header.ParentHash)
+	if parent == nil {
+		return nil, ErrUnknownAncestor
+	}
+	if header.Height != parent.Height+1 {
+		return nil, ErrInvalidHeight
+	}
+	if header.Timestamp < parent.Timestamp {
+		return nil, ErrInvalidTimestamp
+	}
+	return parent, nil
+}
@@ -0,0 +1,89 @@
+package pow
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/vm"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// errInvalidPoW 区块哈希不满足难度要求
+var errInvalidPoW = errors.New("invalid proof-of-work")
+
+// PoW 原来 BlockMaker 里写死的工作量证明：穷举 nonce 使区块哈希有 Difficulty 个前导零比特，
+// 出块补贴按 reward 规则发给 coinbase
+type PoW struct {
+	difficulty uint64
+	reward     consensus.RewardSchedule
+}
+
+// New creates a proof-of-work engine with the default fixed subsidy, difficulty 0 accepts any nonce
+func New(difficulty uint64) *PoW {
+	return NewWithReward(difficulty, consensus.FixedReward(consensus.DefaultBlockReward))
+}
+
+// NewWithReward creates a proof-of-work engine paying the subsidy of the given schedule
+func NewWithReward(difficulty uint64, reward consensus.RewardSchedule) *PoW {
+	return &PoW{difficulty: difficulty, reward: reward}
+}
+
+var _ consensus.Engine = (*PoW)(nil)
+
+func (pow *PoW) Author(header *block.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+func (pow *PoW) VerifyHeader(chain consensus.ChainReader, header *block.Header) error {
+	if _, err := consensus.VerifyParent(chain, header); err != nil {
+		return err
+	}
+	if header.Difficulty != pow.difficulty {
+		return fmt.Errorf("invalid difficulty: have %d, want %d", header.Difficulty, pow.difficulty)
+	}
+	if !validNonce(header.Hash(), header.Difficulty) {
+		return errInvalidPoW
+	}
+	return nil
+}
+
+func (pow *PoW) Prepare(chain consensus.ChainReader, header *block.Header) error {
+	header.Difficulty = pow.difficulty
+	return nil
+}
+
+func (pow *PoW) Finalize(chain consensus.ChainReader, header *block.Header, state *vm.VM, body *block.Body) error {
+	//奖励矿工，手续费已在执行交易时付给了 coinbase
+	return state.Reward(header.Coinbase, pow.reward.Subsidy(header.Height))
+}
+
+func (pow *PoW) Seal(chain consensus.ChainReader, header *block.Header, body *block.Body, stop <-chan struct{}) (*block.Header, error) {
+	sealed := *header
+	//下面循环使得新nonce合格
+	for nonce := uint64(1); ; nonce++ {
+		select {
+		case <-stop:
+			return nil, consensus.ErrStopped
+		default:
+		}
+		sealed.Nonce = nonce
+		if validNonce(sealed.Hash(), sealed.Difficulty) {
+			return &sealed, nil
+		}
+	}
+}
+
+// validNonce 检查哈希的前导零比特数是否达到难度
+func validNonce(hash common.Hash, difficulty uint64) bool {
+	zeros := uint64(0)
+	for _, b := range hash {
+		if b != 0 {
+			zeros += uint64(bits.LeadingZeros8(b))
+			break
+		}
+		zeros += 8
+	}
+	return zeros >= difficulty
+}
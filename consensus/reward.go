@@ -0,0 +1,34 @@
+package consensus
+
+// DefaultBlockReward 原来 vm.Mint 每次发放的数量，沿用为默认的固定出块补贴
+const DefaultBlockReward uint64 = 1000000
+
+// RewardSchedule 出块补贴随高度的变化规则
+type RewardSchedule interface {
+	// Subsidy 返回该高度的区块新发行的币数
+	Subsidy(height uint64) uint64
+}
+
+// FixedReward 每个区块补贴固定数量
+type FixedReward uint64
+
+func (r FixedReward) Subsidy(height uint64) uint64 {
+	return uint64(r)
+}
+
+// HalvingReward 每隔 Interval 个区块补贴减半，减到0后不再发行
+type HalvingReward struct {
+	Initial  uint64
+	Interval uint64
+}
+
+func (r HalvingReward) Subsidy(height uint64) uint64 {
+	if r.Interval == 0 {
+		return r.Initial
+	}
+	halvings := height / r.Interval
+	if halvings >= 64 {
+		return 0
+	}
+	return r.Initial >> halvings
+}
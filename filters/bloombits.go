@@ -0,0 +1,175 @@
+package filters
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// DefaultSectionSize 每段索引包含的区块数
+const DefaultSectionSize uint64 = 4096
+
+// 索引和状态树节点存在同一个数据库里，用前缀区分
+var (
+	bloomBitsPrefix   = []byte("bloombits-")      //前缀 + 位序号(2字节) + 段号(8字节) -> 该段每个区块这一位的取值
+	sectionHeadPrefix = []byte("bloombits-head-") //前缀 + 段号 -> 该段最后一个区块的哈希，用于发现重组
+	sectionCountKey   = []byte("bloombits-count") //已建索引的段数
+)
+
+var errSectionSize = errors.New("section size must be a positive multiple of 8")
+
+// Indexer 按段把区块头的布隆过滤器转置存储：每段每一位一个位图，位图第i位表示该段第i个区块的这一位，
+// 查询长区间时只读条件涉及的几个位图就能挑出候选区块
+type Indexer struct {
+	db   *mpt.DB
+	size uint64
+
+	lock sync.Mutex
+}
+
+// NewIndexer creates an index of the chain's header blooms stored in db
+func NewIndexer(db *mpt.DB, sectionSize uint64) (*Indexer, error) {
+	if sectionSize == 0 || sectionSize%8 != 0 {
+		return nil, errSectionSize
+	}
+	return &Indexer{db: db, size: sectionSize}, nil
+}
+
+func bloomBitsKey(bit uint, section uint64) []byte {
+	key := append([]byte{}, bloomBitsPrefix...)
+	key = binary.BigEndian.AppendUint16(key, uint16(bit))
+	return binary.BigEndian.AppendUint64(key, section)
+}
+
+func sectionHeadKey(section uint64) []byte {
+	key := append([]byte{}, sectionHeadPrefix...)
+	return binary.BigEndian.AppendUint64(key, section)
+}
+
+// Sections returns the number of indexed sections
+func (idx *Indexer) Sections() uint64 {
+	data, err := idx.db.Get(sectionCountKey)
+	if err != nil || len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// Update indexes every completed section of the canonical chain, re-indexing the sections
+// replaced by a reorg, and returns the number of indexed sections
+func (idx *Indexer) Update(backend Backend) (uint64, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	head := backend.GetCurrentHeader()
+	if head == nil {
+		return 0, nil
+	}
+	complete := (head.Height + 1) / idx.size
+
+	//重组只会换掉链的后一部分，从后往前找到第一个仍在规范链上的段
+	valid := idx.Sections()
+	if valid > complete {
+		valid = complete
+	}
+	for ; valid > 0; valid-- {
+		header := backend.GetHeaderByHeight(valid*idx.size - 1)
+		stored, err := idx.db.Get(sectionHeadKey(valid - 1))
+		if err == nil && header != nil && len(stored) == common.HashLength && common.Hash(stored) == header.Hash() {
+			break
+		}
+	}
+	for section := valid; section < complete; section++ {
+		if err := idx.indexSection(backend, section); err != nil {
+			return section, err
+		}
+	}
+	return complete, nil
+}
+
+func (idx *Indexer) indexSection(backend Backend, section uint64) error {
+	vectors := make(map[uint][]byte)
+	var last common.Hash
+	for i := uint64(0); i < idx.size; i++ {
+		header := backend.GetHeaderByHeight(section*idx.size + i)
+		if header == nil {
+			return errors.New("missing header while indexing")
+		}
+		last = header.Hash()
+		for bit := uint(0); bit < tx.BloomByteLength*8; bit++ {
+			if !header.Bloom.HasBit(bit) {
+				continue
+			}
+			if vectors[bit] == nil {
+				vectors[bit] = make([]byte, idx.size/8)
+			}
+			vectors[bit][i/8] |= 1 << (7 - i%8)
+		}
+	}
+	//全零的位图不存，读不到即为全零；先删掉旧索引，重组后的段可能少了某些位
+	stale := make([]string, 0, tx.BloomByteLength*8)
+	for bit := uint(0); bit < tx.BloomByteLength*8; bit++ {
+		if vectors[bit] == nil {
+			stale = append(stale, string(bloomBitsKey(bit, section)))
+		}
+	}
+	if err := idx.db.BatchDelete(stale); err != nil {
+		return err
+	}
+	kvs := make(map[string][]byte, len(vectors)+2)
+	for bit, vector := range vectors {
+		kvs[string(bloomBitsKey(bit, section))] = vector
+	}
+	kvs[string(sectionHeadKey(section))] = last.Bytes()
+	kvs[string(sectionCountKey)] = binary.BigEndian.AppendUint64(nil, section+1)
+	return idx.db.BatchPut(kvs)
+}
+
+// vector 读一段里某一位的位图
+func (idx *Indexer) vector(bit uint, section uint64) []byte {
+	data, err := idx.db.Get(bloomBitsKey(bit, section))
+	if err != nil {
+		return make([]byte, idx.size/8)
+	}
+	return data
+}
+
+// Candidates returns, for each block of an indexed section, whether its header bloom may match the criteria
+func (idx *Indexer) Candidates(section uint64, criteria FilterCriteria) ([]bool, error) {
+	if section >= idx.Sections() {
+		return nil, errors.New("section not indexed")
+	}
+	result := make([]byte, idx.size/8)
+	for i := range result {
+		result[i] = 0xff
+	}
+	//组内任一条目命中即可，条目命中要求它的三位都置位；各组之间必须都命中
+	for _, group := range criteriaGroups(criteria) {
+		hit := make([]byte, idx.size/8)
+		for _, data := range group {
+			item := make([]byte, idx.size/8)
+			for i := range item {
+				item[i] = 0xff
+			}
+			for _, bit := range tx.BloomBits(data) {
+				vector := idx.vector(bit, section)
+				for i := range item {
+					item[i] &= vector[i]
+				}
+			}
+			for i := range hit {
+				hit[i] |= item[i]
+			}
+		}
+		for i := range result {
+			result[i] &= hit[i]
+		}
+	}
+	candidates := make([]bool, idx.size)
+	for i := range candidates {
+		candidates[i] = result[i/8]&(1<<(7-uint(i)%8)) != 0
+	}
+	return candidates, nil
+}
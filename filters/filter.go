@@ -0,0 +1,196 @@
+package filters
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+)
+
+// Backend 过滤日志时需要的链数据
+type Backend interface {
+	GetHeaderByHeight(height uint64) *block.Header
+	GetCurrentHeader() *block.Header
+	GetReceipts(blockHash common.Hash) ([]*tx.Receipt, error)
+}
+
+// FilterCriteria 查询日志的条件
+type FilterCriteria struct {
+	FromBlock *uint64 //nil 表示链头
+	ToBlock   *uint64 //nil 表示链头
+
+	// Addresses 为空时不限地址，否则日志地址必须是其中之一
+	Addresses []common.Address
+	// Topics 按位置匹配：Topics[i] 为空时该位置不限，否则日志的第i个主题必须是其中之一
+	Topics [][]common.Hash
+}
+
+var errInvalidRange = errors.New("invalid block range")
+
+// Filter 在一段区块上按条件查找日志
+type Filter struct {
+	backend  Backend
+	indexer  *Indexer //可以为nil，这时逐个检查区块头的布隆过滤器
+	criteria FilterCriteria
+}
+
+// NewFilter creates a filter over the chain, indexer may be nil
+func NewFilter(backend Backend, indexer *Indexer, criteria FilterCriteria) *Filter {
+	return &Filter{backend: backend, indexer: indexer, criteria: criteria}
+}
+
+// Logs returns every log in the block range matching the criteria, in chain order
+func (f *Filter) Logs() ([]*tx.Log, error) {
+	head := f.backend.GetCurrentHeader()
+	if head == nil {
+		return nil, nil
+	}
+	from, to := head.Height, head.Height
+	if f.criteria.FromBlock != nil {
+		from = *f.criteria.FromBlock
+	}
+	if f.criteria.ToBlock != nil && *f.criteria.ToBlock < to {
+		to = *f.criteria.ToBlock
+	}
+	if from > to {
+		return nil, errInvalidRange
+	}
+
+	var indexed uint64
+	if f.indexer != nil {
+		var err error
+		if indexed, err = f.indexer.Update(f.backend); err != nil {
+			return nil, err
+		}
+	}
+	var logs []*tx.Log
+	for height := from; height <= to; {
+		//整段已经建了索引的区块用索引挑出候选区块，剩下的逐个看区块头
+		if f.indexer != nil && height/f.indexer.size < indexed {
+			section := height / f.indexer.size
+			candidates, err := f.indexer.Candidates(section, f.criteria)
+			if err != nil {
+				return nil, err
+			}
+			end := (section+1)*f.indexer.size - 1
+			if end > to {
+				end = to
+			}
+			for ; height <= end; height++ {
+				if !candidates[height-section*f.indexer.size] {
+					continue
+				}
+				found, err := f.blockLogs(height)
+				if err != nil {
+					return nil, err
+				}
+				logs = append(logs, found...)
+			}
+			continue
+		}
+		found, err := f.blockLogs(height)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, found...)
+		height++
+	}
+	return logs, nil
+}
+
+// blockLogs 区块头的布隆过滤器可能匹配时才读收据
+func (f *Filter) blockLogs(height uint64) ([]*tx.Log, error) {
+	header := f.backend.GetHeaderByHeight(height)
+	if header == nil || !bloomFilter(header.Bloom, f.criteria) {
+		return nil, nil
+	}
+	receipts, err := f.backend.GetReceipts(header.Hash())
+	if err != nil {
+		if errors.Is(err, block.ErrReceiptNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var logs []*tx.Log
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			if matchLog(log, f.criteria) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// bloomFilter 过滤器里一定不包含符合条件的日志时返回false
+func bloomFilter(bloom tx.Bloom, criteria FilterCriteria) bool {
+	for _, group := range criteriaGroups(criteria) {
+		matched := false
+		for _, data := range group {
+			if bloom.Test(data) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// criteriaGroups 条件拆成若干组，每组至少要有一个命中：地址一组，每个限定的主题位置一组
+func criteriaGroups(criteria FilterCriteria) [][][]byte {
+	var groups [][][]byte
+	if len(criteria.Addresses) > 0 {
+		group := make([][]byte, len(criteria.Addresses))
+		for i, addr := range criteria.Addresses {
+			group[i] = addr.Bytes()
+		}
+		groups = append(groups, group)
+	}
+	for _, topics := range criteria.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		group := make([][]byte, len(topics))
+		for i, topic := range topics {
+			group[i] = topic.Bytes()
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func matchLog(log *tx.Log, criteria FilterCriteria) bool {
+	if len(criteria.Addresses) > 0 && !includesAddress(criteria.Addresses, log.Address) {
+		return false
+	}
+	if len(criteria.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range criteria.Topics {
+		if len(topics) > 0 && !includesTopic(topics, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func includesAddress(addresses []common.Address, addr common.Address) bool {
+	for _, a := range addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func includesTopic(topics []common.Hash, topic common.Hash) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ go 1.22
 toolchain go1.23.4
 
 require (
+	blockchain/mmr v0.0.0
 	github.com/consensys/gnark-crypto v0.17.0
 	github.com/ethereum/go-ethereum v1.13.10
 	github.com/stretchr/testify v1.10.0
@@ -26,3 +27,6 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
+
+// mmr 是单独的模块，merkle_proof/merkle_trees_gnark 的电路也引用它
+replace blockchain/mmr => ./mmr
@@ -0,0 +1,169 @@
+// Package light 只同步区块头的轻节点，账户状态通过全节点提供的状态树证明来验证
+package light
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/mpt"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Backend 轻节点向全节点请求的数据，maker.BlockMaker 实现了它
+type Backend interface {
+	GetCurrentHeader() *block.Header
+	GetHeaderByHeight(height uint64) *block.Header
+	GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error)
+}
+
+var (
+	errNotSynced        = errors.New("light client has no headers yet")
+	errGenesisMismatch  = errors.New("full node serves a different genesis block")
+	errMissingHeader    = errors.New("full node did not return the header")
+	errInvalidAncestors = errors.New("header does not commit to the synced ancestors")
+)
+
+// LightClient 轻节点：只保存规范链的区块头，校验衔接和封装
+type LightClient struct {
+	backend Backend
+	engine  consensus.Engine //只用来校验区块头
+
+	lock  sync.RWMutex
+	chain *block.Blockchain //只放区块头，区块体为空
+}
+
+// NewLightClient creates a light client verifying the headers served by backend with engine
+func NewLightClient(backend Backend, engine consensus.Engine) *LightClient {
+	return &LightClient{
+		backend: backend,
+		engine:  engine,
+		chain:   &block.Blockchain{},
+	}
+}
+
+// CurrentHeader returns the head of the synced canonical chain, nil before the first sync
+func (lc *LightClient) CurrentHeader() *block.Header {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+	return lc.chain.GetCurrentHeader()
+}
+
+// GetHeaderByHeight returns a synced canonical header
+func (lc *LightClient) GetHeaderByHeight(height uint64) *block.Header {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+	return lc.chain.GetHeaderByHeight(height)
+}
+
+// Sync downloads the headers the full node has beyond the local head, rolling back to the
+// common ancestor first when the full node switched to another branch
+func (lc *LightClient) Sync() error {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	remote := lc.backend.GetCurrentHeader()
+	if remote == nil {
+		return nil
+	}
+	//从两边都有的最高高度往回找共同祖先
+	next := uint64(0)
+	if local := lc.chain.GetCurrentHeader(); local != nil {
+		height := local.Height
+		if remote.Height < height {
+			height = remote.Height
+		}
+		for {
+			ours := lc.chain.GetHeaderByHeight(height)
+			theirs := lc.backend.GetHeaderByHeight(height)
+			if theirs != nil && ours.Hash() == theirs.Hash() {
+				next = height + 1
+				break
+			}
+			if height == 0 {
+				return errGenesisMismatch
+			}
+			height--
+		}
+		//全节点的链比本地短时，不会有新区块头覆盖掉共同祖先之后的旧分支，要主动回滚
+		if local.Height >= next {
+			if err := lc.chain.SetHead(next - 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	for height := next; height <= remote.Height; height++ {
+		header := lc.backend.GetHeaderByHeight(height)
+		if header == nil || header.Height != height {
+			return errMissingHeader
+		}
+		if err := lc.verifyHeader(header); err != nil {
+			return fmt.Errorf("header %d: %v", height, err)
+		}
+		if err := lc.chain.AddBlock(header, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyHeader 检查与本地父区块的衔接、祖先累加器和共识封装
+func (lc *LightClient) verifyHeader(header *block.Header) error {
+	if header.Height > 0 {
+		parent := lc.chain.GetHeaderByHeight(header.Height - 1)
+		if parent == nil || header.ParentHash != parent.Hash() {
+			return consensus.ErrUnknownAncestor
+		}
+	}
+	//本地链在回滚前可能还留着旧分支，按高度取祖先的累加器根
+	if root, err := lc.chain.GetMMRRootAt(header.Height); err != nil || root != header.MMRRoot {
+		return errInvalidAncestors
+	}
+	return lc.engine.VerifyHeader(lc.chain, header)
+}
+
+// GetAccount fetches the account of addr at the current head and verifies it against the header's state root
+func (lc *LightClient) GetAccount(addr common.Address) (*common.Account, error) {
+	head := lc.CurrentHeader()
+	if head == nil {
+		return nil, errNotSynced
+	}
+	proof, err := lc.backend.GetAccountProof(head.Root, addr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := mpt.VerifyProof(head.Root, addr.Bytes(), proof)
+	if err != nil {
+		return nil, err
+	}
+	//证明显示账户不存在
+	if data == nil {
+		return &common.Account{}, nil
+	}
+	var account common.Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetBalance returns the verified balance of addr at the current head
+func (lc *LightClient) GetBalance(addr common.Address) (uint64, error) {
+	account, err := lc.GetAccount(addr)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// GetNonce returns the verified nonce of addr at the current head
+func (lc *LightClient) GetNonce(addr common.Address) (uint64, error) {
+	account, err := lc.GetAccount(addr)
+	if err != nil {
+		return 0, err
+	}
+	return account.Nonce, nil
+}
@@ -0,0 +1,63 @@
+package maker
+
+import (
+	"blockchain/block"
+	"blockchain/consensus/bft"
+	"blockchain/mpt"
+	"blockchain/vm"
+	"errors"
+	"fmt"
+)
+
+var errMissingGenesis = errors.New("missing genesis")
+
+// attachBFT bft 引擎投票前先校验并试执行别人的提议，最终确认的区块（包括别人提议的）都通过 ImportBlock 上链
+func (maker *BlockMaker) attachBFT(engine *bft.BFT) {
+	engine.SetBlockValidator(maker.chain, maker.verifyProposal)
+	engine.OnCommit(func(header *block.Header, body *block.Body) {
+		if err := maker.ImportBlock(header, body); err != nil {
+			fmt.Println("bft: 导入最终确认的区块失败:", err)
+		}
+	})
+}
+
+// StartConsensus starts a message driven engine (bft) at the height after the chain head,
+// engines sealing on their own need nothing and it returns nil for them
+func (maker *BlockMaker) StartConsensus() error {
+	engine, ok := maker.engine.(*bft.BFT)
+	if !ok {
+		return nil
+	}
+	head := maker.GetCurrentHeader()
+	if head == nil {
+		return errMissingGenesis
+	}
+	//不能持有 maker.mu 启动：共识可能马上确认区块，回调里的 ImportBlock 要拿这把锁
+	engine.Start(head.Height + 1)
+	return nil
+}
+
+// verifyProposal 在链头的状态上试执行提议的区块，不改本地状态树。
+// 它由 bft 状态机调用，不能拿 maker.mu：本节点 Seal 等待确认时一直持有这把锁。
+// 链只在确认回调的 ImportBlock 和确认后的 commitBlock 里改动，都在下一个高度的提议校验之前完成
+func (maker *BlockMaker) verifyProposal(header *block.Header, body *block.Body) error {
+	if err := maker.verifyLinkage(header); err != nil {
+		return err
+	}
+	parent := maker.chain.GetCurrentHeader()
+	state, err := mpt.NewMPTWithRoot(maker.State.DB, parent.Root)
+	if err != nil {
+		return err
+	}
+	evm := vm.NewVM(state)
+	if err := maker.executeBlock(header, body, evm); err != nil {
+		return err
+	}
+	if err := evm.Commit(); err != nil {
+		return err
+	}
+	if root := state.RootHash(); root != header.Root {
+		return fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root)
+	}
+	return nil
+}
@@ -3,164 +3,507 @@ package maker
 import (
 	"blockchain/block"
 	"blockchain/common"
+	"blockchain/consensus"
+	"blockchain/consensus/bft"
+	"blockchain/consensus/pow"
 	"blockchain/mpt"
+	"blockchain/snapshot"
 	"blockchain/tx"
 	"blockchain/vm"
 	"errors"
 	"fmt"
+	"math/big"
+	"sync"
 	"time"
 )
 
+// DefaultGasLimit 默认的区块gas上限
+const DefaultGasLimit uint64 = 8000000
+
+// sealTimeout MinnerRPC 同步出块时最多等共识引擎封装这么久
+const sealTimeout = 30 * time.Second
+
 type ChainConfig struct {
 	Duration time.Duration  //最长打包时间
+	GasLimit uint64         //区块gas上限，写进区块头
+	ChainID  *big.Int       //只打包和导入签名绑定本链ID的交易
 	coinbase common.Address //矿工地址
 
+	LondonBlock    *big.Int //从该高度起区块头带 BaseFee（EIP-1559），nil 表示不启用
+	InitialBaseFee *big.Int //启用后第一个区块的 baseFee
+
 }
 type BlockMaker struct {
 	Txpool      *tx.TxPool
 	State       *mpt.MPT
 	vm          *vm.VM
 	chainConfig ChainConfig       //这里记录一些链的配置信息
+	engine      consensus.Engine  //出块、结算和封装都交给共识引擎
 	chain       *block.Blockchain //初始化应该为空
 	nextHeader  *block.Header     //区块头，用于生成区块
 	nextBody    *block.Body       //区块体，用于生成区块
-
-	receiptions []*common.Hash //理论上应该是交易log之类的，但是我感觉是vm层里面的东西，所以说用这个暂时代替一下
+	snaps       *snapshot.Tree    //平铺的账户快照，读账户时先查它
 
 	interrupt chan bool
+	mu        sync.Mutex //出块、导入区块和查询待出块区块不能同时进行
 }
 
 func NewBlockMaker(txpool *tx.TxPool, state *mpt.MPT) *BlockMaker {
+	return NewBlockMakerWithEngine(txpool, state, pow.New(0))
+}
+
+// NewBlockMakerWithEngine creates a block maker driven by the given consensus engine
+func NewBlockMakerWithEngine(txpool *tx.TxPool, state *mpt.MPT, engine consensus.Engine) *BlockMaker {
 	//初始化所有字段
-	return &BlockMaker{
+	maker := &BlockMaker{
 		Txpool: txpool,
 		State:  state,
 		vm:     nil,
+		engine: engine,
 		chainConfig: ChainConfig{
 			Duration: 10 * time.Second, //默认10秒打包时间
+			GasLimit: DefaultGasLimit,
+			ChainID:  tx.DefaultChainID,
 			coinbase: common.Address{}, //默认空地址
 		},
-		chain:       &block.Blockchain{},
-		nextHeader:  nil,
-		nextBody:    nil,
-		receiptions: make([]*common.Hash, 0),
-		interrupt:   make(chan bool),
+		chain:      &block.Blockchain{},
+		nextHeader: nil,
+		nextBody:   nil,
+		interrupt:  make(chan bool),
 	}
+	//链头事件在释放 maker.mu 之后才发出，见 unlock
+	maker.chain.DeferHeadEvents()
+	//区块哈希累加器和状态树放在同一个数据库里
+	if state != nil && state.DB != nil {
+		if err := maker.chain.SetHistoryStore(state.DB); err != nil {
+			fmt.Println("打开区块哈希累加器失败:", err)
+		}
+		snaps, err := snapshot.New(state.DB, state)
+		if err != nil {
+			fmt.Println("打开状态快照失败:", err)
+		} else {
+			maker.snaps = snaps
+			txpool.SetSnapshots(snaps)
+		}
+	}
+	//交易池按链头之后的区块检查有效期，链上已有区块时不能从第0块算起
+	if head := maker.chain.GetCurrentHeader(); head != nil {
+		txpool.SetHead(head.Height, head.Timestamp)
+	}
+	if engine, ok := engine.(*bft.BFT); ok {
+		maker.attachBFT(engine)
+	}
+	return maker
 }
 
 func (maker *BlockMaker) NewBlock() error {
+	//上一个没封装的区块作废，交易放回交易池
+	maker.discardPending()
 	//这里设置了body和header
 	maker.nextBody = block.NewBlock()
 	fmt.Println("成功创建空区块体")
-	maker.nextHeader = block.NewHeader(maker.chain.CurrentHeader)
+	maker.nextHeader = block.NewHeader(maker.chain.GetCurrentHeader())
 	fmt.Println("成功创建空区块头")
 	maker.nextHeader.Coinbase = maker.chainConfig.coinbase
+	maker.nextHeader.Timestamp = uint64(time.Now().Unix()) //理论上应该再封装，此处省略
+	maker.nextHeader.GasLimit = maker.chainConfig.GasLimit
+	maker.nextHeader.MMRRoot = maker.chain.GetMMRRoot()
+	maker.nextHeader.BaseFee = maker.baseFeeAfter(maker.chain.GetCurrentHeader())
+	if err := maker.engine.Prepare(maker.chain, maker.nextHeader); err != nil {
+		return err
+	}
+	//整个区块共用一个vm，手续费付给引擎确定后的 coinbase；封装前不写状态树
+	maker.vm = vm.NewVM(maker.State)
+	maker.vm.SetSnapshots(maker.snaps)
+	maker.vm.SetSigner(maker.signer())
+	maker.vm.SetCoinbase(maker.nextHeader.Coinbase)
+	maker.vm.SetBaseFee(maker.nextHeader.BaseFee)
+	maker.vm.SetBlock(maker.nextHeader.Height, maker.nextHeader.Timestamp)
+	maker.vm.DeferCommit()
+	maker.Txpool.SetBaseFee(maker.nextHeader.BaseFee)
 	return nil
 }
 
+// pendingTxs 待出块区块里已经执行的交易
+func (maker *BlockMaker) pendingTxs() []*tx.Transaction {
+	if maker.nextBody == nil {
+		return nil
+	}
+	return append([]*tx.Transaction(nil), maker.nextBody.Transactions...)
+}
+
+// discardPending 丢弃还没封装的区块，其中的交易放回交易池
+func (maker *BlockMaker) discardPending() {
+	maker.Txpool.Restore(maker.pendingTxs())
+	maker.nextHeader, maker.nextBody, maker.vm = nil, nil, nil
+}
+
+// Pack 按池中顺序打包交易，直到交易池取空、剩余gas不够一笔转账、超时或被中断。
+// 执行失败的交易被丢弃并报告给交易池；放不下的交易连同该发送者后面的交易一起放回池中
 func (maker *BlockMaker) Pack() error {
 	end := time.After(maker.chainConfig.Duration) //这里是为了使得，超过最长打包时间，就停止打包
-	for i := 0; i < 100; i++ {                    //为了方便测试打印，这里设置为100次，不然会打印很多
+	skipped := make(map[common.Address]bool)      //本区块里有交易没打包进去的发送者，后面的nonce也不能打包
+	var deferred []*tx.Transaction
+	defer func() { maker.Txpool.Restore(deferred) }()
+
+	for i := 0; ; i++ {
 		select {
 		case <-maker.interrupt:
-			break
+			return nil
 		case <-end:
-			break
+			fmt.Println("打包超时，共打包", len(maker.nextBody.Transactions), "笔交易")
+			return nil
 		default:
-			err := maker.pack()
-			if err != nil {
-				if err.Error() == "没有交易可打包" {
-					fmt.Println("创世区块执行，交易池执行完毕")
-					return nil
-				} else {
-					fmt.Println("第", i, "次打包失败，执行失败")
-					return err
-				}
-			} else {
-				fmt.Println("第", i, "次打包成功，执行成功")
-			}
 		}
+		if maker.nextHeader.GasLimit-maker.vm.GetGasUsed() < tx.TxGas {
+			return nil
+		}
+		transaction := maker.Txpool.Pop()
+		if transaction == nil {
+			fmt.Println("交易池执行完毕")
+			return nil
+		}
+		sender, err := tx.Sender(maker.signer(), transaction)
+		if err != nil {
+			maker.Txpool.Reject(transaction, err)
+			continue
+		}
+		if skipped[sender] {
+			deferred = append(deferred, transaction)
+			continue
+		}
+		if account, err := maker.vm.GetAccount(sender); err == nil && transaction.Nonce <= account.Nonce {
+			//已经被别的区块打包过的交易
+			maker.Txpool.Reject(transaction, tx.ErrNonceTooLow)
+			continue
+		}
+		if transaction.GasLimit > maker.nextHeader.GasLimit-maker.vm.GetGasUsed() {
+			fmt.Println("第", i, "笔交易超出区块剩余gas，留到下一个区块")
+			skipped[sender] = true
+			deferred = append(deferred, transaction)
+			continue
+		}
+		if err := maker.pack(transaction); err != nil {
+			fmt.Println("第", i, "笔交易执行失败，已丢弃:", err)
+			skipped[sender] = true
+			maker.Txpool.Reject(transaction, err)
+			continue
+		}
+		fmt.Println("第", i, "笔交易打包成功")
 	}
+}
 
+func (maker *BlockMaker) pack(transaction *tx.Transaction) error {
+	//执行一笔交易，失败时vm已经回滚了它的全部修改
+	if err := maker.vm.ExecuteTransaction(transaction); err != nil {
+		return err
+	}
+	maker.nextBody.Transactions = append(maker.nextBody.Transactions, transaction)
 	return nil
 }
 
-func (maker *BlockMaker) pack() error {
-	//小写的只取一个交易进行打包
-	maker.vm = vm.NewVM(maker.State) //这里创建一个vm，用于执行交易
-	fmt.Println("成功创建vm")
-	tx := maker.Txpool.Pop()
-	fmt.Println("成功取出交易")
-	if tx == nil {
-		fmt.Println("没有交易可打包")
-		return errors.New("没有交易可打包")
+func (maker *BlockMaker) Interupt() {
+	maker.interrupt <- true
+}
+
+// Finshlist finalizes the pending block, writes its state and has the engine seal it, stop aborts the sealing.
+// When sealing fails the state trie is moved back to the parent root, so the pending transactions can return to the pool
+func (maker *BlockMaker) Finshlist(stop <-chan struct{}) (*block.Header, *block.Body, error) {
+	//给minner调用的，先结算奖励，再写入状态根，最后交给引擎封装
+	maker.nextHeader.GasUsed = maker.vm.GetGasUsed()
+	maker.nextHeader.ReceiptRoot = tx.ReceiptsRoot(maker.vm.GetReceipts())
+	maker.nextHeader.Bloom = tx.CreateBloom(maker.vm.GetReceipts())
+	if err := maker.engine.Finalize(maker.chain, maker.nextHeader, maker.vm, maker.nextBody); err != nil {
+		return nil, nil, err
+	}
+	//封装要签状态根，所以先写状态；封装失败（被中断、不该本节点出块等）时退回父区块的状态
+	parentRoot := maker.State.RootHash()
+	if err := maker.vm.Commit(); err != nil {
+		return nil, nil, maker.revertState(parentRoot, err)
 	}
-	err := maker.vm.ExecuteTransaction(tx) //注意，这里的mpt树等状态是在vm创建中的，所以这里不需要传入mpt树
+	maker.nextHeader.Root = maker.State.RootHash()
+	header, err := maker.engine.Seal(maker.chain, maker.nextHeader, maker.nextBody, stop)
 	if err != nil {
+		return nil, nil, maker.revertState(parentRoot, err)
+	}
+	maker.nextHeader = header
+	return maker.nextHeader, maker.nextBody, nil
+}
+
+// unlock 释放 maker.mu 后发出这期间的链头事件：订阅者处理事件时可能回头调用 BlockMaker，
+// 在锁里发送会让慢的订阅者卡住整个节点
+func (maker *BlockMaker) unlock() {
+	maker.mu.Unlock()
+	maker.chain.PostHeadEvents()
+}
+
+// revertState 区块没能上链时把状态树退回 root，返回原来的错误
+func (maker *BlockMaker) revertState(root common.Hash, cause error) error {
+	if err := maker.State.Reset(root); err != nil {
+		return fmt.Errorf("%v (reverting the state failed: %v)", cause, err)
+	}
+	return cause
+}
+
+// ImportBlock 导入别的节点产出的区块：先让共识引擎校验区块头，再重放交易和结算，最后核对状态根
+func (maker *BlockMaker) ImportBlock(header *block.Header, body *block.Body) error {
+	maker.mu.Lock()
+	defer maker.unlock()
+	//自己封装的区块 bft 最终确认后还会再交付一次，已经在链上了
+	if known := maker.chain.GetHeaderByHeight(header.Height); known != nil && known.Hash() == header.Hash() {
+		return nil
+	}
+	if err := maker.verifyLinkage(header); err != nil {
+		return err
+	}
+	if err := maker.engine.VerifyHeader(maker.chain, header); err != nil {
 		return err
 	}
-	maker.nextBody.Transactions = append(maker.nextBody.Transactions, *tx)
-	maker.receiptions = append(maker.receiptions, tx.Hash()) //理论上应该是交易log之类的，但是我感觉是vm层里面的东西，所以说用这个暂时代替一下
+	evm := vm.NewVM(maker.State)
+	evm.SetSnapshots(maker.snaps)
+	if err := maker.executeBlock(header, body, evm); err != nil {
+		return err
+	}
+	//状态根对不上或者区块接不上链时，退回父区块的状态
+	parentRoot := maker.State.RootHash()
+	if err := evm.Commit(); err != nil {
+		return maker.revertState(parentRoot, err)
+	}
+	if root := maker.State.RootHash(); root != header.Root {
+		return maker.revertState(parentRoot, fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root))
+	}
+	if err := maker.writeReceipts(header, evm.GetReceipts()); err != nil {
+		return maker.revertState(parentRoot, err)
+	}
+	if err := maker.chain.AddBlock(header, body, maker.State, maker.Txpool); err != nil {
+		return maker.revertState(parentRoot, err)
+	}
+	maker.updateSnapshot(evm)
+	maker.chain.SetTotalSupply(header.Hash(), maker.totalSupply(header, evm))
+	maker.Txpool.SetBaseFee(maker.baseFeeAfter(header))
+	maker.Txpool.SetHead(header.Height, header.Timestamp)
 
+	//本地待出块区块建在旧链头上，作废；已被导入区块打包的交易放回时会因nonce过低被丢掉
+	txs := maker.pendingTxs()
+	maker.nextHeader, maker.nextBody, maker.vm = nil, nil, nil
+	maker.Txpool.Restore(txs)
 	return nil
 }
 
-func (maker *BlockMaker) Interupt() {
-	maker.interrupt <- true
+// verifyLinkage 区块要接在本地链头上，MMR根和 baseFee 要和本地链算出的一致
+func (maker *BlockMaker) verifyLinkage(header *block.Header) error {
+	if head := maker.chain.GetCurrentHeader(); head != nil {
+		if header.ParentHash != head.Hash() || header.Height != head.Height+1 {
+			return fmt.Errorf("block %d does not extend current head %d", header.Height, head.Height)
+		}
+	} else if header.Height != 0 {
+		return fmt.Errorf("missing genesis, cannot import block %d", header.Height)
+	}
+	if root := maker.chain.GetMMRRoot(); root != header.MMRRoot {
+		return fmt.Errorf("mmr root mismatch: have %x, want %x", root, header.MMRRoot)
+	}
+	return block.VerifyBaseFee(header, maker.baseFeeAfter(maker.chain.GetCurrentHeader()))
 }
 
-func (maker *BlockMaker) Finshlist() (*block.Header, *block.Body) {
-	//给minner调用的
-	maker.nextHeader.Timestamp = uint64(time.Now().Unix()) //理论上应该再封装，此处省略
-	maker.nextHeader.Nonce = 0
-	//下面循环使得新nonce合格
-	nonce := maker.nextHeader.Nonce
-	for {
-		nonce++
-		maker.nextHeader.Nonce = nonce
-		if maker.validNonce(maker.nextHeader.Hash()) {
-			break
+// executeBlock 在 evm 上重放区块里的交易并结算，检查gas、收据根和布隆与区块头一致；状态留在 evm 里还没提交
+func (maker *BlockMaker) executeBlock(header *block.Header, body *block.Body, evm *vm.VM) error {
+	evm.SetSigner(maker.signer())
+	evm.SetCoinbase(header.Coinbase)
+	evm.SetBaseFee(header.BaseFee)
+	evm.SetBlock(header.Height, header.Timestamp)
+	evm.DeferCommit()
+	//先并行恢复所有发送者，逐笔执行时直接用缓存
+	tx.CacheSenders(maker.signer(), body.Transactions)
+	for i, transaction := range body.Transactions {
+		if err := evm.ExecuteTransaction(transaction); err != nil {
+			return fmt.Errorf("block %d tx %d: %w", header.Height, i, err)
 		}
 	}
-	return maker.nextHeader, maker.nextBody
+	if used := evm.GetGasUsed(); used != header.GasUsed || used > header.GasLimit {
+		return fmt.Errorf("invalid gas used: have %d, header %d, limit %d", used, header.GasUsed, header.GasLimit)
+	}
+	if root := tx.ReceiptsRoot(evm.GetReceipts()); root != header.ReceiptRoot {
+		return fmt.Errorf("receipt root mismatch: have %x, want %x", root, header.ReceiptRoot)
+	}
+	if bloom := tx.CreateBloom(evm.GetReceipts()); bloom != header.Bloom {
+		return errors.New("invalid log bloom")
+	}
+	return maker.engine.Finalize(maker.chain, header, evm, body)
+}
+
+// totalSupply 父区块之后的总发行量加上本区块新发行的币、减去销毁的 baseFee，小费只是转移不改变总量
+func (maker *BlockMaker) totalSupply(header *block.Header, evm *vm.VM) uint64 {
+	var supply uint64
+	if header.Height > 0 {
+		supply, _ = maker.chain.GetTotalSupply(header.Height - 1)
+	}
+	return supply + evm.GetIssued() - evm.GetBurnt()
+}
+
+// baseFeeAfter 接在 parent 后面的区块应有的 baseFee，没启用 EIP-1559 时为nil
+func (maker *BlockMaker) baseFeeAfter(parent *block.Header) *big.Int {
+	london := maker.chainConfig.LondonBlock
+	if london == nil {
+		return nil
+	}
+	var height uint64
+	if parent != nil {
+		height = parent.Height + 1
+	}
+	if new(big.Int).SetUint64(height).Cmp(london) < 0 {
+		return nil
+	}
+	return block.CalcBaseFee(parent, maker.chainConfig.InitialBaseFee)
+}
+
+// commitBlock 封装待出块区块并接到链上
+func (maker *BlockMaker) commitBlock(stop <-chan struct{}) error {
+	parentRoot := maker.State.RootHash()
+	header, body, err := maker.Finshlist(stop)
+	if err != nil {
+		return err
+	}
+	if err := maker.writeReceipts(header, maker.vm.GetReceipts()); err != nil {
+		return maker.revertState(parentRoot, err)
+	}
+	if err := maker.chain.AddBlock(header, body, maker.State, maker.Txpool); err != nil {
+		return maker.revertState(parentRoot, err)
+	}
+	maker.updateSnapshot(maker.vm)
+	maker.chain.SetTotalSupply(header.Hash(), maker.totalSupply(header, maker.vm))
+	maker.Txpool.SetBaseFee(maker.baseFeeAfter(header))
+	maker.Txpool.SetHead(header.Height, header.Timestamp)
+	maker.nextHeader, maker.nextBody, maker.vm = nil, nil, nil
+
+	//然后广播
+	return maker.chain.Broadcast(header, body)
+}
+
+// writeReceipts 补上区块信息后把收据存进数据库，重启后仍可按交易哈希查询
+func (maker *BlockMaker) writeReceipts(header *block.Header, receipts []*tx.Receipt) error {
+	tx.DeriveFields(receipts, header.Hash(), header.Height)
+	return block.WriteReceipts(maker.State.DB, header.Hash(), receipts)
+}
+
+// updateSnapshot 区块写入的账户作为新的差异层，太旧的差异层合并进磁盘
+func (maker *BlockMaker) updateSnapshot(evm *vm.VM) {
+	if maker.snaps == nil {
+		return
+	}
+	parent, accounts := evm.GetStateDiff()
+	root := maker.State.RootHash()
+	if err := maker.snaps.Update(root, parent, accounts); err != nil {
+		//状态树在出块之外被改过，快照接不上，从状态树重新生成
+		if err := maker.snaps.Rebuild(maker.State); err != nil {
+			fmt.Println("重新生成状态快照失败:", err)
+		}
+		return
+	}
+	if err := maker.snaps.Cap(root, snapshot.DefaultLayers); err != nil {
+		fmt.Println("合并状态快照失败:", err)
+	}
 }
 
-func (maker *BlockMaker) validNonce(hash common.Hash) bool {
-	//这里理论上来说要写一些检查逻辑，对它的哈希逻辑做出检查，这里省略
-	return true
+// Snapshots returns the account snapshot consulted before the state trie, nil when unavailable
+func (maker *BlockMaker) Snapshots() *snapshot.Tree {
+	return maker.snaps
 }
 
-func (maker *BlockMaker) minnerRPC(minner common.Address, state *mpt.MPT) {
+// GetTransactionReceipt returns the receipt of a transaction included in a block
+func (maker *BlockMaker) GetTransactionReceipt(hash common.Hash) (*tx.Receipt, error) {
+	return block.ReadReceipt(maker.State.DB, hash)
+}
+
+// GetTransaction returns a transaction included in the canonical chain together with its receipt
+func (maker *BlockMaker) GetTransaction(hash common.Hash) (*tx.Transaction, *tx.Receipt, error) {
+	receipt, err := maker.GetTransactionReceipt(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	maker.mu.Lock()
+	body := maker.chain.GetBody(receipt.BlockHash)
+	maker.mu.Unlock()
+	//收据的序号就是交易在区块体里的位置
+	if body == nil || int(receipt.TxIndex) >= len(body.Transactions) {
+		return nil, nil, block.ErrReceiptNotFound
+	}
+	return body.Transactions[receipt.TxIndex].Copy(), receipt, nil
+}
+
+// GetReceipts returns the stored receipts of a block
+func (maker *BlockMaker) GetReceipts(blockHash common.Hash) ([]*tx.Receipt, error) {
+	return block.ReadReceipts(maker.State.DB, blockHash)
+}
+
+// SetGasLimit sets the gas limit of the blocks produced from now on
+func (maker *BlockMaker) SetGasLimit(limit uint64) {
+	maker.chainConfig.GasLimit = limit
+}
+
+// SetChainID sets the chain whose transactions are accepted by the pool and included in blocks
+func (maker *BlockMaker) SetChainID(chainID *big.Int) {
+	maker.mu.Lock()
+	maker.chainConfig.ChainID = chainID
+	maker.mu.Unlock()
+	maker.Txpool.SetSigner(tx.LatestSignerForChainID(chainID))
+}
+
+// SetLondonBlock enables EIP-1559 from the given height, the first block with a base fee uses initialBaseFee
+func (maker *BlockMaker) SetLondonBlock(height uint64, initialBaseFee *big.Int) error {
+	if initialBaseFee == nil || initialBaseFee.Sign() < 0 {
+		return errors.New("invalid initial base fee")
+	}
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	maker.chainConfig.LondonBlock = new(big.Int).SetUint64(height)
+	maker.chainConfig.InitialBaseFee = new(big.Int).Set(initialBaseFee)
+	//下一个区块可能就要带 baseFee，交易池按它接收动态手续费交易
+	maker.Txpool.SetBaseFee(maker.baseFeeAfter(maker.chain.GetCurrentHeader()))
+	return nil
+}
+
+// signer 本链交易的签名方案
+func (maker *BlockMaker) signer() tx.Signer {
+	return tx.LatestSignerForChainID(maker.chainConfig.ChainID)
+}
+
+// Engine returns the consensus engine the maker seals blocks with
+func (maker *BlockMaker) Engine() consensus.Engine {
+	return maker.engine
+}
+
+// Chain returns the local chain the maker extends
+func (maker *BlockMaker) Chain() *block.Blockchain {
+	return maker.chain
+}
+
+func (maker *BlockMaker) minnerRPC(minner common.Address) error {
 	//设置coinbase
-	fmt.Println("minner", minner, "开始奖励矿工")
 	maker.chainConfig.coinbase = minner //设置交易
 	fmt.Println("minner", minner, "设置coinbase成功")
 	maker.chainConfig.Duration = 1 * time.Second //设置打包时间
 	fmt.Println("minner", minner, "设置打包时间成功")
-	maker.vm = vm.NewVM(state)
-	maker.vm.Mint(minner) //奖励矿工
-	fmt.Println("minner", minner, "奖励矿工成功")
-	maker.NewBlock() //生成新的初始区块默认值（主要是区块头）
+	if err := maker.NewBlock(); err != nil { //生成新的初始区块默认值（主要是区块头）
+		return err
+	}
 	fmt.Println("minner", minner, "生成新的区块头成功")
 
 	//先执行
 	maker.Pack()
 	fmt.Println("minner", minner, "打包成功")
 
-	//然后打包
-	header, body := maker.Finshlist()
-	maker.chain.AddBlock(header, state, maker.Txpool)
-
-	//然后广播
-	maker.chain.Broadcast(header, body)
+	//然后结算奖励、封装并上链，封装太久就放弃
+	stop := make(chan struct{})
+	timer := time.AfterFunc(sealTimeout, func() { close(stop) })
+	defer timer.Stop()
+	return maker.commitBlock(stop)
 }
 
-func (maker *BlockMaker) MinnerRPC(minner common.Address) uint64 {
-	maker.minnerRPC(minner, maker.State)
-	// 确保在返回高度之前，CurrentHeader已经被正确设置
-	if maker.chain.CurrentHeader.Height == 0 && maker.nextHeader != nil {
-		// 如果CurrentHeader还没有被设置，但nextHeader存在，说明这是第一次挖矿
-		return 0
-	}
-	return maker.chain.CurrentHeader.Height
+// MinnerRPC produces one block with minner as coinbase and returns the height of the chain head,
+// the error tells why no block was added, for example the engine failed to seal it
+func (maker *BlockMaker) MinnerRPC(minner common.Address) (uint64, error) {
+	maker.mu.Lock()
+	defer maker.unlock()
+	err := maker.minnerRPC(minner)
+	return maker.chain.CurrentHeader.Height, err
 }
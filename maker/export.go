@@ -0,0 +1,159 @@
+package maker
+
+import (
+	"blockchain/block"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// exportedBlock 导出文件里的一条记录，文件就是这些记录的RLP编码首尾相接
+type exportedBlock struct {
+	Header *block.Header
+	Body   *block.Body
+}
+
+// ImportProgress 导入过程中每处理完一个区块报告一次
+type ImportProgress struct {
+	Height   uint64 //刚处理完的区块高度
+	Imported uint64 //本次新导入的区块数
+	Skipped  uint64 //本地链上已有、直接跳过的区块数
+}
+
+var errExportRange = errors.New("invalid export range")
+
+// getBlock 取规范链上某个高度的区块
+func (maker *BlockMaker) getBlock(height uint64) (*block.Header, *block.Body) {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	header := maker.chain.GetHeaderByHeight(height)
+	if header == nil {
+		return nil, nil
+	}
+	return header, maker.chain.GetBody(header.Hash())
+}
+
+// ExportChain writes the canonical blocks first..last to w as a concatenated RLP stream
+func (maker *BlockMaker) ExportChain(w io.Writer, first, last uint64) error {
+	head := maker.GetCurrentHeader()
+	if head == nil || first > last || last > head.Height {
+		return errExportRange
+	}
+	for height := first; height <= last; height++ {
+		header, body := maker.getBlock(height)
+		if header == nil || body == nil {
+			return fmt.Errorf("block %d missing", height)
+		}
+		if err := rlp.Encode(w, exportedBlock{Header: header, Body: body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportChainFile exports the blocks first..last into a file, gzip-compressed when the name ends in ".gz"
+func (maker *BlockMaker) ExportChainFile(path string, first, last uint64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := maker.exportTo(file, path, first, last); err != nil {
+		file.Close()
+		return err
+	}
+	//写缓存里的数据可能到关闭时才落盘失败
+	return file.Close()
+}
+
+// exportTo 写完后关闭 gzip 流，它的结尾要在关闭时才写出
+func (maker *BlockMaker) exportTo(file *os.File, path string, first, last uint64) error {
+	if !strings.HasSuffix(path, ".gz") {
+		buffered := bufio.NewWriter(file)
+		if err := maker.ExportChain(buffered, first, last); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+	gz := gzip.NewWriter(file)
+	buffered := bufio.NewWriter(gz)
+	if err := maker.ExportChain(buffered, first, last); err != nil {
+		gz.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportChain reads an exported RLP stream and imports every block through ImportBlock.
+// Blocks already on the local canonical chain are skipped, so an interrupted import can be
+// resumed by running it again on the same file. progress may be nil
+func (maker *BlockMaker) ImportChain(r io.Reader, progress func(ImportProgress)) (ImportProgress, error) {
+	var status ImportProgress
+	stream := rlp.NewStream(r, 0)
+	for {
+		var record exportedBlock
+		if err := stream.Decode(&record); err != nil {
+			if err == io.EOF {
+				return status, nil
+			}
+			//文件被截断时已导入的区块保留，下次从断点继续
+			return status, fmt.Errorf("block after %d imported: %v", status.Imported+status.Skipped, err)
+		}
+		header, body := record.Header, record.Body
+		if header == nil || body == nil {
+			return status, errors.New("malformed block record")
+		}
+		if local := maker.GetHeaderByHeight(header.Height); local != nil && local.Hash() == header.Hash() {
+			status.Skipped++
+		} else {
+			if err := maker.ImportBlock(header, body); err != nil {
+				return status, fmt.Errorf("import block %d: %v", header.Height, err)
+			}
+			status.Imported++
+		}
+		status.Height = header.Height
+		if progress != nil {
+			progress(status)
+		}
+	}
+}
+
+// ImportChainFile imports an exported file, gzip-compressed files are detected by their magic bytes
+func (maker *BlockMaker) ImportChainFile(path string, progress func(ImportProgress)) (ImportProgress, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	status, err := maker.importFrom(file, progress)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return status, err
+}
+
+// importFrom 关闭 gzip 流的错误也要返回
+func (maker *BlockMaker) importFrom(file *os.File, progress func(ImportProgress)) (ImportProgress, error) {
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return maker.ImportChain(reader, progress)
+	}
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	status, err := maker.ImportChain(gz, progress)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	return status, err
+}
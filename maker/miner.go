@@ -0,0 +1,182 @@
+package maker
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// chanSize 订阅链头和新交易事件的缓冲大小
+const chanSize = 16
+
+var errMinerRunning = errors.New("miner already running")
+
+// Miner 持续出块的服务：链头变化时重建待出块区块，交易池有新交易时继续往里打包，
+// 距上一个区块满 minInterval 且待出块区块里有交易时封装上链
+type Miner struct {
+	maker       *BlockMaker
+	coinbase    common.Address
+	minInterval time.Duration
+
+	lock    sync.Mutex
+	running bool
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// NewMiner creates a miner producing blocks on the maker for the given coinbase
+func NewMiner(maker *BlockMaker, coinbase common.Address, minInterval time.Duration) *Miner {
+	return &Miner{
+		maker:       maker,
+		coinbase:    coinbase,
+		minInterval: minInterval,
+	}
+}
+
+// Start launches the production loop
+func (m *Miner) Start() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.running {
+		return errMinerRunning
+	}
+	m.running = true
+	m.quit = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.loop(m.quit, m.done)
+	return nil
+}
+
+// Stop halts the loop and waits for it to exit, a block being sealed is finished first
+func (m *Miner) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.running {
+		return
+	}
+	close(m.quit)
+	<-m.done
+	m.running = false
+}
+
+// Mining reports whether the loop is running
+func (m *Miner) Mining() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.running
+}
+
+// Pending returns the block the miner is currently assembling
+func (m *Miner) Pending() (*block.Header, *block.Body) {
+	return m.maker.Pending()
+}
+
+func (m *Miner) loop(quit, done chan struct{}) {
+	defer close(done)
+
+	headCh := make(chan block.ChainHeadEvent, chanSize)
+	headSub := m.maker.chain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+	txCh := make(chan tx.NewTxsEvent, chanSize)
+	txSub := m.maker.Txpool.SubscribeNewTxsEvent(txCh)
+	defer txSub.Unsubscribe()
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+	lastBlock := time.Time{} //最近一次链头变化的时间
+
+	// schedule 待出块区块可以封装时，按最小出块间隔设置定时器
+	schedule := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if m.ready() {
+			timer.Reset(time.Until(lastBlock.Add(m.minInterval)))
+		}
+	}
+
+	m.commitNewWork()
+	schedule()
+	for {
+		select {
+		case <-headCh:
+			lastBlock = time.Now()
+			m.commitNewWork()
+			schedule()
+		case <-txCh:
+			m.commitTransactions()
+			schedule()
+		case <-timer.C:
+			//出块后的链头事件会触发下一轮；Stop 时放弃正在进行的封装
+			m.seal(quit)
+		case <-quit:
+			m.maker.mu.Lock()
+			m.maker.discardPending()
+			m.maker.mu.Unlock()
+			return
+		}
+	}
+}
+
+// commitNewWork 在当前链头上重新开始一个待出块区块
+func (m *Miner) commitNewWork() {
+	m.maker.mu.Lock()
+	defer m.maker.mu.Unlock()
+	m.maker.chainConfig.coinbase = m.coinbase
+	if err := m.maker.NewBlock(); err != nil {
+		fmt.Println("miner: 创建待出块区块失败:", err)
+		m.maker.discardPending()
+		return
+	}
+	if err := m.maker.Pack(); err != nil {
+		fmt.Println("miner: 打包失败:", err)
+	}
+}
+
+// commitTransactions 把交易池里的新交易继续打包进待出块区块
+func (m *Miner) commitTransactions() {
+	m.maker.mu.Lock()
+	pending := m.maker.nextHeader != nil
+	if pending {
+		if err := m.maker.Pack(); err != nil {
+			fmt.Println("miner: 打包失败:", err)
+		}
+	}
+	m.maker.mu.Unlock()
+	if !pending {
+		m.commitNewWork()
+	}
+}
+
+// ready 待出块区块有交易，或者链上还没有创世区块
+func (m *Miner) ready() bool {
+	m.maker.mu.Lock()
+	defer m.maker.mu.Unlock()
+	if m.maker.nextHeader == nil {
+		return false
+	}
+	return m.maker.chain.Empty() || len(m.maker.nextBody.Transactions) > 0
+}
+
+func (m *Miner) seal(stop <-chan struct{}) {
+	m.maker.mu.Lock()
+	defer m.maker.unlock()
+	if m.maker.nextHeader == nil {
+		return
+	}
+	header := m.maker.nextHeader
+	if err := m.maker.commitBlock(stop); err != nil {
+		fmt.Println("miner: 出块失败:", err)
+		m.maker.discardPending()
+		return
+	}
+	fmt.Println("miner", m.coinbase, "出块成功，高度为", header.Height)
+}
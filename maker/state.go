@@ -0,0 +1,122 @@
+package maker
+
+import (
+	"blockchain/block"
+	"blockchain/common"
+	"blockchain/mmr"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"blockchain/vm"
+	"errors"
+	"strconv"
+)
+
+// 查询状态时可用的区块标签，其余按区块高度解析（十进制或0x开头的十六进制）
+const (
+	PendingBlock  = "pending"  //正在打包、还没封装的区块
+	LatestBlock   = "latest"   //链头
+	EarliestBlock = "earliest" //创世区块
+)
+
+var errUnknownBlock = errors.New("unknown block")
+
+// PendingSnapshot returns a copy of the block under construction together with a read-only view
+// of its post-state, taken at the same moment; all nil when nothing is being assembled
+func (maker *BlockMaker) PendingSnapshot() (*block.Header, *block.Body, *vm.VM, error) {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	if maker.nextHeader == nil {
+		return nil, nil, nil, nil
+	}
+	//待出块区块建在状态树的当前根上，它的修改还在vm里没有写入
+	base, err := mpt.NewMPTWithRoot(maker.State.DB, maker.State.RootHash())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	header := *maker.nextHeader
+	header.GasUsed = maker.vm.GetGasUsed()
+	body := &block.Body{Transactions: append([]*tx.Transaction{}, maker.nextBody.Transactions...)}
+	return &header, body, maker.vm.Fork(base), nil
+}
+
+// Pending returns a copy of the block being assembled, nil when there is none
+func (maker *BlockMaker) Pending() (*block.Header, *block.Body) {
+	header, body, _, _ := maker.PendingSnapshot()
+	return header, body
+}
+
+// StateAt returns a read-only view of the state after the given block: "pending", "latest",
+// "earliest" or a height. Without a pending block "pending" falls back to "latest"
+func (maker *BlockMaker) StateAt(blockNumber string) (*vm.VM, error) {
+	if blockNumber == PendingBlock {
+		if _, _, state, err := maker.PendingSnapshot(); err != nil || state != nil {
+			return state, err
+		}
+		blockNumber = LatestBlock
+	}
+	trie, err := maker.StateTrieAt(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	state := vm.NewVM(trie)
+	state.SetSnapshots(maker.snaps)
+	state.SetSigner(maker.signer())
+	state.DeferCommit()
+	return state, nil
+}
+
+// StateTrieAt opens the committed state trie after the given block: "latest", "earliest" or a height
+func (maker *BlockMaker) StateTrieAt(blockNumber string) (*mpt.MPT, error) {
+	var root common.Hash
+	switch blockNumber {
+	case LatestBlock, "":
+		maker.mu.Lock()
+		root = maker.State.RootHash()
+		maker.mu.Unlock()
+	default:
+		height := uint64(0)
+		if blockNumber != EarliestBlock {
+			var err error
+			if height, err = strconv.ParseUint(blockNumber, 0, 64); err != nil {
+				return nil, errUnknownBlock
+			}
+		}
+		header := maker.GetHeaderByHeight(height)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		root = header.Root
+	}
+	//旧的状态树节点一直留在数据库里，按根哈希就能打开
+	return mpt.NewMPTWithRoot(maker.State.DB, root)
+}
+
+// GetHeaderByHeight returns the canonical header at the given height, safe to call while mining
+func (maker *BlockMaker) GetHeaderByHeight(height uint64) *block.Header {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	return maker.chain.GetHeaderByHeight(height)
+}
+
+// GetCurrentHeader returns the head of the canonical chain, safe to call while mining
+func (maker *BlockMaker) GetCurrentHeader() *block.Header {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	return maker.chain.GetCurrentHeader()
+}
+
+// GetAncestorProof proves that the canonical block at height is an ancestor of the current head
+func (maker *BlockMaker) GetAncestorProof(height uint64) (*mmr.MMRProof, error) {
+	maker.mu.Lock()
+	defer maker.mu.Unlock()
+	return maker.chain.GetAncestorProof(height)
+}
+
+// GetAccountProof returns the state trie nodes proving the account of addr under the given state root
+func (maker *BlockMaker) GetAccountProof(root common.Hash, addr common.Address) ([][]byte, error) {
+	trie, err := mpt.NewMPTWithRoot(maker.State.DB, root)
+	if err != nil {
+		return nil, err
+	}
+	return trie.Prove(addr.Bytes())
+}
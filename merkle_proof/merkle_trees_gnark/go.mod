@@ -3,6 +3,7 @@ module merkle-tree-gnark
 go 1.21.4
 
 require (
+	blockchain/mmr v0.0.0
 	github.com/consensys/gnark v0.9.1
 	github.com/consensys/gnark-crypto v0.12.2-0.20231013160410-1f65e75b6dfb
 	github.com/stretchr/testify v1.8.4
@@ -27,3 +28,5 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
+
+replace blockchain/mmr => ../../mmr
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"testing"
 
+	"blockchain/mmr"
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark-crypto/hash"
 	"github.com/consensys/gnark/frontend"
@@ -24,14 +25,14 @@ func TestSimpleMMR(t *testing.T) {
 	var leaves [][]byte
 	mod := ecc.BN254.ScalarField()
 
-	mmr := New(hash.MIMC_BN254.New())
+	m := mmr.New(hash.MIMC_BN254.New())
 	for i := 0; i < nrLeaves; i++ {
 		leaf, err := rand.Int(rand.Reader, mod)
 		assert.NoError(err)
 		// make sure each leaf has 32 bytes
 		b := fill32Bytes(leaf)
 		leaves = append(leaves, b)
-		mmr.AddLeaf(b)
+		m.AddLeaf(b)
 	}
 
 	// standardIndex := 8
@@ -41,8 +42,8 @@ func TestSimpleMMR(t *testing.T) {
 	// standardIndex := 0
 	// leafIndex := 0
 
-	proof := mmr.GetProof(uint64(leafIndex))
-	root := mmr.BaggingThePeaks(hash.MIMC_BN254.New())
+	proof := m.GetProof(uint64(leafIndex))
+	root := m.BaggingThePeaks(hash.MIMC_BN254.New())
 	verified := proof.Verify(leaves[standardIndex], root, hash.MIMC_BN254.New())
 	// Check the proof is correct in normal Golang
 	assert.True((verified))
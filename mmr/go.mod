@@ -0,0 +1,3 @@
+module blockchain/mmr
+
+go 1.21
@@ -1,4 +1,9 @@
-package main
+// Package mmr implements a Merkle Mountain Range, an append-only accumulator whose
+// proofs show that a leaf is committed by a root.
+//
+// 只依赖标准库，单独成一个模块：merkle_proof/merkle_trees_gnark 的电路依赖旧的 gnark-crypto，
+// 不能引入整个 blockchain 模块，但可以和链上共用这一份实现
+package mmr
 
 import (
 	"bytes"
@@ -33,6 +38,66 @@ func New(h hash.Hash) *MMR {
 	}
 }
 
+// Size returns the number of elements (leaves and inner nodes) in the MMR
+func (mmr *MMR) Size() uint64 {
+	return uint64(len(mmr.elements))
+}
+
+// LeafCount returns the number of leaves added so far
+func (mmr *MMR) LeafCount() uint64 {
+	return LeafCountForMMRSize(mmr.Size())
+}
+
+// MMRSizeForLeaves returns the number of elements of an MMR holding the given number of leaves:
+// every leaf adds itself plus one inner node per merged peak, 2n - popcount(n) in total
+func MMRSizeForLeaves(leaves uint64) uint64 {
+	return 2*leaves - uint64(bits.OnesCount64(leaves))
+}
+
+// LeafIndex returns the mmr index of the n-th leaf (counting from 0), as used by GetProof
+func LeafIndex(leaf uint64) uint64 {
+	return MMRSizeForLeaves(leaf)
+}
+
+// LeafCountForMMRSize is the inverse of MMRSizeForLeaves for valid sizes
+func LeafCountForMMRSize(size uint64) uint64 {
+	// each peak of height x holds 2^x leaves
+	peaks, _ := HeightBitmapForMMRSize(size)
+	var leaves uint64
+	for height := uint64(0); peaks > 0; height++ {
+		if peaks&1 == 1 {
+			leaves += 1 << height
+		}
+		peaks >>= 1
+	}
+	return leaves
+}
+
+// Root bags the peaks with the MMR's own hash function
+func (mmr *MMR) Root() []byte {
+	return mmr.BaggingThePeaks(mmr.hash)
+}
+
+// AtLeaves returns a read-only view of the MMR as it was when it held the given number of leaves.
+// The MMR is append-only, so that is a prefix of the elements; the view must not be appended to
+func (mmr *MMR) AtLeaves(leaves uint64) (*MMR, error) {
+	size := MMRSizeForLeaves(leaves)
+	if size > mmr.Size() {
+		return nil, errFewerLeaves
+	}
+	return &MMR{mmr.elements[:size:size], mmr.hash}, nil
+}
+
+// Rewind drops the leaves added after the MMR held the given number of leaves, e.g. on a reorg
+func (mmr *MMR) Rewind(leaves uint64) error {
+	size := MMRSizeForLeaves(leaves)
+	if size > mmr.Size() {
+		return errFewerLeaves
+	}
+	mmr.elements = mmr.elements[:size]
+	return nil
+}
+
 // Return a number whose bits represent at what heights there are peaks + the height of the next element to be added
 // There is always at most 1 peak at each height, because if there are multiple, they get hashed together to a new peak
 // A bit set in a position means there is a peak there. Counting starts from the right at height 0.
@@ -126,62 +191,98 @@ func (mmr *MMR) AddLeaf(leaf []byte) {
 
 }
 
+// nodeReader gives positional access to the elements, so the in-memory and the stored MMR
+// share the proof and peak computations
+type nodeReader interface {
+	Size() uint64
+	node(pos uint64) ([]byte, error)
+}
+
+func (mmr *MMR) node(pos uint64) ([]byte, error) {
+	return mmr.elements[pos], nil
+}
+
 // addRightElm adds a proof element to the MMR proof, that should be hashed on the right side.
 // It returns an updated slice of ProofElements, the nextIndex and a boolean indicating whether we're still operating within the tree.
-func addRightElm(currIndex uint64, height uint32, mmr *MMR, proofElms []ProofElement) ([]ProofElement, uint64, bool) {
+func addRightElm(currIndex uint64, height uint32, mmr nodeReader, proofElms []ProofElement) ([]ProofElement, uint64, bool, error) {
 	nextElmIndex := currIndex + (1<<(height+1) - 1)
-	if nextElmIndex < uint64(len(mmr.elements)-1) {
+	if nextElmIndex < mmr.Size()-1 {
+		hash, err := mmr.node(nextElmIndex)
+		if err != nil {
+			return nil, 0, false, err
+		}
 		proofElms = append(proofElms, ProofElement{
-			Hash:   mmr.elements[nextElmIndex],
+			Hash:   hash,
 			IsLeft: false,
 		})
-		return proofElms, nextElmIndex + 1, true
+		return proofElms, nextElmIndex + 1, true, nil
 	}
 	// the index doesn't change any further, intree = false so it will stop after this
-	return proofElms, currIndex, false
+	return proofElms, currIndex, false, nil
 }
 
 // returns Merkle Proof for the element with given mmrIndex wrt the subtree it is in
 func (mmr *MMR) GetSubtreeProofElm(mmrIndex uint64) []ProofElement {
+	proofElms, _ := subtreeProof(mmr, mmrIndex)
+	return proofElms
+}
+
+func subtreeProof(mmr nodeReader, mmrIndex uint64) ([]ProofElement, error) {
 	var proofElms []ProofElement
 	currIndex := mmrIndex
 	inTree := true
 	height := uint32(0)
 
+	var err error
 	for inTree {
 		if currIndex >= ((1 << (height + 1)) - 1) {
 			prevElmIndex := currIndex - ((1 << (height + 1)) - 1)
 			_, heightPrevElm := HeightBitmapForMMRSize(prevElmIndex)
 			if heightPrevElm == uint64(height) {
-				proofElms = append(proofElms, ProofElement{Hash: mmr.elements[prevElmIndex], IsLeft: true})
+				hash, err := mmr.node(prevElmIndex)
+				if err != nil {
+					return nil, err
+				}
+				proofElms = append(proofElms, ProofElement{Hash: hash, IsLeft: true})
 				currIndex++
 			} else {
-				proofElms, currIndex, inTree = addRightElm(currIndex, height, mmr, proofElms)
+				proofElms, currIndex, inTree, err = addRightElm(currIndex, height, mmr, proofElms)
 			}
 		} else {
-			proofElms, currIndex, inTree = addRightElm(currIndex, height, mmr, proofElms)
+			proofElms, currIndex, inTree, err = addRightElm(currIndex, height, mmr, proofElms)
+		}
+		if err != nil {
+			return nil, err
 		}
 		height++
 	}
-	return proofElms
+	return proofElms, nil
 }
 
 // returns all peaks of the MMR
 func (mmr *MMR) GetPeaks() [][]byte {
 	var peaks [][]byte
-	mmrLen := len(mmr.elements)
+	for _, pos := range peakPositions(mmr.Size()) {
+		peaks = append(peaks, mmr.elements[pos])
+	}
+	return peaks
+}
+
+// peakPositions returns the positions of the peaks of an MMR with the given size, left to right
+func peakPositions(mmrLen uint64) []uint64 {
+	var positions []uint64
 
 	// Try to fit in peaks until we get to the current position
-	maxTreeSize := uint64(math.MaxUint64 >> bits.LeadingZeros64(uint64(mmrLen)))
-	currentIndex := uint64(mmrLen)
+	maxTreeSize := uint64(math.MaxUint64 >> bits.LeadingZeros64(mmrLen))
+	currentIndex := mmrLen
 	var peakPos uint64 = 0
 
 	for maxTreeSize > 0 {
 		if currentIndex >= maxTreeSize {
 			peakPos += maxTreeSize
 
-			if peakPos-1 < uint64(len(mmr.elements)) {
-				peaks = append(peaks, mmr.elements[peakPos-1])
+			if peakPos-1 < mmrLen {
+				positions = append(positions, peakPos-1)
 			}
 			currentIndex -= maxTreeSize
 		}
@@ -189,7 +290,7 @@ func (mmr *MMR) GetPeaks() [][]byte {
 		maxTreeSize >>= 1
 	}
 
-	return peaks
+	return positions
 }
 
 // returns an MMRProof for leaf with given (mmr) index
@@ -0,0 +1,214 @@
+package mmr
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sync"
+)
+
+// KeyValueStore 存放节点的键值数据库，mpt.DB 即满足
+type KeyValueStore interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+}
+
+var (
+	errReadOnly     = errors.New("mmr view is read-only")
+	errFewerLeaves  = errors.New("mmr has fewer leaves")
+	errMissingNode  = errors.New("mmr node missing from store")
+	errIndexOutside = errors.New("mmr index out of range")
+)
+
+// PersistentMMR 节点按位置存在数据库里的MMR，只在内存里缓存山峰，
+// 根和证明与同样叶子的内存 MMR 完全一致
+type PersistentMMR struct {
+	db     KeyValueStore
+	prefix []byte //同一个数据库里可以放多个MMR
+	hash   hash.Hash
+
+	size     uint64
+	peaks    [][]byte //从左到右的山峰
+	readOnly bool
+}
+
+// NewPersistent opens the MMR stored under prefix in db, an empty store yields an empty MMR
+func NewPersistent(db KeyValueStore, prefix []byte, h hash.Hash) (*PersistentMMR, error) {
+	mmr := &PersistentMMR{db: db, prefix: append([]byte{}, prefix...), hash: h}
+	if data, err := db.Get(mmr.sizeKey()); err == nil && len(data) == 8 {
+		mmr.size = binary.BigEndian.Uint64(data)
+	}
+	if err := mmr.loadPeaks(); err != nil {
+		return nil, err
+	}
+	return mmr, nil
+}
+
+func (mmr *PersistentMMR) sizeKey() []byte {
+	return append(append([]byte{}, mmr.prefix...), "size"...)
+}
+
+func (mmr *PersistentMMR) nodeKey(pos uint64) []byte {
+	key := append(append([]byte{}, mmr.prefix...), "node"...)
+	return binary.BigEndian.AppendUint64(key, pos)
+}
+
+func (mmr *PersistentMMR) node(pos uint64) ([]byte, error) {
+	if pos >= mmr.size {
+		return nil, errIndexOutside
+	}
+	data, err := mmr.db.Get(mmr.nodeKey(pos))
+	if err != nil {
+		return nil, errMissingNode
+	}
+	return data, nil
+}
+
+func (mmr *PersistentMMR) loadPeaks() error {
+	positions := peakPositions(mmr.size)
+	peaks := make([][]byte, len(positions))
+	for i, pos := range positions {
+		peak, err := mmr.node(pos)
+		if err != nil {
+			return err
+		}
+		peaks[i] = peak
+	}
+	mmr.peaks = peaks
+	return nil
+}
+
+// Size returns the number of stored elements (leaves and inner nodes)
+func (mmr *PersistentMMR) Size() uint64 {
+	return mmr.size
+}
+
+// LeafCount returns the number of leaves added so far
+func (mmr *PersistentMMR) LeafCount() uint64 {
+	return LeafCountForMMRSize(mmr.size)
+}
+
+// AddLeaf hashes and appends a leaf, merging equal-height peaks like MMR.AddLeaf
+func (mmr *PersistentMMR) AddLeaf(leaf []byte) error {
+	if mmr.readOnly {
+		return errReadOnly
+	}
+	mmr.hash.Reset()
+	if _, err := mmr.hash.Write(leaf); err != nil {
+		return err
+	}
+	next := mmr.hash.Sum(nil)
+
+	//先写节点，最后写大小：中途失败时多出来的节点不算数，下次追加会覆盖
+	peaks, _ := HeightBitmapForMMRSize(mmr.size)
+	size := mmr.size
+	if err := mmr.db.Put(mmr.nodeKey(size), next); err != nil {
+		return err
+	}
+	size++
+	merged := mmr.peaks
+	for peaks&1 == 1 {
+		//和最右边的山峰合并成更高的一座
+		prev := merged[len(merged)-1]
+		merged = merged[:len(merged)-1]
+		mmr.hash.Reset()
+		mmr.hash.Write(prev)
+		mmr.hash.Write(next)
+		next = mmr.hash.Sum(nil)
+		if err := mmr.db.Put(mmr.nodeKey(size), next); err != nil {
+			return err
+		}
+		size++
+		peaks >>= 1
+	}
+	if err := mmr.db.Put(mmr.sizeKey(), binary.BigEndian.AppendUint64(nil, size)); err != nil {
+		return err
+	}
+	mmr.size = size
+	mmr.peaks = append(merged[:len(merged):len(merged)], next)
+	return nil
+}
+
+// GetPeaks returns the cached peaks, left to right
+func (mmr *PersistentMMR) GetPeaks() [][]byte {
+	return mmr.peaks
+}
+
+// Root bags the peaks with the MMR's hash function
+func (mmr *PersistentMMR) Root() []byte {
+	mmr.hash.Reset()
+	for _, peak := range mmr.peaks {
+		mmr.hash.Write(peak)
+	}
+	return mmr.hash.Sum(nil)
+}
+
+// GetProof returns an MMRProof for the element at the given mmr index, see MMR.GetProof
+func (mmr *PersistentMMR) GetProof(mmrIndex uint64) (MMRProof, error) {
+	if mmrIndex >= mmr.size {
+		return MMRProof{}, errIndexOutside
+	}
+	path, err := subtreeProof(mmr, mmrIndex)
+	if err != nil {
+		return MMRProof{}, err
+	}
+	return MMRProof{MerkleProof: path, Peaks: mmr.peaks, Hash: mmr.hash}, nil
+}
+
+// AtLeaves returns a read-only view of the MMR as it was with the given number of leaves
+func (mmr *PersistentMMR) AtLeaves(leaves uint64) (*PersistentMMR, error) {
+	size := MMRSizeForLeaves(leaves)
+	if size > mmr.size {
+		return nil, errFewerLeaves
+	}
+	view := &PersistentMMR{db: mmr.db, prefix: mmr.prefix, hash: mmr.hash, size: size, readOnly: true}
+	if err := view.loadPeaks(); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// Rewind drops the leaves added after the MMR held the given number of leaves, e.g. on a reorg.
+// The dropped nodes stay in the store and are overwritten by later appends
+func (mmr *PersistentMMR) Rewind(leaves uint64) error {
+	if mmr.readOnly {
+		return errReadOnly
+	}
+	size := MMRSizeForLeaves(leaves)
+	if size > mmr.size {
+		return errFewerLeaves
+	}
+	if err := mmr.db.Put(mmr.sizeKey(), binary.BigEndian.AppendUint64(nil, size)); err != nil {
+		return err
+	}
+	mmr.size = size
+	return mmr.loadPeaks()
+}
+
+// MemoryStore 放在内存里的 KeyValueStore，不需要落盘时使用
+type MemoryStore struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, errMissingNode
+	}
+	return value, nil
+}
+
+func (s *MemoryStore) Put(key, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
@@ -0,0 +1,49 @@
+package mpt
+
+import (
+	"fmt"
+)
+
+// ForEach calls fn for every key stored in a leaf, in ascending key order, stopping at the first error.
+// Values set on branch nodes are only kept as hashes and are not visited
+func (m *MPT) ForEach(fn func(key, value []byte) error) error {
+	m.lock.Lock()
+	root := m.Root
+	m.lock.Unlock()
+	if root == nil {
+		return nil
+	}
+	return m.walk(root, nil, fn)
+}
+
+// walk 深度优先遍历，path 是从根走到当前节点经过的半字节
+func (m *MPT) walk(node Node, path []byte, fn func(key, value []byte) error) error {
+	switch n := node.(type) {
+	case hashNode:
+		child, err := m.LoadNode(n.GetHash())
+		if err != nil {
+			return err
+		}
+		return m.walk(child, path, fn)
+	case *LeafNode:
+		return fn(nibblesToBytes(append(append([]byte{}, path...), n.Key...)), n.Value)
+	case *ExtensionNode:
+		child, err := m.LoadNode(n.Value)
+		if err != nil {
+			return err
+		}
+		return m.walk(child, append(append([]byte{}, path...), n.Path...), fn)
+	case *FullNode:
+		for i, child := range n.Children[:16] {
+			if child == nil {
+				continue
+			}
+			if err := m.walk(child, append(append([]byte{}, path...), byte(i)), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown node type")
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"blockchain/common"
 	"bytes"
 	"fmt"
+	"sync"
 )
 
 // MPT represents a Merkle Patricia Trie
 type MPT struct {
 	Root Node
 	DB   *DB
+
+	lock sync.Mutex //出块协程和rpc会同时读写状态树
 }
 
 // NewMPT creates a new MPT instance
@@ -20,6 +23,20 @@ func NewMPT(db *DB) *MPT {
 	}
 }
 
+// NewMPTWithRoot opens the trie committed under root, e.g. the state of an earlier block
+func NewMPTWithRoot(db *DB, root common.Hash) (*MPT, error) {
+	m := NewMPT(db)
+	if root == (common.Hash{}) {
+		return m, nil
+	}
+	node, err := m.LoadNode(root)
+	if err != nil {
+		return nil, err
+	}
+	m.Root = node
+	return m, nil
+}
+
 // LoadNode loads a node from the database by its hash
 func (m *MPT) LoadNode(hash common.Hash) (Node, error) {
 	// Get the node data from database
@@ -37,6 +54,9 @@ func (m *MPT) LoadNode(hash common.Hash) (Node, error) {
 
 // Put inserts or updates a key-value pair in the trie
 func (m *MPT) Put(key, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	// Convert key to nibbles (hex)
 	nibbles := keyToNibbles(key)
 	fmt.Printf("Put: key=%x, value=%x, nibbles=%x\n", key, value, nibbles)
@@ -64,6 +84,9 @@ func (m *MPT) Put(key, value []byte) error {
 
 // Get retrieves the value for a given key
 func (m *MPT) Get(key []byte) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if m.Root == nil {
 		return nil, fmt.Errorf("empty trie")
 	}
@@ -76,8 +99,37 @@ func (m *MPT) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
+// RootHash returns the hash of the root node, or the zero hash for an empty trie
+func (m *MPT) RootHash() common.Hash {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Root == nil {
+		return common.Hash{}
+	}
+	return m.Root.GetHash()
+}
+
+// Reset moves the trie back to a root committed earlier, discarding the changes made after it
+func (m *MPT) Reset(root common.Hash) error {
+	var node Node
+	if root != (common.Hash{}) {
+		var err error
+		if node, err = m.LoadNode(root); err != nil {
+			return err
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Root = node
+	return nil
+}
+
 // Delete removes a key-value pair from the trie
 func (m *MPT) Delete(key []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if m.Root == nil {
 		return fmt.Errorf("empty trie")
 	}
@@ -97,6 +149,13 @@ func (m *MPT) Delete(key []byte) error {
 // insert recursively inserts a key-value pair into the trie
 func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 	switch n := node.(type) {
+	case hashNode:
+		child, err := m.LoadNode(common.Hash(n))
+		if err != nil {
+			return nil, err
+		}
+		return m.insert(child, nibbles, value)
+
 	case *LeafNode:
 		fmt.Printf("LeafNode insert: existing key=%x, new nibbles=%x, commonPrefix=%x\n", n.Key, nibbles, findCommonPrefix(n.Key, nibbles))
 		commonPrefix := findCommonPrefix(n.Key, nibbles)
@@ -104,6 +163,7 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 		// 如果键完全匹配，更新值
 		if bytes.Equal(n.Key, nibbles) {
 			n.Value = value
+			n.flags = nodeFlag{} // 节点内容已变，清掉缓存的哈希
 			fmt.Printf("Update existing leaf: key=%x, new value=%x\n", n.Key, value)
 			if err := m.saveNode(n); err != nil {
 				return nil, err
@@ -177,16 +237,24 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 			// Add the existing extension node's path
 			if len(n.Path[len(commonPrefix):]) > 0 {
 				idx := n.Path[len(commonPrefix)]
-				ext := &ExtensionNode{
-					NodeType: ExtensionNodeType,
-					Path:     n.Path[len(commonPrefix)+1:],
-					Value:    n.Value,
-					flags:    nodeFlag{},
-				}
-				if err := m.saveNode(ext); err != nil {
-					return nil, err
+				if len(n.Path) == len(commonPrefix)+1 {
+					//路径只剩这一位时分支节点直接指向原来的子节点，不留空路径的扩展节点，
+					//这样同样的键值不论按什么顺序插入都得到同一棵树。
+					//旧版本在这里会留下空路径的扩展节点：存下来的树照样能读，
+					//但之后遇到这种分叉时新旧版本算出的根不同，节点需要一起升级
+					branch.Children[idx] = hashNode(n.Value)
+				} else {
+					ext := &ExtensionNode{
+						NodeType: ExtensionNodeType,
+						Path:     n.Path[len(commonPrefix)+1:],
+						Value:    n.Value,
+						flags:    nodeFlag{},
+					}
+					if err := m.saveNode(ext); err != nil {
+						return nil, err
+					}
+					branch.Children[idx] = ext
 				}
-				branch.Children[idx] = ext
 			}
 
 			// Add the new path
@@ -235,6 +303,7 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 			return nil, err
 		}
 		n.Value = newChild.GetHash()
+		n.flags = nodeFlag{}
 		if err := m.saveNode(n); err != nil {
 			return nil, err
 		}
@@ -245,6 +314,7 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 			var hash common.Hash
 			hash.NewHash(value)
 			n.Value = hash
+			n.flags = nodeFlag{}
 			if err := m.saveNode(n); err != nil {
 				return nil, err
 			}
@@ -265,6 +335,7 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 				return nil, err
 			}
 			n.Children[idx] = leaf
+			n.flags = nodeFlag{}
 		} else {
 			// Insert into existing child
 			newChild, err := m.insert(child, nibbles[1:], value)
@@ -272,6 +343,7 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 				return nil, err
 			}
 			n.Children[idx] = newChild
+			n.flags = nodeFlag{}
 		}
 		if err := m.saveNode(n); err != nil {
 			return nil, err
@@ -286,6 +358,13 @@ func (m *MPT) insert(node Node, nibbles []byte, value []byte) (Node, error) {
 // get recursively retrieves a value from the trie
 func (m *MPT) get(node Node, nibbles []byte) ([]byte, error) {
 	switch n := node.(type) {
+	case hashNode:
+		child, err := m.LoadNode(common.Hash(n))
+		if err != nil {
+			return nil, err
+		}
+		return m.get(child, nibbles)
+
 	case *LeafNode:
 		fmt.Printf("LeafNode: key=%x, value=%x\n", n.Key, n.Value)
 		// 如果叶子节点的 key 为空，说明这是一个分支节点的直接子节点，直接返回其 value
@@ -351,6 +430,13 @@ func (m *MPT) get(node Node, nibbles []byte) ([]byte, error) {
 // delete recursively removes a key-value pair from the trie
 func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 	switch n := node.(type) {
+	case hashNode:
+		child, err := m.LoadNode(common.Hash(n))
+		if err != nil {
+			return nil, err
+		}
+		return m.delete(child, nibbles)
+
 	case *LeafNode:
 		// 如果键完全匹配，返回 nil 表示删除成功
 		if bytes.Equal(n.Key, nibbles) {
@@ -375,6 +461,7 @@ func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 			return nil, nil
 		}
 		n.Value = newChild.GetHash()
+		n.flags = nodeFlag{}
 		if err := m.saveNode(n); err != nil {
 			return nil, err
 		}
@@ -383,6 +470,7 @@ func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 	case *FullNode:
 		if len(nibbles) == 0 {
 			n.Value = common.Hash{}
+			n.flags = nodeFlag{}
 			if err := m.saveNode(n); err != nil {
 				return nil, err
 			}
@@ -399,6 +487,7 @@ func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 		}
 		if newChild == nil {
 			n.Children[idx] = nil
+			n.flags = nodeFlag{}
 			// 检查是否可以合并这个分支节点
 			nonNilChildren := 0
 			var lastChild Node
@@ -417,6 +506,7 @@ func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 			}
 		} else {
 			n.Children[idx] = newChild
+			n.flags = nodeFlag{}
 		}
 		if err := m.saveNode(n); err != nil {
 			return nil, err
@@ -430,6 +520,10 @@ func (m *MPT) delete(node Node, nibbles []byte) (Node, error) {
 
 // saveNode saves a node to the database
 func (m *MPT) saveNode(node Node) error {
+	// 只有哈希的子节点本来就在数据库里
+	if _, ok := node.(hashNode); ok {
+		return nil
+	}
 	// 先保存所有子节点
 	// 检查节点是否为FullNode类型,如果是则将node转换为*FullNode类型并赋值给fullNode变量
 	if fullNode, ok := node.(*FullNode); ok {
@@ -499,4 +593,3 @@ func hasPrefix(s, prefix []byte) bool {
 
 
 
-
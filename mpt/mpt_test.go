@@ -286,3 +286,40 @@ func TestMPT_LongKey(t *testing.T) {
 		t.Errorf("Expected value %s for long key, got %s", value, retrievedValue)
 	}
 }
+
+// 扩展节点在只剩一位路径的地方分叉时，树的形状不能取决于插入顺序，
+// 否则按别的顺序重新插入同样的键值（比如从状态导出恢复）算不出原来的根
+func TestMPT_RootIndependentOfInsertOrder(t *testing.T) {
+	keys := [][]byte{{0x12, 0x34}, {0x12, 0x35}, {0x12, 0x00}}
+	orders := [][]int{{0, 1, 2}, {2, 0, 1}, {1, 2, 0}}
+
+	var roots []string
+	for i, order := range orders {
+		dbPath := "test_db_insert_order"
+		cleanupDB(dbPath)
+		db, err := NewDB(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to create DB: %v", err)
+		}
+		mpt := NewMPT(db)
+		for _, k := range order {
+			if err := mpt.Put(keys[k], keys[k]); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		for _, key := range keys {
+			value, err := mpt.Get(key)
+			if err != nil || string(value) != string(key) {
+				t.Errorf("order %d: Get(%x) = %x, %v", i, key, value, err)
+			}
+		}
+		roots = append(roots, mpt.RootHash().String())
+		db.Close()
+		cleanupDB(dbPath)
+	}
+	for i := 1; i < len(roots); i++ {
+		if roots[i] != roots[0] {
+			t.Errorf("order %d built root %s, order 0 built %s", i, roots[i], roots[0])
+		}
+	}
+}
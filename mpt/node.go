@@ -19,6 +19,8 @@ const (
 	LeafNodeType      NodeType = iota
 	ExtensionNodeType          = 1
 	BranchNodeType             = 2
+
+	hashNodeType NodeType = -1 //只在内存中出现，不会被序列化
 )
 
 type nodeFlag struct {
@@ -56,6 +58,21 @@ type fullNodeJSON struct {
 	Value    string   `json:"value"`
 }
 
+// hashNode 从数据库读出的分支节点里的子节点，只有哈希，访问时再从DB加载
+type hashNode common.Hash
+
+func (n hashNode) GetType() NodeType {
+	return hashNodeType
+}
+
+func (n hashNode) GetHash() common.Hash {
+	return common.Hash(n)
+}
+
+func (n hashNode) Serialize() ([]byte, error) {
+	return nil, fmt.Errorf("hash node %x must be resolved before serializing", common.Hash(n))
+}
+
 func (n *FullNode) GetType() NodeType {
 	return BranchNodeType
 }
@@ -147,8 +164,10 @@ func (n *FullNode) MarshalJSON() ([]byte, error) {
 	for i, child := range n.Children {
 		if child != nil {
 			// 先保存子节点
-			if _, err := child.Serialize(); err != nil {
-				return nil, err
+			if _, ok := child.(hashNode); !ok {
+				if _, err := child.Serialize(); err != nil {
+					return nil, err
+				}
 			}
 			childrenHashes[i] = hex.EncodeToString(child.GetHash().Bytes())
 		} else {
@@ -177,7 +196,7 @@ func (n *FullNode) UnmarshalJSON(data []byte) error {
 			var hash common.Hash
 			copy(hash[:], bytes)
 			// 这里只能存hash，实际访问时需通过DB加载
-			n.Children[i] = &ExtensionNode{NodeType: ExtensionNodeType, Path: nil, Value: hash}
+			n.Children[i] = hashNode(hash)
 		} else {
 			n.Children[i] = nil
 		}
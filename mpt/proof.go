@@ -0,0 +1,107 @@
+package mpt
+
+import (
+	"blockchain/common"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrMissingProofNode 证明里缺少路径上的某个节点，或节点哈希对不上
+var ErrMissingProofNode = errors.New("missing or invalid proof node")
+
+// Prove returns the serialized nodes on the path from the root to key, root first.
+// For an absent key the path ends where the lookup fails, proving the absence
+func (m *MPT) Prove(key []byte) ([][]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var proof [][]byte
+	node := m.Root
+	nibbles := keyToNibbles(key)
+	for node != nil {
+		if hash, ok := node.(hashNode); ok {
+			loaded, err := m.LoadNode(common.Hash(hash))
+			if err != nil {
+				return nil, err
+			}
+			node = loaded
+		}
+		data, err := node.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, data)
+
+		switch n := node.(type) {
+		case *LeafNode:
+			return proof, nil
+		case *ExtensionNode:
+			if len(nibbles) < len(n.Path) || !bytes.Equal(n.Path, nibbles[:len(n.Path)]) {
+				return proof, nil
+			}
+			nibbles = nibbles[len(n.Path):]
+			node = hashNode(n.Value)
+		case *FullNode:
+			if len(nibbles) == 0 {
+				return proof, nil
+			}
+			node = n.Children[nibbles[0]]
+			nibbles = nibbles[1:]
+		default:
+			return nil, fmt.Errorf("unknown node type")
+		}
+	}
+	return proof, nil
+}
+
+// VerifyProof checks a proof produced by Prove against the root hash and returns the value
+// stored under key, or nil when the proof shows that the key is absent
+func VerifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	if root == (common.Hash{}) {
+		return nil, nil
+	}
+	nodes := make(map[common.Hash][]byte, len(proof))
+	for _, data := range proof {
+		nodes[sha3_256(data)] = data
+	}
+
+	expected := root
+	nibbles := keyToNibbles(key)
+	for {
+		data, ok := nodes[expected]
+		if !ok {
+			return nil, ErrMissingProofNode
+		}
+		node, err := deserializeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		//和 get 的查找规则保持一致
+		switch n := node.(type) {
+		case *LeafNode:
+			if len(n.Key) == 0 || bytes.Equal(n.Key, nibbles) {
+				return n.Value, nil
+			}
+			return nil, nil
+		case *ExtensionNode:
+			if len(nibbles) < len(n.Path) || !bytes.Equal(n.Path, nibbles[:len(n.Path)]) {
+				return nil, nil
+			}
+			nibbles = nibbles[len(n.Path):]
+			expected = n.Value
+		case *FullNode:
+			if len(nibbles) == 0 {
+				return n.Value.Bytes(), nil
+			}
+			child := n.Children[nibbles[0]]
+			if child == nil {
+				return nil, nil
+			}
+			nibbles = nibbles[1:]
+			expected = child.GetHash()
+		default:
+			return nil, fmt.Errorf("unknown node type")
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package snapshot
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// DefaultLayers 内存里保留的差异层数，更早的区块合并进磁盘层
+const DefaultLayers = 128
+
+// 快照和状态树节点存在同一个数据库里，用前缀区分
+var (
+	accountPrefix = []byte("snapshot-account-") //前缀 + 账户键 -> 账户编码
+	diskRootKey   = []byte("snapshot-root")     //磁盘层对应的状态根
+)
+
+var (
+	// ErrAccountNotFound 快照里没有这个账户，和状态树查不到时一样当作不存在
+	ErrAccountNotFound = errors.New("account not found in snapshot")
+
+	errMissingParent = errors.New("parent snapshot layer missing")
+	errUnknownLayer  = errors.New("unknown snapshot layer")
+)
+
+// layer 某个状态根下全部账户的平铺视图
+type layer interface {
+	Root() common.Hash
+	get(key string) ([]byte, error)
+}
+
+// diskLayer 落盘的平铺账户，对应一个较早区块的状态
+type diskLayer struct {
+	db   *mpt.DB
+	root common.Hash
+}
+
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+func (dl *diskLayer) get(key string) ([]byte, error) {
+	value, err := dl.db.Get(accountKey(key))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	return value, err
+}
+
+// diffLayer 一个区块写入的账户，叠在父区块的层上面
+type diffLayer struct {
+	parent   layer
+	root     common.Hash
+	accounts map[string][]byte
+}
+
+func (dl *diffLayer) Root() common.Hash {
+	return dl.root
+}
+
+func (dl *diffLayer) get(key string) ([]byte, error) {
+	if value, ok := dl.accounts[key]; ok {
+		return value, nil
+	}
+	return dl.parent.get(key)
+}
+
+func accountKey(key string) []byte {
+	return append(append([]byte{}, accountPrefix...), key...)
+}
+
+// Tree 按状态根组织的快照层：一个磁盘层加上最近区块的差异层，分叉的区块各自叠在父区块的层上，
+// 所以重组后按新链头的状态根仍能读到正确的账户
+type Tree struct {
+	db     *mpt.DB
+	disk   *diskLayer
+	layers map[common.Hash]layer
+
+	lock sync.RWMutex
+}
+
+// New opens the snapshot stored in db, regenerating it from the trie when it does not match the trie's root
+func New(db *mpt.DB, trie *mpt.MPT) (*Tree, error) {
+	tree := &Tree{db: db}
+	if data, err := db.Get(diskRootKey); err == nil && len(data) == common.HashLength {
+		if root := common.Hash(data); root == trie.RootHash() {
+			tree.disk = &diskLayer{db: db, root: root}
+			tree.layers = map[common.Hash]layer{root: tree.disk}
+			return tree, nil
+		}
+	}
+	if err := tree.Rebuild(trie); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Rebuild drops every layer and writes the accounts of the trie as the new disk layer
+func (t *Tree) Rebuild(trie *mpt.MPT) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	limit := append([]byte{}, accountPrefix...)
+	limit[len(limit)-1]++
+	old, err := t.db.GetRange(accountPrefix, limit)
+	if err != nil {
+		return err
+	}
+	stale := make([]string, 0, len(old))
+	for key := range old {
+		stale = append(stale, key)
+	}
+	if err := t.db.BatchDelete(stale); err != nil {
+		return err
+	}
+
+	root := trie.RootHash()
+	kvs := make(map[string][]byte)
+	err = trie.ForEach(func(key, value []byte) error {
+		kvs[string(accountKey(string(key)))] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	//根最后和账户一起写，中途失败时下次打开会重新生成
+	kvs[string(diskRootKey)] = root.Bytes()
+	if err := t.db.BatchPut(kvs); err != nil {
+		return err
+	}
+	t.disk = &diskLayer{db: t.db, root: root}
+	t.layers = map[common.Hash]layer{root: t.disk}
+	return nil
+}
+
+// Update adds the accounts written by a block as a layer for root on top of the layer for parent.
+// accounts must not be modified afterwards
+func (t *Tree) Update(root, parent common.Hash, accounts map[string][]byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	base, ok := t.layers[parent]
+	if !ok {
+		return errMissingParent
+	}
+	t.layers[root] = &diffLayer{parent: base, root: root, accounts: accounts}
+	return nil
+}
+
+// Cap keeps at most layers diff layers below root and merges the older ones into the disk layer.
+// Layers of forks that do not descend from the new disk layer are dropped
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	top, ok := t.layers[root]
+	if !ok {
+		return errUnknownLayer
+	}
+	var diffs []*diffLayer //从新到旧
+	for current := top; ; {
+		diff, ok := current.(*diffLayer)
+		if !ok {
+			break
+		}
+		diffs = append(diffs, diff)
+		current = diff.parent
+	}
+	if len(diffs) <= layers {
+		return nil
+	}
+
+	//从最旧的差异层开始写，新的值覆盖旧的；和新的根在同一批里写入
+	flatten := diffs[layers:]
+	kvs := make(map[string][]byte)
+	for i := len(flatten) - 1; i >= 0; i-- {
+		for key, value := range flatten[i].accounts {
+			kvs[string(accountKey(key))] = value
+		}
+	}
+	bottom := flatten[0]
+	kvs[string(diskRootKey)] = bottom.root.Bytes()
+	if err := t.db.BatchPut(kvs); err != nil {
+		return err
+	}
+	disk := &diskLayer{db: t.db, root: bottom.root}
+
+	//叠在被合并的层上的差异层改为叠在新的磁盘层上，其余分支读到的已经不是自己的状态，丢掉
+	for _, l := range t.layers {
+		if diff, ok := l.(*diffLayer); ok && diff.parent == bottom {
+			diff.parent = disk
+		}
+	}
+	remaining := map[common.Hash]layer{disk.root: disk}
+	for hash, l := range t.layers {
+		if descends(l, disk) {
+			remaining[hash] = l
+		}
+	}
+	t.disk = disk
+	t.layers = remaining
+	return nil
+}
+
+// descends 沿父层往下能否走到 base
+func descends(l layer, base layer) bool {
+	for {
+		diff, ok := l.(*diffLayer)
+		if !ok {
+			return l == base
+		}
+		l = diff.parent
+	}
+}
+
+// Get reads key from the snapshot layer of the trie's current root, falling back to the trie when no
+// layer covers that root. Like the trie an absent key yields an error. t may be nil
+func (t *Tree) Get(trie *mpt.MPT, key []byte) ([]byte, error) {
+	if t != nil {
+		t.lock.RLock()
+		l, ok := t.layers[trie.RootHash()]
+		if ok {
+			value, err := l.get(string(key))
+			t.lock.RUnlock()
+			if err == nil || errors.Is(err, ErrAccountNotFound) {
+				return value, err
+			}
+			fmt.Println("读取状态快照失败，改读状态树:", err)
+			return trie.Get(key)
+		}
+		t.lock.RUnlock()
+	}
+	return trie.Get(key)
+}
+
+// DiskRoot returns the state root of the disk layer
+func (t *Tree) DiskRoot() common.Hash {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.disk.root
+}
+
+// Covers reports whether a snapshot layer exists for the state root
+func (t *Tree) Covers(root common.Hash) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	_, ok := t.layers[root]
+	return ok
+}
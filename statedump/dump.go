@@ -0,0 +1,180 @@
+package statedump
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Format 导出文件的格式
+type Format int
+
+const (
+	FormatJSON   Format = iota //每行一个JSON对象，第一行是状态根
+	FormatBinary               //魔数之后是RLP记录首尾相接
+)
+
+// binaryMagic 二进制文件的开头，导入时据此区分两种格式
+var binaryMagic = []byte("STATEDUMP1")
+
+// ErrRootMismatch 重建出来的状态树根和导出时的根不一致
+var ErrRootMismatch = errors.New("state root mismatch")
+
+// dumpHeader 文件开头记录导出的是哪个状态根
+type dumpHeader struct {
+	Root string `json:"root"` //十六进制
+}
+
+// Account 导出文件里的一个账户
+type Account struct {
+	Address common.Address `json:"address"`
+	common.Account
+}
+
+// binaryAccount 二进制格式直接保存状态树里的账户编码，重建时逐字节还原
+type binaryAccount struct {
+	Address common.Address
+	Data    []byte
+}
+
+// Dump writes every account of the state trie to w and returns the number of accounts written
+func Dump(w io.Writer, trie *mpt.MPT, format Format) (uint64, error) {
+	buffered := bufio.NewWriter(w)
+	root := trie.RootHash()
+	var count uint64
+	var write func(addr common.Address, data []byte) error
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(buffered)
+		if err := encoder.Encode(dumpHeader{Root: hex.EncodeToString(root.Bytes())}); err != nil {
+			return 0, err
+		}
+		write = func(addr common.Address, data []byte) error {
+			var account Account
+			if err := json.Unmarshal(data, &account.Account); err != nil {
+				return fmt.Errorf("account %v: %v", addr, err)
+			}
+			account.Address = addr
+			return encoder.Encode(account)
+		}
+	case FormatBinary:
+		buffered.Write(binaryMagic)
+		if err := rlp.Encode(buffered, root); err != nil {
+			return 0, err
+		}
+		write = func(addr common.Address, data []byte) error {
+			return rlp.Encode(buffered, binaryAccount{Address: addr, Data: data})
+		}
+	default:
+		return 0, fmt.Errorf("unknown dump format %d", format)
+	}
+
+	err := trie.ForEach(func(key, value []byte) error {
+		if len(key) != common.AddressLength {
+			return fmt.Errorf("unexpected state key %x", key)
+		}
+		count++
+		return write(common.Address{}.NewAddress(key), value)
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, buffered.Flush()
+}
+
+// Restore rebuilds the state trie from a dump into db, detecting the format from the file content,
+// and fails with ErrRootMismatch unless the rebuilt root equals the one recorded in the dump
+func Restore(r io.Reader, db *mpt.DB) (*mpt.MPT, uint64, error) {
+	reader := bufio.NewReader(r)
+	magic, _ := reader.Peek(len(binaryMagic))
+	var (
+		root  common.Hash
+		next  func() (common.Address, []byte, error) //没有更多账户时返回 io.EOF
+		count uint64
+	)
+	if bytes.Equal(magic, binaryMagic) {
+		reader.Discard(len(binaryMagic))
+		stream := rlp.NewStream(reader, 0)
+		if err := stream.Decode(&root); err != nil {
+			return nil, 0, fmt.Errorf("read dump header: %v", err)
+		}
+		next = func() (common.Address, []byte, error) {
+			var account binaryAccount
+			if err := stream.Decode(&account); err != nil {
+				return common.Address{}, nil, err
+			}
+			return account.Address, account.Data, nil
+		}
+	} else {
+		decoder := json.NewDecoder(reader)
+		var header dumpHeader
+		if err := decoder.Decode(&header); err != nil {
+			return nil, 0, fmt.Errorf("read dump header: %v", err)
+		}
+		data, err := hex.DecodeString(header.Root)
+		if err != nil || len(data) != common.HashLength {
+			return nil, 0, fmt.Errorf("invalid dump root %q", header.Root)
+		}
+		copy(root[:], data)
+		next = func() (common.Address, []byte, error) {
+			var account Account
+			if err := decoder.Decode(&account); err != nil {
+				return common.Address{}, nil, err
+			}
+			//和虚拟机写入账户时的编码一致
+			data, err := json.Marshal(&account.Account)
+			return account.Address, data, err
+		}
+	}
+
+	trie := mpt.NewMPT(db)
+	for {
+		addr, data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, count, fmt.Errorf("account %d: %v", count, err)
+		}
+		if err := trie.Put(addr.Bytes(), data); err != nil {
+			return nil, count, err
+		}
+		count++
+	}
+	if got := trie.RootHash(); got != root {
+		return nil, count, fmt.Errorf("%w: rebuilt %v, dump %v", ErrRootMismatch, got, root)
+	}
+	return trie, count, nil
+}
+
+// DumpFile writes the accounts of the trie into a new file
+func DumpFile(path string, trie *mpt.MPT, format Format) (uint64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := Dump(file, trie, format)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
+
+// RestoreFile rebuilds the state trie from a dump file into db, see Restore
+func RestoreFile(path string, db *mpt.DB) (*mpt.MPT, uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	return Restore(file, db)
+}
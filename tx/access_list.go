@@ -0,0 +1,81 @@
+package tx
+
+import (
+	"blockchain/common"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AccessList EIP-2930 访问列表，交易预先声明要访问的账户和存储键
+type AccessList []AccessTuple
+
+// AccessTuple 一个账户和它要访问的存储键
+type AccessTuple struct {
+	Address     common.Address
+	StorageKeys []common.Hash
+}
+
+// accessTupleJSON 地址和存储键在JSON里都是0x开头的十六进制
+type accessTupleJSON struct {
+	Address     jsonAddress     `json:"address"`
+	StorageKeys []hexutil.Bytes `json:"storageKeys"`
+}
+
+func (t AccessTuple) MarshalJSON() ([]byte, error) {
+	enc := accessTupleJSON{Address: jsonAddress(t.Address), StorageKeys: make([]hexutil.Bytes, len(t.StorageKeys))}
+	for i, key := range t.StorageKeys {
+		enc.StorageKeys[i] = key.Bytes()
+	}
+	return json.Marshal(&enc)
+}
+
+func (t *AccessTuple) UnmarshalJSON(input []byte) error {
+	var dec accessTupleJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	t.Address = common.Address(dec.Address)
+	t.StorageKeys = make([]common.Hash, len(dec.StorageKeys))
+	for i, key := range dec.StorageKeys {
+		if len(key) != common.HashLength {
+			return fmt.Errorf("invalid storage key length %d", len(key))
+		}
+		copy(t.StorageKeys[i][:], key)
+	}
+	return nil
+}
+
+// StorageKeys returns the total number of storage keys in the access list
+func (al AccessList) StorageKeys() int {
+	sum := 0
+	for _, tuple := range al {
+		sum += len(tuple.StorageKeys)
+	}
+	return sum
+}
+
+// GetAccessList returns the access list declared by the transaction, nil for types without one
+func (tx *Transaction) GetAccessList() AccessList {
+	switch inner := tx.Inner.(type) {
+	case *AccessListTx:
+		return inner.AccessList
+	case *DynamicFeeTx:
+		return inner.AccessList
+	case *BatchTx:
+		return inner.AccessList
+	}
+	return nil
+}
+
+func (al AccessList) copy() AccessList {
+	if al == nil {
+		return nil
+	}
+	cpy := make(AccessList, len(al))
+	for i, tuple := range al {
+		cpy[i] = AccessTuple{Address: tuple.Address, StorageKeys: append([]common.Hash{}, tuple.StorageKeys...)}
+	}
+	return cpy
+}
@@ -0,0 +1,101 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// AccessListTxType EIP-2930 带访问列表的交易
+const AccessListTxType = 0x01
+
+func init() {
+	registerTxType(AccessListTxType, func() TypedTxData { return new(AccessListTx) })
+}
+
+// AccessListTx 访问列表交易在公共字段之外的部分，单价仍是 GasPrice
+type AccessListTx struct {
+	AccessList AccessList
+}
+
+// NewAccessListTransaction creates an EIP-2930 transaction declaring the accounts and storage keys it accesses
+func NewAccessListTransaction(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, accessList AccessList, chainID *big.Int) *Transaction {
+	transaction := NewTransaction(nonce, to, value, gasLimit, gasPrice, data, chainID)
+	transaction.Inner = &AccessListTx{AccessList: accessList}
+	return transaction
+}
+
+func (a *AccessListTx) TxType() byte {
+	return AccessListTxType
+}
+
+func (a *AccessListTx) copy() TypedTxData {
+	return &AccessListTx{AccessList: a.AccessList.copy()}
+}
+
+// fields 和以太坊一致：[chainId, nonce, gasPrice, gas, to, value, data, accessList]
+func (a *AccessListTx) fields(tx *Transaction) []interface{} {
+	accessList := a.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		tx.To,
+		bigOrNew(tx.Value),
+		tx.Data,
+		accessList,
+	}
+}
+
+func (a *AccessListTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasPrice   *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		AccessList AccessList
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasPrice,
+		GasLimit: dec.Gas,
+		To:       dec.To,
+		Value:    dec.Value,
+		Data:     dec.Data,
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	a.AccessList = dec.AccessList
+	return nil
+}
+
+func (a *AccessListTx) setJSON(enc *txJSON) {
+	accessList := a.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	enc.AccessList = &accessList
+}
+
+func (a *AccessListTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if tx.GasPrice == nil {
+		return errors.New("missing required field 'gasPrice' in transaction")
+	}
+	if dec.AccessList != nil {
+		a.AccessList = *dec.AccessList
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BatchTxType 一个签名、一个nonce下的多笔调用，要么全部成功要么全部回滚
+const BatchTxType = 0x11
+
+func init() {
+	registerTxType(BatchTxType, func() TypedTxData { return new(BatchTx) })
+}
+
+// TxBatchCallGas 批量交易中每笔调用的固有gas，data 另按字节计费
+const TxBatchCallGas uint64 = 9000
+
+// ErrEmptyBatch 批量交易里没有调用
+var ErrEmptyBatch = errors.New("batch transaction without calls")
+
+// BatchCall 批量交易中的一笔调用
+type BatchCall struct {
+	To    common.Address
+	Value *big.Int
+	Data  []byte
+}
+
+// BatchTx 批量交易在公共字段之外的部分。交易自身的 To、Value、Data 不用，转账金额由各笔调用自己付；
+// 各笔调用的目标账户执行时按冷热计费，可以在 AccessList 里预先声明
+type BatchTx struct {
+	Calls      []BatchCall
+	AccessList AccessList
+}
+
+// NewBatchTransaction creates a transaction executing calls in order, atomically, under one nonce
+func NewBatchTransaction(nonce uint64, calls []BatchCall, gasLimit uint64, gasPrice *big.Int, chainID *big.Int) *Transaction {
+	return &Transaction{
+		TxData: TxData{
+			Nonce:    nonce,
+			GasPrice: gasPrice,
+			GasLimit: gasLimit,
+			Value:    new(big.Int),
+			ChainID:  chainID,
+		},
+		SignatureData: SignatureData{V: new(big.Int), R: new(big.Int), S: new(big.Int)},
+		Inner:         &BatchTx{Calls: calls},
+	}
+}
+
+// GetBatchCalls returns the calls of a batch transaction, nil for other transactions
+func (tx *Transaction) GetBatchCalls() []BatchCall {
+	if batch, ok := tx.Inner.(*BatchTx); ok {
+		return batch.Calls
+	}
+	return nil
+}
+
+func (b *BatchTx) TxType() byte {
+	return BatchTxType
+}
+
+func (b *BatchTx) copy() TypedTxData {
+	cpy := &BatchTx{Calls: make([]BatchCall, len(b.Calls)), AccessList: b.AccessList.copy()}
+	for i, call := range b.Calls {
+		cpy.Calls[i] = BatchCall{To: call.To, Value: copyBig(call.Value), Data: append([]byte(nil), call.Data...)}
+	}
+	return cpy
+}
+
+// fields [chainId, nonce, gasPrice, gas, [[to, value, data]...], accessList]
+func (b *BatchTx) fields(tx *Transaction) []interface{} {
+	calls := make([]BatchCall, len(b.Calls))
+	for i, call := range b.Calls {
+		calls[i] = BatchCall{To: call.To, Value: bigOrNew(call.Value), Data: call.Data}
+	}
+	accessList := b.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		calls,
+		accessList,
+	}
+}
+
+func (b *BatchTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasPrice   *big.Int
+		Gas        uint64
+		Calls      []BatchCall
+		AccessList AccessList
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasPrice,
+		GasLimit: dec.Gas,
+		Value:    new(big.Int),
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	b.Calls, b.AccessList = dec.Calls, dec.AccessList
+	return nil
+}
+
+// batchCallJSON 调用在JSON里的形式，和交易本身的字段写法一致
+type batchCallJSON struct {
+	To    jsonAddress   `json:"to"`
+	Value *hexutil.Big  `json:"value"`
+	Input hexutil.Bytes `json:"input"`
+}
+
+func (b *BatchTx) setJSON(enc *txJSON) {
+	enc.Calls = make([]batchCallJSON, len(b.Calls))
+	for i, call := range b.Calls {
+		enc.Calls[i] = batchCallJSON{To: jsonAddress(call.To), Value: (*hexutil.Big)(bigOrNew(call.Value)), Input: call.Data}
+	}
+	accessList := b.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	enc.AccessList = &accessList
+}
+
+func (b *BatchTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if tx.GasPrice == nil {
+		return errors.New("missing required field 'gasPrice' in transaction")
+	}
+	if dec.Calls == nil {
+		return errors.New("missing required field 'calls' in transaction")
+	}
+	tx.To, tx.Data, tx.Value = nil, nil, new(big.Int)
+	b.Calls = make([]BatchCall, len(dec.Calls))
+	for i, call := range dec.Calls {
+		b.Calls[i] = BatchCall{To: common.Address(call.To), Value: bigOrZero(call.Value), Data: call.Input}
+	}
+	if dec.AccessList != nil {
+		b.AccessList = *dec.AccessList
+	}
+	return nil
+}
+
+// CallResult 批量交易中一笔调用的结果
+type CallResult struct {
+	Status uint64 //ReceiptStatusSuccessful 或 ReceiptStatusFailed
+	Error  string //失败原因，没执行到的调用也记为失败
+}
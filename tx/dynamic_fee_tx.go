@@ -0,0 +1,120 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DynamicFeeTxType EIP-1559 动态手续费交易
+const DynamicFeeTxType = 0x02
+
+func init() {
+	registerTxType(DynamicFeeTxType, func() TypedTxData { return new(DynamicFeeTx) })
+}
+
+// DynamicFeeTx 动态手续费交易在公共字段之外的部分。交易的 GasPrice 字段就是 maxFeePerGas，
+// 实际单价是 min(maxFeePerGas, baseFee + GasTipCap)，其中 baseFee 销毁、其余付给 coinbase
+type DynamicFeeTx struct {
+	GasTipCap  *big.Int //maxPriorityFeePerGas
+	AccessList AccessList
+}
+
+// NewDynamicFeeTransaction creates an EIP-1559 transaction paying at most gasFeeCap per gas, of which at most gasTipCap goes to the coinbase
+func NewDynamicFeeTransaction(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasTipCap, gasFeeCap *big.Int, data []byte, chainID *big.Int) *Transaction {
+	transaction := NewTransaction(nonce, to, value, gasLimit, gasFeeCap, data, chainID)
+	transaction.Inner = &DynamicFeeTx{GasTipCap: gasTipCap}
+	return transaction
+}
+
+func (d *DynamicFeeTx) TxType() byte {
+	return DynamicFeeTxType
+}
+
+func (d *DynamicFeeTx) copy() TypedTxData {
+	return &DynamicFeeTx{GasTipCap: copyBig(d.GasTipCap), AccessList: d.AccessList.copy()}
+}
+
+// fields 和以太坊一致：[chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList]
+func (d *DynamicFeeTx) fields(tx *Transaction) []interface{} {
+	accessList := d.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(d.GasTipCap),
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		tx.To,
+		bigOrNew(tx.Value),
+		tx.Data,
+		accessList,
+	}
+}
+
+func (d *DynamicFeeTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasTipCap  *big.Int
+		GasFeeCap  *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		AccessList AccessList
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasFeeCap,
+		GasLimit: dec.Gas,
+		To:       dec.To,
+		Value:    dec.Value,
+		Data:     dec.Data,
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	d.GasTipCap, d.AccessList = dec.GasTipCap, dec.AccessList
+	return nil
+}
+
+func (d *DynamicFeeTx) setJSON(enc *txJSON) {
+	enc.MaxFeePerGas, enc.GasPrice = enc.GasPrice, nil
+	enc.MaxPriorityFeePerGas = (*hexutil.Big)(d.GasTipCap)
+	accessList := d.AccessList
+	if accessList == nil {
+		accessList = AccessList{}
+	}
+	enc.AccessList = &accessList
+}
+
+func (d *DynamicFeeTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if dec.MaxFeePerGas == nil {
+		return errors.New("missing required field 'maxFeePerGas' in transaction")
+	}
+	if dec.MaxPriorityFeePerGas == nil {
+		return errors.New("missing required field 'maxPriorityFeePerGas' in transaction")
+	}
+	tx.GasPrice = (*big.Int)(dec.MaxFeePerGas)
+	d.GasTipCap = (*big.Int)(dec.MaxPriorityFeePerGas)
+	if dec.AccessList != nil {
+		d.AccessList = *dec.AccessList
+	}
+	return nil
+}
+
+func bigOrNew(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return x
+}
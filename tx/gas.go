@@ -0,0 +1,114 @@
+package tx
+
+import (
+	"errors"
+	"math/big"
+)
+
+// 交易固有gas，沿用以太坊的取值
+const (
+	TxGas                 uint64 = 21000 // 普通转账
+	TxGasContractCreation uint64 = 53000 // 创建合约
+	TxDataZeroGas         uint64 = 4     // data中每个零字节
+	TxDataNonZeroGas      uint64 = 16    // data中每个非零字节
+
+	TxAccessListAddressGas    uint64 = 2400 // 访问列表中每个账户
+	TxAccessListStorageKeyGas uint64 = 1900 // 访问列表中每个存储键
+)
+
+// IsContractCreation 与 vm 的判断一致：没有接收方，或接收方为零地址且带data
+func (tx *Transaction) IsContractCreation() bool {
+	if _, ok := tx.Inner.(*BatchTx); ok {
+		return false
+	}
+	return tx.To == nil || (tx.To.IsZero() && len(tx.Data) != 0)
+}
+
+// dataGas data 按零字节和非零字节计费
+func dataGas(data []byte) uint64 {
+	var gas uint64
+	for _, b := range data {
+		if b == 0 {
+			gas += TxDataZeroGas
+		} else {
+			gas += TxDataNonZeroGas
+		}
+	}
+	return gas
+}
+
+// IntrinsicGas returns the gas charged before any execution, GasLimit must cover at least this much
+func (tx *Transaction) IntrinsicGas() uint64 {
+	gas := TxGas
+	if tx.IsContractCreation() {
+		gas = TxGasContractCreation
+	}
+	gas += dataGas(tx.Data)
+	//预先声明的账户和存储键先付一部分，执行时按热访问计费
+	if accessList := tx.GetAccessList(); accessList != nil {
+		gas += uint64(len(accessList)) * TxAccessListAddressGas
+		gas += uint64(accessList.StorageKeys()) * TxAccessListStorageKeyGas
+	}
+	if multisig, ok := tx.Inner.(*MultisigTx); ok {
+		gas += uint64(len(multisig.Signatures)) * TxMultisigSignatureGas
+	}
+	//批量交易每笔调用另付一份，比单独发交易省下基础的 TxGas
+	for _, call := range tx.GetBatchCalls() {
+		gas += TxBatchCallGas + dataGas(call.Data)
+	}
+	return gas
+}
+
+var (
+	// ErrTipAboveFeeCap maxPriorityFeePerGas 比 maxFeePerGas 还高
+	ErrTipAboveFeeCap = errors.New("max priority fee per gas higher than max fee per gas")
+	// ErrFeeCapTooLow 愿意付的最高单价低于区块的 baseFee
+	ErrFeeCapTooLow = errors.New("max fee per gas less than block base fee")
+	// ErrNoBaseFee 区块还没有 baseFee 时不接受动态手续费交易
+	ErrNoBaseFee = errors.New("dynamic fee transaction before the base fee is enabled")
+	// ErrNonceTooLow 交易的 nonce 已经被执行过，重放的交易不能再执行
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrNonceTooHigh 交易的 nonce 跳过了发送者的下一个 nonce
+	ErrNonceTooHigh = errors.New("nonce too high")
+)
+
+// GetGasFeeCap returns the highest price per gas the sender pays, the gas price of legacy transactions
+func (tx *Transaction) GetGasFeeCap() *big.Int {
+	return tx.GasPrice
+}
+
+// GetGasTipCap returns the highest price per gas paid to the coinbase, the gas price of legacy transactions
+func (tx *Transaction) GetGasTipCap() *big.Int {
+	if dynamic, ok := tx.Inner.(*DynamicFeeTx); ok {
+		return dynamic.GasTipCap
+	}
+	return tx.GasPrice
+}
+
+// GetEffectiveGasTip returns the price per gas paid to the coinbase under baseFee, min(tipCap, feeCap-baseFee).
+// A nil baseFee means no base fee. When the fee cap is below baseFee the negative difference is returned with ErrFeeCapTooLow
+func (tx *Transaction) GetEffectiveGasTip(baseFee *big.Int) (*big.Int, error) {
+	if baseFee == nil {
+		return new(big.Int).Set(tx.GetGasTipCap()), nil
+	}
+	tip := new(big.Int).Sub(tx.GetGasFeeCap(), baseFee)
+	if tip.Sign() < 0 {
+		return tip, ErrFeeCapTooLow
+	}
+	if tipCap := tx.GetGasTipCap(); tip.Cmp(tipCap) > 0 {
+		tip.Set(tipCap)
+	}
+	return tip, nil
+}
+
+// GetEffectiveGasPrice returns the price per gas actually charged under baseFee, min(feeCap, baseFee+tipCap)
+func (tx *Transaction) GetEffectiveGasPrice(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(tx.GetGasTipCap())
+	}
+	price := new(big.Int).Add(baseFee, tx.GetGasTipCap())
+	if feeCap := tx.GetGasFeeCap(); price.Cmp(feeCap) > 0 {
+		price.Set(feeCap)
+	}
+	return price
+}
@@ -0,0 +1,162 @@
+package tx
+
+import (
+	"blockchain/common"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// txJSON 交易的JSON形式，数值都是0x开头的十六进制；只属于某些类型的字段由 TypedTxData 填写
+type txJSON struct {
+	Type hexutil.Uint64 `json:"type"`
+
+	ChainID  *hexutil.Big    `json:"chainId,omitempty"`
+	Nonce    *hexutil.Uint64 `json:"nonce"`
+	To       *jsonAddress    `json:"to"`
+	Gas      *hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice,omitempty"`
+	Value    *hexutil.Big    `json:"value"`
+	Input    *hexutil.Bytes  `json:"input"`
+	V        *hexutil.Big    `json:"v"`
+	R        *hexutil.Big    `json:"r"`
+	S        *hexutil.Big    `json:"s"`
+
+	//只在编码时给出，解码时忽略（多签交易的 from 除外）
+	Hash *hexutil.Bytes `json:"hash,omitempty"`
+	From *jsonAddress   `json:"from,omitempty"`
+
+	//动态手续费交易
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas,omitempty"`
+	MaxFeePerGas         *hexutil.Big `json:"maxFeePerGas,omitempty"`
+	AccessList           *AccessList  `json:"accessList,omitempty"`
+
+	//多签交易，from 也由它填写
+	Signatures []hexutil.Bytes `json:"signatures,omitempty"`
+	//批量交易
+	Calls []batchCallJSON `json:"calls,omitempty"`
+	//代付交易
+	FeePayer *jsonAddress `json:"feePayer,omitempty"`
+	PayerV   *hexutil.Big `json:"feePayerV,omitempty"`
+	PayerR   *hexutil.Big `json:"feePayerR,omitempty"`
+	PayerS   *hexutil.Big `json:"feePayerS,omitempty"`
+	//有效期交易
+	ValidAfter *hexutil.Uint64 `json:"validAfter,omitempty"`
+	ValidUntil *hexutil.Uint64 `json:"validUntil,omitempty"`
+}
+
+// MarshalJSON encodes the transaction with its type and hex quantities
+func (tx *Transaction) MarshalJSON() ([]byte, error) {
+	var enc txJSON
+	enc.Type = hexutil.Uint64(tx.Type())
+	enc.ChainID = (*hexutil.Big)(tx.ChainID)
+	nonce, gas := hexutil.Uint64(tx.Nonce), hexutil.Uint64(tx.GasLimit)
+	enc.Nonce, enc.Gas = &nonce, &gas
+	enc.To = (*jsonAddress)(tx.To)
+	enc.GasPrice = (*hexutil.Big)(tx.GasPrice)
+	enc.Value = (*hexutil.Big)(tx.Value)
+	input := hexutil.Bytes(tx.Data)
+	enc.Input = &input
+	enc.V, enc.R, enc.S = (*hexutil.Big)(tx.V), (*hexutil.Big)(tx.R), (*hexutil.Big)(tx.S)
+	if tx.Inner != nil {
+		tx.Inner.setJSON(&enc)
+	}
+	//以太坊客户端用编码的 keccak256 作交易哈希，不是链内部索引用的 MiMC 哈希
+	if hash, err := tx.GetEthHash(); err == nil {
+		encoded := hexutil.Bytes(hash.Bytes())
+		enc.Hash = &encoded
+	}
+	if tx.signed() {
+		if from, err := tx.GetSender(); err == nil {
+			enc.From = (*jsonAddress)(&from)
+		}
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON decodes a transaction, dispatching on its "type" field. A missing type means legacy
+func (tx *Transaction) UnmarshalJSON(input []byte) error {
+	var dec txJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Nonce == nil {
+		return errors.New("missing required field 'nonce' in transaction")
+	}
+	if dec.Gas == nil {
+		return errors.New("missing required field 'gas' in transaction")
+	}
+	decoded := Transaction{
+		TxData: TxData{
+			Nonce:    uint64(*dec.Nonce),
+			GasLimit: uint64(*dec.Gas),
+			To:       (*common.Address)(dec.To),
+			ChainID:  (*big.Int)(dec.ChainID),
+		},
+		SignatureData: SignatureData{
+			V: bigOrZero(dec.V),
+			R: bigOrZero(dec.R),
+			S: bigOrZero(dec.S),
+		},
+	}
+	decoded.GasPrice = (*big.Int)(dec.GasPrice)
+	decoded.Value = bigOrZero(dec.Value)
+	if dec.Input != nil {
+		decoded.Data = *dec.Input
+	}
+	if dec.Type > 0xff {
+		return ErrTxTypeNotSupported
+	}
+	if txType := byte(dec.Type); txType == LegacyTxType {
+		if decoded.GasPrice == nil {
+			return errors.New("missing required field 'gasPrice' in transaction")
+		}
+		//和RLP解码一样，已签名的交易以 v 里的链ID为准
+		if decoded.signed() && decoded.Protected() {
+			decoded.ChainID = deriveChainID(decoded.V)
+		}
+	} else {
+		inner, err := newTypedTxData(txType)
+		if err != nil {
+			return err
+		}
+		if decoded.ChainID == nil {
+			return errors.New("missing required field 'chainId' in transaction")
+		}
+		if err := inner.fromJSON(&dec, &decoded); err != nil {
+			return err
+		}
+		decoded.Inner = inner
+	}
+	tx.setDecoded(&decoded)
+	return nil
+}
+
+// DecodeRawTransaction decodes the 0x-prefixed hex of a serialized transaction, as sent by eth_sendRawTransaction
+func DecodeRawTransaction(raw string) (*Transaction, error) {
+	data, err := hexutil.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	return Deserialize(data)
+}
+
+// jsonAddress 以太坊客户端要求地址带0x前缀，common.Address 的文本形式没有
+type jsonAddress common.Address
+
+func (a jsonAddress) MarshalText() ([]byte, error) {
+	return []byte(hexutil.Encode(a[:])), nil
+}
+
+func (a *jsonAddress) UnmarshalText(input []byte) error {
+	return (*common.Address)(a).UnmarshalText(input)
+}
+
+func bigOrZero(x *hexutil.Big) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return (*big.Int)(x)
+}
@@ -0,0 +1,233 @@
+package tx
+
+import (
+	"blockchain/common"
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// MultisigTxType 多签账户发出的交易，带着多个所有者对同一内容的签名
+const MultisigTxType = 0x10
+
+func init() {
+	registerTxType(MultisigTxType, func() TypedTxData { return new(MultisigTx) })
+}
+
+var (
+	// ErrNotMultisig 多签交易的发送者不是多签账户
+	ErrNotMultisig = errors.New("sender is not a multisig account")
+	// ErrMultisigRequired 多签账户只能发多签交易
+	ErrMultisigRequired = errors.New("multisig account requires a multisig transaction")
+	// ErrNotEnoughSignatures 不同所有者的签名数不到门限
+	ErrNotEnoughSignatures = errors.New("not enough owner signatures")
+	// ErrInvalidOwners 所有者列表或门限不合法
+	ErrInvalidOwners = errors.New("invalid multisig owner set")
+)
+
+// TxMultisigSignatureGas 多签交易每个签名的恢复费用
+const TxMultisigSignatureGas uint64 = 3000
+
+// MultisigTx 多签交易在公共字段之外的部分：发送交易的多签账户，以及所有者的签名。
+// 每个签名是 65 字节的 [R || S || 恢复码]，签的都是不含签名列表的同一个哈希；交易自身的 v, r, s 不用
+type MultisigTx struct {
+	From       common.Address
+	Signatures [][]byte
+}
+
+// NewMultisigTransaction creates a transaction sent by the multisig account from, owners add their signatures with Sign
+func NewMultisigTransaction(from common.Address, nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, chainID *big.Int) *Transaction {
+	transaction := NewTransaction(nonce, to, value, gasLimit, gasPrice, data, chainID)
+	transaction.Inner = &MultisigTx{From: from}
+	return transaction
+}
+
+func (m *MultisigTx) TxType() byte {
+	return MultisigTxType
+}
+
+func (m *MultisigTx) copy() TypedTxData {
+	cpy := &MultisigTx{From: m.From, Signatures: make([][]byte, len(m.Signatures))}
+	for i, sig := range m.Signatures {
+		cpy.Signatures[i] = append([]byte(nil), sig...)
+	}
+	return cpy
+}
+
+// sigHashFields 签名内容：[chainId, nonce, gasPrice, gas, to, value, data, from]
+func (m *MultisigTx) sigHashFields(tx *Transaction) []interface{} {
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		tx.To,
+		bigOrNew(tx.Value),
+		tx.Data,
+		m.From,
+	}
+}
+
+// fields 签名内容之后接签名列表
+func (m *MultisigTx) fields(tx *Transaction) []interface{} {
+	signatures := m.Signatures
+	if signatures == nil {
+		signatures = [][]byte{}
+	}
+	return append(m.sigHashFields(tx), signatures)
+}
+
+func (m *MultisigTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasPrice   *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		From       common.Address
+		Signatures [][]byte
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasPrice,
+		GasLimit: dec.Gas,
+		To:       dec.To,
+		Value:    dec.Value,
+		Data:     dec.Data,
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	m.From = dec.From
+	m.Signatures = dec.Signatures
+	return nil
+}
+
+func (m *MultisigTx) setJSON(enc *txJSON) {
+	from := jsonAddress(m.From)
+	enc.From = &from
+	enc.Signatures = make([]hexutil.Bytes, len(m.Signatures))
+	for i, sig := range m.Signatures {
+		enc.Signatures[i] = sig
+	}
+}
+
+func (m *MultisigTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if tx.GasPrice == nil {
+		return errors.New("missing required field 'gasPrice' in transaction")
+	}
+	if dec.From == nil {
+		return errors.New("missing required field 'from' in transaction")
+	}
+	m.From = common.Address(*dec.From)
+	m.Signatures = make([][]byte, len(dec.Signatures))
+	for i, sig := range dec.Signatures {
+		m.Signatures[i] = sig
+	}
+	return nil
+}
+
+// owners 恢复每个签名的签名者，签名格式不对时报错
+func (m *MultisigTx) owners(hash common.Hash) ([]common.Address, error) {
+	owners := make([]common.Address, len(m.Signatures))
+	for i, sig := range m.Signatures {
+		if len(sig) != crypto.SignatureLength {
+			return nil, ErrInvalidSig
+		}
+		owner, err := recoverPlain(hash, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64]), sig[64])
+		if err != nil {
+			return nil, err
+		}
+		owners[i] = owner
+	}
+	return owners, nil
+}
+
+// VerifyMultisig checks that the multisig transaction carries signatures of at least
+// account.Threshold distinct owners of the account
+func VerifyMultisig(signer Signer, transaction *Transaction, account *common.Account) error {
+	multisig, ok := transaction.Inner.(*MultisigTx)
+	if !ok {
+		if account.IsMultisig() {
+			return ErrMultisigRequired
+		}
+		return nil
+	}
+	if !account.IsMultisig() {
+		return ErrNotMultisig
+	}
+	signers, err := multisig.owners(signer.Hash(transaction))
+	if err != nil {
+		return err
+	}
+	//同一个所有者签多次只算一次，不是所有者的签名不算
+	counted := make(map[common.Address]bool)
+	for _, addr := range signers {
+		for _, owner := range account.Owners {
+			if addr == owner {
+				counted[addr] = true
+			}
+		}
+	}
+	if uint64(len(counted)) < account.Threshold {
+		return ErrNotEnoughSignatures
+	}
+	return nil
+}
+
+// OwnerUpdatePrefix 多签账户（或普通账户）发给自己、data 以它开头的交易修改账户的所有者和门限
+var OwnerUpdatePrefix = []byte("msig")
+
+// OwnerUpdate 新的所有者列表和门限，都为空时账户变回普通账户
+type OwnerUpdate struct {
+	Owners    []common.Address
+	Threshold uint64
+}
+
+// EncodeOwnerUpdate returns the data of a self-transaction replacing the owners and threshold of the sender
+func EncodeOwnerUpdate(owners []common.Address, threshold uint64) []byte {
+	data, _ := rlp.EncodeToBytes(&OwnerUpdate{Owners: owners, Threshold: threshold})
+	return append(append([]byte{}, OwnerUpdatePrefix...), data...)
+}
+
+// DecodeOwnerUpdate decodes the data of a self-transaction, ok is false when the data is not an owner update
+func DecodeOwnerUpdate(data []byte) (update *OwnerUpdate, ok bool, err error) {
+	if !bytes.HasPrefix(data, OwnerUpdatePrefix) {
+		return nil, false, nil
+	}
+	update = new(OwnerUpdate)
+	if err := rlp.DecodeBytes(data[len(OwnerUpdatePrefix):], update); err != nil {
+		return nil, true, err
+	}
+	if err := update.Validate(); err != nil {
+		return nil, true, err
+	}
+	return update, true, nil
+}
+
+// Validate checks 1 <= Threshold <= len(Owners) with no owner listed twice, or both empty
+func (u *OwnerUpdate) Validate() error {
+	if len(u.Owners) == 0 && u.Threshold == 0 {
+		return nil
+	}
+	if u.Threshold == 0 || u.Threshold > uint64(len(u.Owners)) {
+		return ErrInvalidOwners
+	}
+	seen := make(map[common.Address]bool)
+	for _, owner := range u.Owners {
+		if seen[owner] {
+			return ErrInvalidOwners
+		}
+		seen[owner] = true
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package tx
+
+import (
+	"blockchain/common"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// 交易执行结果
+const (
+	ReceiptStatusFailed     = uint64(0)
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// BloomByteLength 布隆过滤器的字节数，即2048位
+const BloomByteLength = 256
+
+// Bloom 日志的布隆过滤器，记录日志的地址和主题
+type Bloom [BloomByteLength]byte
+
+// BloomBits returns the three bit indexes in [0, 2048) that data sets in a bloom
+func BloomBits(data []byte) [3]uint {
+	//和以太坊一样：取keccak256的前三对字节，各自低11位决定置哪一位
+	hash := crypto.Keccak256(data)
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) & 2047
+	}
+	return bits
+}
+
+// Add 把一段数据（地址或主题）加入过滤器
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range BloomBits(data) {
+		b.SetBit(bit)
+	}
+}
+
+// SetBit 置第 bit 位，位序和以太坊一致，从最后一个字节的最低位数起
+func (b *Bloom) SetBit(bit uint) {
+	b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+}
+
+// HasBit 第 bit 位是否被置位
+func (b Bloom) HasBit(bit uint) bool {
+	return b[BloomByteLength-1-bit/8]&(1<<(bit%8)) != 0
+}
+
+// Test 判断数据是否可能在过滤器里，返回false时一定不在
+func (b Bloom) Test(data []byte) bool {
+	var probe Bloom
+	probe.Add(data)
+	for i := range probe {
+		if b[i]&probe[i] != probe[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Log 合约执行时产生的日志
+type Log struct {
+	Address common.Address //产生日志的合约
+	Topics  []common.Hash
+	Data    []byte
+
+	//以下字段由所在的交易和区块决定
+	BlockNumber uint64
+	TxHash      common.Hash
+	TxIndex     uint
+	BlockHash   common.Hash
+	Index       uint //在区块所有日志中的序号
+}
+
+// Receipt 交易执行完后的收据
+type Receipt struct {
+	Status            uint64
+	CumulativeGasUsed uint64 //区块内到这笔交易为止消耗的gas
+	Logs              []*Log
+	Bloom             Bloom
+
+	TxHash          common.Hash
+	ContractAddress common.Address //创建合约的交易才有
+	GasUsed         uint64
+
+	//以下字段在区块封装后才确定
+	BlockHash   common.Hash
+	BlockNumber uint64
+	TxIndex     uint
+
+	Type uint8 `rlp:"optional"` //交易类型，放在最后，旧版本存下的收据仍能解码
+
+	CallResults []CallResult `rlp:"optional"` //批量交易每笔调用的结果
+}
+
+// CreateBloom 把所有日志的地址和主题放进一个过滤器
+func CreateBloom(receipts []*Receipt) Bloom {
+	var bloom Bloom
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			bloom.Add(log.Address.Bytes())
+			for _, topic := range log.Topics {
+				bloom.Add(topic.Bytes())
+			}
+		}
+	}
+	return bloom
+}
+
+// consensusHash 只对共识相关的字段求哈希，区块哈希等派生字段不影响收据根
+func (r *Receipt) consensusHash() common.Hash {
+	type consensusLog struct {
+		Address common.Address
+		Topics  []common.Hash
+		Data    []byte
+	}
+	logs := make([]consensusLog, len(r.Logs))
+	for i, log := range r.Logs {
+		logs[i] = consensusLog{log.Address, log.Topics, log.Data}
+	}
+	fields := []interface{}{r.Status, r.CumulativeGasUsed, r.Bloom, logs}
+	//批量交易的每笔调用是否成功也由执行决定，失败原因只是说明不参与共识
+	if len(r.CallResults) > 0 {
+		statuses := make([]uint64, len(r.CallResults))
+		for i, result := range r.CallResults {
+			statuses[i] = result.Status
+		}
+		fields = append(fields, statuses)
+	}
+	data, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return common.Hash{}
+	}
+	//和交易一样，类型化交易的收据前面加类型字节
+	if r.Type != LegacyTxType {
+		data = append([]byte{r.Type}, data...)
+	}
+	//keccak先压缩，避免长数据在MiMC里只按模数取值
+	return common.Hash{}.NewHash(crypto.Keccak256(data))
+}
+
+// ReceiptsRoot 收据的默克尔根，写进区块头；没有交易时为零值
+func ReceiptsRoot(receipts []*Receipt) common.Hash {
+	if len(receipts) == 0 {
+		return common.Hash{}
+	}
+	level := make([]common.Hash, len(receipts))
+	for i, receipt := range receipts {
+		level[i] = receipt.consensusHash()
+	}
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			right := level[i] //奇数个时最后一个和自己配对
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, common.Hash{}.NewHash(crypto.Keccak256(level[i].Bytes(), right.Bytes())))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// DeriveFields 区块封装后补上收据和日志里的区块信息
+func DeriveFields(receipts []*Receipt, blockHash common.Hash, blockNumber uint64) {
+	var logIndex uint
+	for i, receipt := range receipts {
+		receipt.BlockHash = blockHash
+		receipt.BlockNumber = blockNumber
+		receipt.TxIndex = uint(i)
+		for _, log := range receipt.Logs {
+			log.BlockHash = blockHash
+			log.BlockNumber = blockNumber
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(i)
+			log.Index = logIndex
+			logIndex++
+		}
+	}
+}
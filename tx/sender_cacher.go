@@ -0,0 +1,41 @@
+package tx
+
+import (
+	"blockchain/common"
+	"runtime"
+	"sync"
+)
+
+// sigCache 交易上缓存的发送者，只对同一种签名方案有效，重新签名或解码时清掉
+type sigCache struct {
+	signer Signer
+	from   common.Address
+}
+
+// CacheSenders recovers the senders of txs on a pool of workers and caches them on the transactions,
+// so that later Sender calls with the same signer return at once. Transactions whose signature
+// is invalid are left alone, the error shows up when they are validated
+func CacheSenders(signer Signer, txs []*Transaction) {
+	workers := runtime.NumCPU()
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	if workers <= 1 {
+		for _, transaction := range txs {
+			Sender(signer, transaction)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	//每个worker隔 workers 个取一笔，不需要再分配任务
+	for i := 0; i < workers; i++ {
+		go func(start int) {
+			defer wg.Done()
+			for j := start; j < len(txs); j += workers {
+				Sender(signer, txs[j])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
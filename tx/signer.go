@@ -0,0 +1,333 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DefaultChainID 没有另外配置时交易池和虚拟机接受的链ID
+var DefaultChainID = big.NewInt(1)
+
+var (
+	// ErrInvalidChainID 交易签名里的链ID和本链不同，可能是别的链上交易的重放
+	ErrInvalidChainID = errors.New("invalid chain id for signer")
+	// ErrInvalidSig 签名值不合法
+	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
+)
+
+// Signer 交易签名方案：签名哈希怎么算，V 怎么编码，怎么恢复发送者
+type Signer interface {
+	// Sender returns the address that signed the transaction
+	Sender(tx *Transaction) (common.Address, error)
+	// SignatureValues converts a 65 byte [R || S || recovery id] signature of tx into the wire values
+	SignatureValues(tx *Transaction, sig []byte) (r, s, v *big.Int, err error)
+	// Hash returns the hash that is signed
+	Hash(tx *Transaction) common.Hash
+	// ChainID returns the chain the signer accepts, nil for Homestead
+	ChainID() *big.Int
+	// Equal reports whether the other signer recovers senders the same way
+	Equal(Signer) bool
+}
+
+// LatestSignerForChainID returns a signer accepting every transaction type of the chain,
+// or a Homestead signer when chainID is nil or zero
+func LatestSignerForChainID(chainID *big.Int) Signer {
+	if chainID == nil || chainID.Sign() == 0 {
+		return HomesteadSigner{}
+	}
+	return NewTypedSigner(chainID)
+}
+
+// Sender recovers the sender of tx with the given signer, the result is cached on tx
+// and reused as long as the same kind of signer asks again. SignTx and decoding into tx drop the cache,
+// a signed transaction is treated as immutable: callers changing its fields directly must sign it again
+func Sender(signer Signer, tx *Transaction) (common.Address, error) {
+	if cached := tx.from.Load(); cached != nil && cached.signer.Equal(signer) {
+		return cached.from, nil
+	}
+	addr, err := signer.Sender(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	tx.from.Store(&sigCache{signer: signer, from: addr})
+	return addr, nil
+}
+
+// SignTx signs tx in place with the given signer and private key
+func SignTx(tx *Transaction, signer Signer, privateKey []byte) error {
+	key, err := crypto.ToECDSA(privateKey)
+	if err != nil {
+		return err
+	}
+	hash := signer.Hash(tx)
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		return err
+	}
+	r, s, v, err := signer.SignatureValues(tx, sig)
+	if err != nil {
+		return err
+	}
+	//多签交易每个所有者签一次，签名依次加到列表里
+	if multisig, ok := tx.Inner.(*MultisigTx); ok {
+		multisig.Signatures = append(multisig.Signatures, sig)
+		tx.from.Store(nil)
+		return nil
+	}
+	tx.SignatureData = SignatureData{V: v, R: r, S: s}
+	//换了签名，之前缓存的发送者作废
+	tx.from.Store(nil)
+	return nil
+}
+
+// HomesteadSigner 不带链ID的签名，V 为 27 或 28
+type HomesteadSigner struct{}
+
+func (HomesteadSigner) ChainID() *big.Int {
+	return nil
+}
+
+func (HomesteadSigner) Equal(s2 Signer) bool {
+	_, ok := s2.(HomesteadSigner)
+	return ok
+}
+
+func (HomesteadSigner) Hash(tx *Transaction) common.Hash {
+	return rlpHash([]interface{}{
+		tx.Nonce,
+		tx.GasPrice,
+		tx.GasLimit,
+		tx.To,
+		tx.Value,
+		tx.Data,
+	})
+}
+
+func (HomesteadSigner) SignatureValues(tx *Transaction, sig []byte) (r, s, v *big.Int, err error) {
+	if tx.Inner != nil {
+		return nil, nil, nil, ErrTxTypeNotSupported
+	}
+	r, s, v, err = decodeSignature(sig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	v.SetUint64(uint64(sig[64]) + 27)
+	return r, s, v, nil
+}
+
+// decodeSignature 拆出 r、s，v 先放恢复码
+func decodeSignature(sig []byte) (r, s, v *big.Int, err error) {
+	if len(sig) != crypto.SignatureLength {
+		return nil, nil, nil, ErrInvalidSig
+	}
+	r = new(big.Int).SetBytes(sig[:32])
+	s = new(big.Int).SetBytes(sig[32:64])
+	v = new(big.Int).SetUint64(uint64(sig[64]))
+	return r, s, v, nil
+}
+
+func (hs HomesteadSigner) Sender(tx *Transaction) (common.Address, error) {
+	if tx.Inner != nil {
+		return common.Address{}, ErrTxTypeNotSupported
+	}
+	if tx.V == nil || tx.V.BitLen() > 8 {
+		return common.Address{}, ErrInvalidSig
+	}
+	v := tx.V.Uint64()
+	if v != 27 && v != 28 {
+		return common.Address{}, ErrInvalidSig
+	}
+	return recoverPlain(hs.Hash(tx), tx.R, tx.S, byte(v-27))
+}
+
+// EIP155Signer 把链ID写进签名哈希和 V（V = 恢复码 + 35 + 2*链ID），别的链上的签名在这里无效
+type EIP155Signer struct {
+	chainID, chainIDMul *big.Int
+}
+
+// NewEIP155Signer creates a signer for transactions of the given chain
+func NewEIP155Signer(chainID *big.Int) EIP155Signer {
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	return EIP155Signer{
+		chainID:    new(big.Int).Set(chainID),
+		chainIDMul: new(big.Int).Mul(chainID, big.NewInt(2)),
+	}
+}
+
+func (s EIP155Signer) ChainID() *big.Int {
+	return s.chainID
+}
+
+func (s EIP155Signer) Equal(s2 Signer) bool {
+	eip155, ok := s2.(EIP155Signer)
+	return ok && eip155.chainID.Cmp(s.chainID) == 0
+}
+
+// Hash 签名内容是交易字段后面接 [链ID, 0, 0]
+func (s EIP155Signer) Hash(tx *Transaction) common.Hash {
+	return rlpHash([]interface{}{
+		tx.Nonce,
+		tx.GasPrice,
+		tx.GasLimit,
+		tx.To,
+		tx.Value,
+		tx.Data,
+		s.chainID, uint(0), uint(0),
+	})
+}
+
+func (s EIP155Signer) SignatureValues(tx *Transaction, sig []byte) (r, sv, v *big.Int, err error) {
+	if tx.Inner != nil {
+		return nil, nil, nil, ErrTxTypeNotSupported
+	}
+	r, sv, v, err = decodeSignature(sig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	v.SetUint64(uint64(sig[64]) + 35)
+	v.Add(v, s.chainIDMul)
+	return r, sv, v, nil
+}
+
+// Sender 不带链ID的旧签名交给 HomesteadSigner，带链ID的必须是本链
+func (s EIP155Signer) Sender(tx *Transaction) (common.Address, error) {
+	if tx.Inner != nil {
+		return common.Address{}, ErrTxTypeNotSupported
+	}
+	if !tx.Protected() {
+		return HomesteadSigner{}.Sender(tx)
+	}
+	if chainID := deriveChainID(tx.V); chainID.Cmp(s.chainID) != 0 {
+		return common.Address{}, ErrInvalidChainID
+	}
+	if tx.ChainID != nil && tx.ChainID.Sign() > 0 && tx.ChainID.Cmp(s.chainID) != 0 {
+		return common.Address{}, ErrInvalidChainID
+	}
+	v := new(big.Int).Sub(tx.V, s.chainIDMul)
+	v.Sub(v, big.NewInt(35))
+	if v.BitLen() > 1 {
+		return common.Address{}, ErrInvalidSig
+	}
+	return recoverPlain(s.Hash(tx), tx.R, tx.S, byte(v.Uint64()))
+}
+
+// TypedSigner 在 EIP155Signer 之上接受类型化交易：签名内容是 keccak256(类型字节 || RLP(字段))，
+// 链ID就在交易字段里，V 直接是恢复码 0 或 1
+type TypedSigner struct {
+	EIP155Signer
+}
+
+// NewTypedSigner creates a signer for legacy and typed transactions of the given chain
+func NewTypedSigner(chainID *big.Int) TypedSigner {
+	return TypedSigner{NewEIP155Signer(chainID)}
+}
+
+func (s TypedSigner) Equal(s2 Signer) bool {
+	typed, ok := s2.(TypedSigner)
+	return ok && typed.chainID.Cmp(s.chainID) == 0
+}
+
+func (s TypedSigner) Hash(tx *Transaction) common.Hash {
+	if tx.Inner == nil {
+		return s.EIP155Signer.Hash(tx)
+	}
+	if hasher, ok := tx.Inner.(sigHasher); ok {
+		return prefixedRlpHash(tx.Type(), hasher.sigHashFields(tx))
+	}
+	return prefixedRlpHash(tx.Type(), tx.Inner.fields(tx))
+}
+
+// sigHasher 编码里带着其它签名的交易类型（多签、代付），发送者签的是不含这些签名的字段
+type sigHasher interface {
+	sigHashFields(tx *Transaction) []interface{}
+}
+
+func (s TypedSigner) SignatureValues(tx *Transaction, sig []byte) (r, sv, v *big.Int, err error) {
+	if tx.Inner == nil {
+		return s.EIP155Signer.SignatureValues(tx, sig)
+	}
+	if tx.ChainID == nil || tx.ChainID.Cmp(s.chainID) != 0 {
+		return nil, nil, nil, ErrInvalidChainID
+	}
+	return decodeSignature(sig)
+}
+
+func (s TypedSigner) Sender(tx *Transaction) (common.Address, error) {
+	if tx.Inner == nil {
+		return s.EIP155Signer.Sender(tx)
+	}
+	if tx.ChainID == nil || tx.ChainID.Cmp(s.chainID) != 0 {
+		return common.Address{}, ErrInvalidChainID
+	}
+	//多签交易的发送者是多签账户，这里只检查签名都能恢复，是否够门限要看账户状态
+	if multisig, ok := tx.Inner.(*MultisigTx); ok {
+		if len(multisig.Signatures) == 0 {
+			return common.Address{}, ErrInvalidSig
+		}
+		if _, err := multisig.owners(s.Hash(tx)); err != nil {
+			return common.Address{}, err
+		}
+		return multisig.From, nil
+	}
+	if tx.V == nil || tx.V.BitLen() > 1 {
+		return common.Address{}, ErrInvalidSig
+	}
+	return recoverPlain(s.Hash(tx), tx.R, tx.S, byte(tx.V.Uint64()))
+}
+
+// Protected reports whether the signature carries a chain ID (EIP-155), typed transactions always do
+func (tx *Transaction) Protected() bool {
+	if tx.Inner != nil {
+		return true
+	}
+	if tx.V == nil || tx.V.BitLen() > 8 {
+		return tx.V != nil
+	}
+	v := tx.V.Uint64()
+	return v != 27 && v != 28 && v != 0
+}
+
+// deriveChainID 从带链ID的 V 里取出链ID
+func deriveChainID(v *big.Int) *big.Int {
+	chainID := new(big.Int).Sub(v, big.NewInt(35))
+	return chainID.Rsh(chainID, 1)
+}
+
+func recoverPlain(hash common.Hash, r, s *big.Int, recoveryID byte) (common.Address, error) {
+	if r == nil || s == nil || !crypto.ValidateSignatureValues(recoveryID, r, s, true) {
+		return common.Address{}, ErrInvalidSig
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = recoveryID
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.Address{}.PublicKeyToAddress(crypto.FromECDSAPub(pub)), nil
+}
+
+// prefixedRlpHash 类型化交易的签名哈希，类型字节在RLP编码前面
+func prefixedRlpHash(prefix byte, x interface{}) common.Hash {
+	data, err := rlp.EncodeToBytes(x)
+	if err != nil {
+		return common.Hash{}
+	}
+	return common.Hash(crypto.Keccak256Hash([]byte{prefix}, data))
+}
+
+// rlpHash 签名哈希和以太坊一致，用 keccak256
+func rlpHash(x interface{}) common.Hash {
+	data, err := rlp.EncodeToBytes(x)
+	if err != nil {
+		return common.Hash{}
+	}
+	return common.Hash(crypto.Keccak256Hash(data))
+}
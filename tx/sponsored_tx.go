@@ -0,0 +1,175 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// SponsoredTxType 由代付方付gas费的交易：发送者付转账金额、消耗nonce，代付方另签一次并付gas费
+const SponsoredTxType = 0x12
+
+func init() {
+	registerTxType(SponsoredTxType, func() TypedTxData { return new(SponsoredTx) })
+}
+
+var (
+	// ErrInvalidFeePayer 代付签名缺失或者不是交易指定的代付方签的
+	ErrInvalidFeePayer = errors.New("invalid fee payer signature")
+	// ErrInsufficientPayerFunds 代付方余额不够按最高单价付gas费
+	ErrInsufficientPayerFunds = errors.New("insufficient fee payer balance")
+	// ErrMultisigFeePayer 多签账户由所有者共同控制，单个代付签名不能动用它的余额
+	ErrMultisigFeePayer = errors.New("fee payer is a multisig account")
+)
+
+// SponsoredTx 代付交易在公共字段之外的部分。发送者的签名内容包括代付方地址，
+// 代付方签的是带着发送者签名的整笔交易，两边都不能被替换
+type SponsoredTx struct {
+	FeePayer               common.Address
+	PayerV, PayerR, PayerS *big.Int
+}
+
+// NewSponsoredTransaction creates a transaction whose gas is paid by feePayer, the sender signs it first with Sign,
+// then the fee payer with SignFeePayer
+func NewSponsoredTransaction(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, feePayer common.Address, chainID *big.Int) *Transaction {
+	transaction := NewTransaction(nonce, to, value, gasLimit, gasPrice, data, chainID)
+	transaction.Inner = &SponsoredTx{FeePayer: feePayer}
+	return transaction
+}
+
+func (s *SponsoredTx) TxType() byte {
+	return SponsoredTxType
+}
+
+func (s *SponsoredTx) copy() TypedTxData {
+	return &SponsoredTx{FeePayer: s.FeePayer, PayerV: copyBig(s.PayerV), PayerR: copyBig(s.PayerR), PayerS: copyBig(s.PayerS)}
+}
+
+// sigHashFields 发送者的签名内容：[chainId, nonce, gasPrice, gas, to, value, data, feePayer]
+func (s *SponsoredTx) sigHashFields(tx *Transaction) []interface{} {
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		tx.To,
+		bigOrNew(tx.Value),
+		tx.Data,
+		s.FeePayer,
+	}
+}
+
+// fields 发送者的签名内容之后接代付方的签名
+func (s *SponsoredTx) fields(tx *Transaction) []interface{} {
+	return append(s.sigHashFields(tx), bigOrNew(s.PayerV), bigOrNew(s.PayerR), bigOrNew(s.PayerS))
+}
+
+// payerHash 代付方的签名内容：发送者的签名内容加上发送者的签名
+func (s *SponsoredTx) payerHash(tx *Transaction) common.Hash {
+	return prefixedRlpHash(SponsoredTxType, append(s.sigHashFields(tx), bigOrNew(tx.V), bigOrNew(tx.R), bigOrNew(tx.S)))
+}
+
+func (s *SponsoredTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID                *big.Int
+		Nonce                  uint64
+		GasPrice               *big.Int
+		Gas                    uint64
+		To                     *common.Address `rlp:"nil"`
+		Value                  *big.Int
+		Data                   []byte
+		FeePayer               common.Address
+		PayerV, PayerR, PayerS *big.Int
+		V, R, S                *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasPrice,
+		GasLimit: dec.Gas,
+		To:       dec.To,
+		Value:    dec.Value,
+		Data:     dec.Data,
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	s.FeePayer = dec.FeePayer
+	s.PayerV, s.PayerR, s.PayerS = dec.PayerV, dec.PayerR, dec.PayerS
+	return nil
+}
+
+func (s *SponsoredTx) setJSON(enc *txJSON) {
+	feePayer := jsonAddress(s.FeePayer)
+	enc.FeePayer = &feePayer
+	enc.PayerV = (*hexutil.Big)(bigOrNew(s.PayerV))
+	enc.PayerR = (*hexutil.Big)(bigOrNew(s.PayerR))
+	enc.PayerS = (*hexutil.Big)(bigOrNew(s.PayerS))
+}
+
+func (s *SponsoredTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if tx.GasPrice == nil {
+		return errors.New("missing required field 'gasPrice' in transaction")
+	}
+	if dec.FeePayer == nil {
+		return errors.New("missing required field 'feePayer' in transaction")
+	}
+	s.FeePayer = common.Address(*dec.FeePayer)
+	s.PayerV, s.PayerR, s.PayerS = bigOrZero(dec.PayerV), bigOrZero(dec.PayerR), bigOrZero(dec.PayerS)
+	return nil
+}
+
+// SignFeePayer adds the fee payer signature to a sponsored transaction the sender has already signed
+func SignFeePayer(tx *Transaction, signer Signer, privateKey []byte) error {
+	sponsored, ok := tx.Inner.(*SponsoredTx)
+	if !ok {
+		return ErrTxTypeNotSupported
+	}
+	if chainID := signer.ChainID(); chainID == nil || tx.ChainID == nil || tx.ChainID.Cmp(chainID) != 0 {
+		return ErrInvalidChainID
+	}
+	key, err := crypto.ToECDSA(privateKey)
+	if err != nil {
+		return err
+	}
+	sig, err := crypto.Sign(sponsored.payerHash(tx).Bytes(), key)
+	if err != nil {
+		return err
+	}
+	r, s, v, err := decodeSignature(sig)
+	if err != nil {
+		return err
+	}
+	sponsored.PayerV, sponsored.PayerR, sponsored.PayerS = v, r, s
+	return nil
+}
+
+// SignFeePayer signs tx as its fee payer with the latest signer of its chain
+func (tx *Transaction) SignFeePayer(privateKey []byte) error {
+	return SignFeePayer(tx, LatestSignerForChainID(tx.ChainID), privateKey)
+}
+
+// FeePayer returns the account paying the gas of tx. For sponsored transactions the fee payer
+// signature is checked against the declared payer, for the others it is the sender
+func FeePayer(signer Signer, tx *Transaction) (common.Address, error) {
+	sponsored, ok := tx.Inner.(*SponsoredTx)
+	if !ok {
+		return Sender(signer, tx)
+	}
+	if chainID := signer.ChainID(); chainID == nil || tx.ChainID == nil || tx.ChainID.Cmp(chainID) != 0 {
+		return common.Address{}, ErrInvalidChainID
+	}
+	if sponsored.PayerV == nil || sponsored.PayerV.BitLen() > 1 {
+		return common.Address{}, ErrInvalidFeePayer
+	}
+	payer, err := recoverPlain(sponsored.payerHash(tx), sponsored.PayerR, sponsored.PayerS, byte(sponsored.PayerV.Uint64()))
+	if err != nil || payer != sponsored.FeePayer {
+		return common.Address{}, ErrInvalidFeePayer
+	}
+	return payer, nil
+}
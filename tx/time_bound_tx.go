@@ -0,0 +1,148 @@
+package tx
+
+import (
+	"blockchain/common"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// TimeBoundTxType 带有效期的交易：只能在 validAfter 到 validUntil 之间（含两端）的区块里执行
+const TimeBoundTxType = 0x13
+
+func init() {
+	registerTxType(TimeBoundTxType, func() TypedTxData { return new(TimeBoundTx) })
+}
+
+// LockTimeThreshold 小于它的界限是区块高度，不小于它的是unix时间戳（秒），和比特币的 nLockTime 一样
+const LockTimeThreshold uint64 = 500000000
+
+var (
+	// ErrTxNotYetValid 还没到 validAfter
+	ErrTxNotYetValid = errors.New("transaction not yet valid")
+	// ErrTxExpired 已经过了 validUntil
+	ErrTxExpired = errors.New("transaction expired")
+)
+
+// TimeBoundTx 有效期交易在公共字段之外的部分，界限为0表示那一端不限
+type TimeBoundTx struct {
+	ValidAfter uint64
+	ValidUntil uint64
+}
+
+// NewTimeBoundTransaction creates a transaction executable only in blocks between validAfter and validUntil,
+// each bound is a block height below LockTimeThreshold and a unix timestamp otherwise, 0 leaves it open
+func NewTimeBoundTransaction(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, validAfter, validUntil uint64, chainID *big.Int) *Transaction {
+	transaction := NewTransaction(nonce, to, value, gasLimit, gasPrice, data, chainID)
+	transaction.Inner = &TimeBoundTx{ValidAfter: validAfter, ValidUntil: validUntil}
+	return transaction
+}
+
+// GetValidAfter returns the lower bound of a time-bound transaction, 0 for other transactions
+func (tx *Transaction) GetValidAfter() uint64 {
+	if bound, ok := tx.Inner.(*TimeBoundTx); ok {
+		return bound.ValidAfter
+	}
+	return 0
+}
+
+// GetValidUntil returns the upper bound of a time-bound transaction, 0 for other transactions
+func (tx *Transaction) GetValidUntil() uint64 {
+	if bound, ok := tx.Inner.(*TimeBoundTx); ok {
+		return bound.ValidUntil
+	}
+	return 0
+}
+
+// CheckValidity returns ErrTxNotYetValid or ErrTxExpired when tx cannot be executed in the block
+// with the given height and timestamp, transactions without bounds are always valid
+func (tx *Transaction) CheckValidity(height, timestamp uint64) error {
+	if after := tx.GetValidAfter(); after != 0 && lockTimeOf(after, height, timestamp) < after {
+		return ErrTxNotYetValid
+	}
+	if until := tx.GetValidUntil(); until != 0 && lockTimeOf(until, height, timestamp) > until {
+		return ErrTxExpired
+	}
+	return nil
+}
+
+// lockTimeOf 按界限的种类取区块高度或时间戳来比较
+func lockTimeOf(bound, height, timestamp uint64) uint64 {
+	if bound < LockTimeThreshold {
+		return height
+	}
+	return timestamp
+}
+
+func (b *TimeBoundTx) TxType() byte {
+	return TimeBoundTxType
+}
+
+func (b *TimeBoundTx) copy() TypedTxData {
+	return &TimeBoundTx{ValidAfter: b.ValidAfter, ValidUntil: b.ValidUntil}
+}
+
+// fields [chainId, nonce, gasPrice, gas, to, value, data, validAfter, validUntil]
+func (b *TimeBoundTx) fields(tx *Transaction) []interface{} {
+	return []interface{}{
+		bigOrNew(tx.ChainID),
+		tx.Nonce,
+		bigOrNew(tx.GasPrice),
+		tx.GasLimit,
+		tx.To,
+		bigOrNew(tx.Value),
+		tx.Data,
+		b.ValidAfter,
+		b.ValidUntil,
+	}
+}
+
+func (b *TimeBoundTx) decode(payload []byte, tx *Transaction) error {
+	var dec struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasPrice   *big.Int
+		Gas        uint64
+		To         *common.Address `rlp:"nil"`
+		Value      *big.Int
+		Data       []byte
+		ValidAfter uint64
+		ValidUntil uint64
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(payload, &dec); err != nil {
+		return err
+	}
+	tx.TxData = TxData{
+		Nonce:    dec.Nonce,
+		GasPrice: dec.GasPrice,
+		GasLimit: dec.Gas,
+		To:       dec.To,
+		Value:    dec.Value,
+		Data:     dec.Data,
+		ChainID:  dec.ChainID,
+	}
+	tx.SignatureData = SignatureData{V: dec.V, R: dec.R, S: dec.S}
+	b.ValidAfter, b.ValidUntil = dec.ValidAfter, dec.ValidUntil
+	return nil
+}
+
+func (b *TimeBoundTx) setJSON(enc *txJSON) {
+	after, until := hexutil.Uint64(b.ValidAfter), hexutil.Uint64(b.ValidUntil)
+	enc.ValidAfter, enc.ValidUntil = &after, &until
+}
+
+func (b *TimeBoundTx) fromJSON(dec *txJSON, tx *Transaction) error {
+	if tx.GasPrice == nil {
+		return errors.New("missing required field 'gasPrice' in transaction")
+	}
+	if dec.ValidAfter != nil {
+		b.ValidAfter = uint64(*dec.ValidAfter)
+	}
+	if dec.ValidUntil != nil {
+		b.ValidUntil = uint64(*dec.ValidUntil)
+	}
+	return nil
+}
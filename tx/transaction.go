@@ -3,8 +3,8 @@ package tx
 import (
 	"blockchain/common"
 	"errors"
-	"fmt"
 	"math/big"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -15,7 +15,7 @@ type TxData struct {
 	Nonce    uint64          // 发送者账户已发送的交易数量
 	GasPrice *big.Int        // gas价格
 	GasLimit uint64          // 交易允许消耗的最大Gas数量
-	To       *common.Address // 接收方地址，nil表示合约创建
+	To       *common.Address `rlp:"nil"` // 接收方地址，nil表示合约创建
 	Value    *big.Int        // 转账的以太币数量（以Wei计）
 	Data     []byte          // 调用合约函数的编码数据，或部署合约时的字节码
 	ChainID  *big.Int        // 链的标识符
@@ -28,10 +28,13 @@ type SignatureData struct {
 	S *big.Int // 签名值S
 }
 
-// Transaction represents an Ethereum transaction
+// Transaction represents an Ethereum transaction, Inner carries the fields of typed (EIP-2718) transactions
 type Transaction struct {
 	TxData
 	SignatureData
+	Inner TypedTxData //legacy 交易为 nil
+
+	from atomic.Pointer[sigCache] //缓存的发送者，恢复一次签名后重复使用
 }
 
 // NewTransaction creates a new transaction
@@ -54,79 +57,46 @@ func NewTransaction(nonce uint64, to common.Address, value *big.Int, gasLimit ui
 	}
 }
 
-// Sign signs the transaction with the given private key
+// Sign signs the transaction with the given private key, binding the chain ID when one is set (EIP-155)
 func (tx *Transaction) Sign(privateKey []byte) error {
-	// Create a new transaction with only TxData for hashing
-	txToSign := &Transaction{
-		TxData: tx.TxData, // Use existing TxData
-		SignatureData: SignatureData{ // Empty signature for hashing
-			V: new(big.Int),
-			R: new(big.Int),
-			S: new(big.Int),
-		},
-	}
-	hash, err := txToSign.GetHash()
-	if err != nil {
-		fmt.Println("GetHash失败")
-		return err
-	}
-
-	// 3. 使用私钥签名
-	//如果长度为32，则直接使用
-	key, err := crypto.ToECDSA(privateKey)
-	if err != nil {
-		fmt.Println("ToECDSA失败")
-		return err
-	}
-
-	signature, err := crypto.Sign(hash.Bytes(), key)
-	if err != nil {
-		fmt.Println("Sign失败")
-		return err
-	}
-
-	// 4. 解析签名值
-	r := new(big.Int).SetBytes(signature[:32])
-	s := new(big.Int).SetBytes(signature[32:64])
-	v := new(big.Int).SetBytes([]byte{signature[64]})
-
-	// 只需要加上基础值27即可
-	v.Add(v, big.NewInt(27))
-
-	tx.SignatureData.R = r
-	tx.SignatureData.S = s
-	tx.SignatureData.V = v
-
-	return nil
+	return SignTx(tx, LatestSignerForChainID(tx.ChainID), privateKey)
 }
 
-// Serialize 序列化交易数据
+// Serialize 序列化交易。legacy 交易签名后是标准的 [nonce, gasPrice, gas, to, value, data, v, r, s]，
+// 链ID已经编码在 v 里；未签名时和 EIP-155 的签名内容一样，v 的位置放链ID，r、s 为0。
+// 类型化交易是类型字节后接该类型的RLP列表
 func (tx *Transaction) Serialize() ([]byte, error) {
-	// 准备交易数据
-	var data []interface{}
-	// 根据EIP-155，V值需要包含链ID
-	v := tx.SignatureData.V.Uint64()
-	if tx.TxData.ChainID != nil && tx.TxData.ChainID.Sign() > 0 {
-		// 如果V值大于等于35，说明已经包含了链ID
-		if v < 35 {
-			v = v + 35 + 2*tx.TxData.ChainID.Uint64()
-		}
+	if tx.Inner != nil {
+		return tx.encodeTyped()
 	}
-	data = []interface{}{
-		tx.TxData.Nonce,
-		tx.TxData.GasPrice,
-		tx.TxData.GasLimit,
-		tx.TxData.To,
-		tx.TxData.Value,
-		tx.TxData.Data,
-		tx.TxData.ChainID,
+	return rlp.EncodeToBytes(tx.legacyFields())
+}
+
+// legacyFields legacy 交易编码的字段
+func (tx *Transaction) legacyFields() []interface{} {
+	v, r, s := tx.V, tx.R, tx.S
+	if !tx.signed() && tx.ChainID != nil {
+		v, r, s = tx.ChainID, new(big.Int), new(big.Int)
+	}
+	return []interface{}{
+		tx.Nonce,
+		tx.GasPrice,
+		tx.GasLimit,
+		tx.To,
+		tx.Value,
+		tx.Data,
 		v,
-		tx.SignatureData.R,
-		tx.SignatureData.S,
+		r,
+		s,
 	}
+}
 
-	// 编码数据
-	return rlp.EncodeToBytes(data)
+// signed 是否已经带有签名
+func (tx *Transaction) signed() bool {
+	if multisig, ok := tx.Inner.(*MultisigTx); ok {
+		return len(multisig.Signatures) > 0
+	}
+	return tx.R != nil && tx.S != nil && (tx.R.Sign() != 0 || tx.S.Sign() != 0)
 }
 
 // GetHash 获取交易哈希
@@ -139,72 +109,51 @@ func (tx *Transaction) GetHash() (common.Hash, error) {
 	return hash, nil
 }
 
-// GetSender 从签名中恢复发送者地址
-func (tx *Transaction) GetSender() (common.Address, error) {
-	if tx.SignatureData.R == nil || tx.SignatureData.S == nil || tx.SignatureData.V == nil {
-		return common.Address{}, errors.New("transaction is not signed")
+// GetEthHash returns the hash Ethereum clients know the transaction by, keccak256 of its canonical encoding.
+// The chain itself indexes transactions and receipts by GetHash
+func (tx *Transaction) GetEthHash() (common.Hash, error) {
+	data, err := tx.Serialize()
+	if err != nil {
+		return common.Hash{}, err
 	}
+	return common.Hash(crypto.Keccak256Hash(data)), nil
+}
 
-	// 准备未签名的交易数据 (only TxData part)
-	txToHash := &Transaction{
-		TxData: tx.TxData,
-		SignatureData: SignatureData{ // Empty signature for hashing
-			V: new(big.Int),
-			R: new(big.Int),
-			S: new(big.Int),
-		},
+// GetSender 从签名中恢复发送者地址，链ID取自签名本身；要限定本链时用配置好的 Signer
+func (tx *Transaction) GetSender() (common.Address, error) {
+	if !tx.signed() || tx.V == nil {
+		return common.Address{}, errors.New("transaction is not signed")
 	}
-
-	// 计算未签名交易的哈希
-	hash, err := txToHash.GetHash()
-	if err != nil {
-		return common.Address{}, err
+	if tx.Inner != nil {
+		return Sender(NewTypedSigner(tx.ChainID), tx)
 	}
-
-	// 创建签名
-	sig := make([]byte, 65)
-	rBytes := tx.SignatureData.R.Bytes()
-	sBytes := tx.SignatureData.S.Bytes()
-
-	// 确保r和s是32字节
-	if len(rBytes) > 32 || len(sBytes) > 32 {
-		return common.Address{}, errors.New("invalid signature length")
+	if tx.Protected() {
+		return Sender(NewEIP155Signer(deriveChainID(tx.V)), tx)
 	}
+	return Sender(HomesteadSigner{}, tx)
+}
 
-	copy(sig[32-len(rBytes):32], rBytes)
-	copy(sig[64-len(sBytes):64], sBytes)
-
-	// 处理V值
-	v := tx.SignatureData.V.Uint64()
-	// 提取recovery id (0 或 1)
-	recoveryId := v - 27
-	if recoveryId > 1 {
-		return common.Address{}, errors.New("invalid signature recovery id")
+// Deserialize 反序列化交易：首字节是RLP列表的为 legacy 交易，否则首字节是交易类型
+func Deserialize(data []byte) (*Transaction, error) {
+	if len(data) == 0 {
+		return nil, errEmptyTx
 	}
-	sig[64] = byte(recoveryId)
-
-	// 恢复公钥
-	pubKey, err := crypto.SigToPub(hash.Bytes(), sig)
-	if err != nil {
-		return common.Address{}, err
+	if data[0] >= 0xc0 {
+		return decodeLegacy(data)
 	}
-	publicKeyBytes := crypto.FromECDSAPub(pubKey)
-	// 从公钥获取地址
-	addr := common.Address{}.PublicKeyToAddress(publicKeyBytes)
-	return addr, nil
+	return decodeTyped(data)
 }
 
-// Deserialize 从RLP编码的数据反序列化交易
-func Deserialize(data []byte) (*Transaction, error) {
+// decodeLegacy 解码 legacy 交易，链ID从 v 中还原
+func decodeLegacy(data []byte) (*Transaction, error) {
 	type txRLP struct {
 		Nonce    uint64
 		GasPrice *big.Int
 		GasLimit uint64
-		To       *common.Address
+		To       *common.Address `rlp:"nil"`
 		Value    *big.Int
 		Data     []byte
-		ChainID  *big.Int
-		V        uint64
+		V        *big.Int
 		R        *big.Int
 		S        *big.Int
 	}
@@ -222,24 +171,21 @@ func Deserialize(data []byte) (*Transaction, error) {
 			To:       dec.To,
 			Value:    dec.Value,
 			Data:     dec.Data,
-			ChainID:  dec.ChainID,
 		},
-		SignatureData: SignatureData{},
+		SignatureData: SignatureData{V: dec.V, R: dec.R, S: dec.S},
 	}
-	// 只有当签名存在时才赋值
-	if dec.R != nil && dec.S != nil && dec.V != 0 {
-		tx.SignatureData.R = dec.R
-		tx.SignatureData.S = dec.S
-		tx.SignatureData.V = new(big.Int).SetUint64(dec.V)
-	} else {
-		tx.SignatureData.R = new(big.Int) // Initialize if not present
-		tx.SignatureData.S = new(big.Int) // Initialize if not present
-		tx.SignatureData.V = new(big.Int) // Initialize if not present
+	if !tx.signed() {
+		//未签名时 v 的位置是链ID
+		if dec.V.Sign() > 0 {
+			tx.ChainID = dec.V
+		}
+		tx.SignatureData = SignatureData{V: new(big.Int), R: new(big.Int), S: new(big.Int)}
+	} else if tx.Protected() {
+		tx.ChainID = deriveChainID(dec.V)
 	}
 	return tx, nil
 }
 
-
 func (tx *Transaction) GetNonce() uint64 {
 	return tx.TxData.Nonce
 }
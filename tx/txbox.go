@@ -2,6 +2,7 @@ package tx
 
 import (
 	"blockchain/common"
+	"bytes"
 	"math/big"
 )
 
@@ -12,6 +13,9 @@ type TxBox struct {
 	firstnonce uint64   //为了方便queue=>pending
 	lastnonce  uint64   //为了盒子中连接等操作
 	gasprice   *big.Int //默认是第一个交易的gasprice
+	tipcap     *big.Int //第一个交易的 maxPriorityFeePerGas，legacy 交易即 gasprice
+	tip        *big.Int //按当前 baseFee 算出的第一个交易的实际小费，成为发送者的第一个盒子时填写
+	index      int      //在交易池出池堆里的位置
 }
 
 // NewTxBox creates a new transaction queue
@@ -22,12 +26,13 @@ func NewTxBox(address common.Address, txs []*Transaction) *TxBox {
 		firstnonce: txs[0].GetNonce(),
 		lastnonce:  txs[len(txs)-1].GetNonce(),
 		gasprice:   txs[0].GetGasPrice(),
+		tipcap:     txs[0].GetGasTipCap(),
 	}
 }
 
 // 交易的进入
 func (txbox *TxBox) Enqueue(tx *Transaction) error {
-	if tx.GetGasPrice().Cmp(txbox.gasprice) < 0 {
+	if !txbox.accepts(tx) {
 		panic("gasprice too low")
 	}
 	txbox.txs = append(txbox.txs, tx)
@@ -39,6 +44,12 @@ func (txbox *TxBox) Enqueue(tx *Transaction) error {
 	return nil
 }
 
+// accepts 交易的最高单价和最高小费都不低于盒子里的第一个交易，
+// 这样无论 baseFee 是多少，它的实际小费都不会比第一个交易低，可以跟在后面出池
+func (txbox *TxBox) accepts(tx *Transaction) bool {
+	return tx.GetGasFeeCap().Cmp(txbox.gasprice) >= 0 && tx.GetGasTipCap().Cmp(txbox.tipcap) >= 0
+}
+
 // 执行交易的时候进行操作
 func (txbox *TxBox) Dequeue() *Transaction {
 	if len(txbox.txs) == 0 {
@@ -74,20 +85,52 @@ func (txbox *TxBox) GetGasPrice() *big.Int {
 	return txbox.gasprice
 }
 
+// GetEffectiveTip returns the effective tip of the first transaction computed when the box became its sender's head in the pool,
+// the gas price when it was not computed yet
+func (txbox *TxBox) GetEffectiveTip() *big.Int {
+	if txbox.tip == nil {
+		return txbox.tipcap
+	}
+	return txbox.tip
+}
+
 func (txbox *TxBox) GetAddress() common.Address {
 	return txbox.address
 }
 
-type boxes []TxBox
+// boxes 每个发送者最前面的盒子组成的堆，堆顶是下一个出池的盒子
+type boxes []*TxBox
 
 func (b boxes) Len() int {
 	return len(b)
 }
 
+// Less 排在前面的先出池：实际小费高的优先，相同按地址排序，保证顺序确定
 func (b boxes) Less(i, j int) bool {
-	return b[i].GetGasPrice().Cmp(b[j].GetGasPrice()) < 0
+	if c := b[i].GetEffectiveTip().Cmp(b[j].GetEffectiveTip()); c != 0 {
+		return c > 0
+	}
+	return bytes.Compare(b[i].address[:], b[j].address[:]) < 0
 }
 
 func (b boxes) Swap(i, j int) {
 	b[i], b[j] = b[j], b[i]
+	b[i].index = i
+	b[j].index = j
+}
+
+// Push 和 Pop 供 container/heap 使用
+func (b *boxes) Push(x any) {
+	box := x.(*TxBox)
+	box.index = len(*b)
+	*b = append(*b, box)
+}
+
+func (b *boxes) Pop() any {
+	old := *b
+	box := old[len(old)-1]
+	old[len(old)-1] = nil
+	*b = old[:len(old)-1]
+	box.index = -1
+	return box
 }
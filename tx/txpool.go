@@ -3,9 +3,15 @@ package tx
 import (
 	"blockchain/common"
 	"blockchain/mpt"
+	"blockchain/snapshot"
+	"container/heap"
 	"errors"
 	"fmt"
+	"math/big"
 	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/event"
 )
 
 type vm_execute interface {
@@ -16,7 +22,27 @@ type TxPool struct {
 	StatDB      *mpt.MPT
 	pending     map[common.Address][]*TxBox
 	queue       map[common.Address]map[uint64]*Transaction
-	Sortedboxes boxes
+	Sortedboxes boxes                     //每个发送者最前面的盒子按实际小费组成的堆
+	heads       map[common.Address]*TxBox //发送者在 Sortedboxes 里的盒子
+	rejected    map[common.Hash]error     //打包时执行失败被丢弃的交易及原因
+	snaps       *snapshot.Tree            //查nonce时先读快照，可以为nil
+	signer      Signer                    //只接受本链签名的交易，nil 时按 DefaultChainID
+	baseFee     *big.Int                  //待出块区块的 baseFee，nil 表示没有
+	height      uint64                    //链头的高度，交易的有效期按下一个区块检查
+	timestamp   uint64                    //链头的时间戳，下一个区块的时间戳不会比它小
+
+	mu     sync.Mutex //rpc提交交易和出块协程取交易可能同时发生
+	txFeed event.Feed //通知有新交易进入交易池
+}
+
+// NewTxsEvent 有新交易进入交易池时发出
+type NewTxsEvent struct {
+	Txs []*Transaction
+}
+
+// SubscribeNewTxsEvent registers a subscription of NewTxsEvent, the channel should be buffered
+func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.txFeed.Subscribe(ch)
 }
 
 func NewTxPool(db *mpt.MPT) *TxPool {
@@ -24,28 +50,199 @@ func NewTxPool(db *mpt.MPT) *TxPool {
 		StatDB: db,
 	}
 }
+// SetSigner sets the signature scheme, and thereby the chain ID, accepted by the pool
+func (pool *TxPool) SetSigner(signer Signer) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.signer = signer
+}
+
+func (pool *TxPool) getSigner() Signer {
+	if pool.signer == nil {
+		return LatestSignerForChainID(DefaultChainID)
+	}
+	return pool.signer
+}
+
+// SetBaseFee sets the base fee of the block being packed, the pool orders transactions by their effective tip under it
+func (pool *TxPool) SetBaseFee(baseFee *big.Int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.baseFee = baseFee
+	//实际小费随 baseFee 变化，整个堆重新建一遍
+	pool.Sortedboxes = pool.Sortedboxes[:0]
+	pool.heads = nil
+	for address := range pool.pending {
+		pool.refreshHead(address)
+	}
+}
+
+// SetHead moves the pool to a new chain head, the validity bounds of transactions are checked against the block after it:
+// expired transactions are dropped and recorded as rejected, queued ones that became valid move to pending
+func (pool *TxPool) SetHead(height, timestamp uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.height, pool.timestamp = height, timestamp
+	//链头变化只影响有效期，交易的签名、nonce和余额检查在进池时做过了，这里只在queue和pending之间挪动交易
+	for address := range pool.pending {
+		pool.demotePending(address)
+		pool.refreshHead(address)
+	}
+	for address, list := range pool.queue {
+		for nonce, tx := range list {
+			if err := pool.checkValidity(tx); errors.Is(err, ErrTxExpired) {
+				delete(list, nonce)
+				pool.reject(tx, err)
+			}
+		}
+		pool.promoteQueue(address)
+	}
+}
+
+// demotePending 从第一个不能进下一个区块的交易开始截断发送者的pending，
+// 过期的交易丢弃，其余的放回queue等nonce接上或者生效
+func (pool *TxPool) demotePending(address common.Address) {
+	boxes := pool.pending[address]
+	for i, box := range boxes {
+		for j, tx := range box.txs {
+			if pool.checkValidity(tx) == nil {
+				continue
+			}
+			var demoted []*Transaction
+			demoted = append(demoted, box.txs[j:]...)
+			for _, rest := range boxes[i+1:] {
+				demoted = append(demoted, rest.txs...)
+			}
+			if j > 0 {
+				box.txs = box.txs[:j:j]
+				box.lastnonce = box.txs[j-1].GetNonce()
+				i++
+			}
+			if i == 0 {
+				delete(pool.pending, address)
+			} else {
+				pool.pending[address] = boxes[:i]
+			}
+			for _, tx := range demoted {
+				if err := pool.checkValidity(tx); errors.Is(err, ErrTxExpired) {
+					pool.reject(tx, err)
+					continue
+				}
+				pool.addQueueTx(tx)
+			}
+			return
+		}
+	}
+}
+
+// promoteQueue 把queue里nonce刚好接上且已经生效的交易移进pending，后面接得上的交易由 addPendingTx 一并带出
+func (pool *TxPool) promoteQueue(address common.Address) {
+	list := pool.queue[address]
+	if len(list) == 0 {
+		delete(pool.queue, address)
+		return
+	}
+	var nonce uint64
+	if boxes := pool.pending[address]; len(boxes) > 0 {
+		nonce = boxes[len(boxes)-1].lastnonce
+	} else {
+		account, err := pool.getaccount(address)
+		if err != nil {
+			return
+		}
+		nonce = account.Nonce
+	}
+	if tx, ok := list[nonce+1]; ok && pool.checkValidity(tx) == nil {
+		delete(list, nonce+1)
+		pool.addPendingTx(tx)
+	}
+}
+
+// SetSnapshots makes nonce lookups consult the snapshot layers before the state trie
+func (pool *TxPool) SetSnapshots(snaps *snapshot.Tree) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.snaps = snaps
+}
+
 // -------------------------------------------------------------------------------------
 // ---------------------------------对外主要方法------------------------------------------
 // -------------------------------------------------------------------------------------
 func (pool *TxPool) NewTX(tx *Transaction) error {
-	//如果pool里的切片是空的，则make出来
-	if pool.Sortedboxes == nil {
-		pool.Sortedboxes = make(boxes, 0)
+	pool.mu.Lock()
+	err := pool.add(tx)
+	pool.mu.Unlock()
+	if err != nil {
+		return err
 	}
+	//在锁外通知，订阅者处理事件时可能会回头调用交易池
+	pool.txFeed.Send(NewTxsEvent{Txs: []*Transaction{tx}})
+	return nil
+}
+
+// NewTXs adds a batch of transactions, the senders are recovered in parallel before taking the pool lock.
+// The returned errors line up with txs, accepted transactions are announced in a single event
+func (pool *TxPool) NewTXs(txs []*Transaction) []error {
+	pool.mu.Lock()
+	signer := pool.getSigner()
+	pool.mu.Unlock()
+	CacheSenders(signer, txs)
+
+	errs := make([]error, len(txs))
+	accepted := make([]*Transaction, 0, len(txs))
+	pool.mu.Lock()
+	for i, tx := range txs {
+		if errs[i] = pool.add(tx); errs[i] == nil {
+			accepted = append(accepted, tx)
+		}
+	}
+	pool.mu.Unlock()
+	if len(accepted) > 0 {
+		pool.txFeed.Send(NewTxsEvent{Txs: accepted})
+	}
+	return errs
+}
+
+func (pool *TxPool) add(tx *Transaction) error {
+	//如果pool里的map是空的，则make出来
 	if pool.pending == nil {
 		pool.pending = make(map[common.Address][]*TxBox)
 	}
 	if pool.queue == nil {
 		pool.queue = make(map[common.Address]map[uint64]*Transaction)
 	}
-	address, err := tx.GetSender()
+	//启用 EIP-1559 之前打包不了动态手续费交易
+	if tx.Type() == DynamicFeeTxType && pool.baseFee == nil {
+		return ErrNoBaseFee
+	}
+	//小费上限不能超过最高单价，和vm的检查一致
+	if tx.GetGasTipCap().Cmp(tx.GetGasFeeCap()) > 0 {
+		return ErrTipAboveFeeCap
+	}
+	address, err := Sender(pool.getSigner(), tx)
 	if err != nil {
 		return err
 	}
-	account_nonce, err := pool.getaccountnonce(address)
+	account, err := pool.getaccount(address)
 	if err != nil {
 		return err
 	}
+	//多签账户的签名要够门限，多签账户也不接受单签交易
+	if err := VerifyMultisig(pool.getSigner(), tx, account); err != nil {
+		return err
+	}
+	//代付交易要有代付方的签名，代付方余额要够按最高单价付gas费
+	if tx.Type() == SponsoredTxType {
+		if err := pool.checkFeePayer(tx); err != nil {
+			return err
+		}
+	}
+	//过了有效期的交易不收，还没生效的交易先放进queue，等链头到了再进pending
+	validity := pool.checkValidity(tx)
+	if errors.Is(validity, ErrTxExpired) {
+		return validity
+	}
+	account_nonce := account.Nonce
 	//第一个情况，如果当前的nonce比要添加的大，自动返回错误
 	if account_nonce >= tx.Nonce {
 		return errors.New("nonce error")
@@ -59,7 +256,7 @@ func (pool *TxPool) NewTX(tx *Transaction) error {
 		nonce = last.lastnonce
 	}
 	// tx.nonce>account.nonce+1, 说明要添加到queue中
-	if tx.Nonce > nonce+1 {
+	if tx.Nonce > nonce+1 || (tx.Nonce == nonce+1 && validity != nil) {
 		pool.addQueueTx(tx)
 		return nil
 	} else if tx.Nonce == nonce+1 { // 说明要添加到pending中
@@ -67,6 +264,10 @@ func (pool *TxPool) NewTX(tx *Transaction) error {
 		pool.addPendingTx(tx)
 		return nil
 	} else { // tx.nonce<=account.nonce说明要替换pending中的交易
+		//还没生效的交易不能替换pending中的交易
+		if validity != nil {
+			return validity
+		}
 		// 替换
 		pool.replacePendingTx(tx)
 		return nil
@@ -98,28 +299,103 @@ func (pool *TxPool) execute_one(vm vm_execute) error {
 	}
 	return nil
 }
+// Pop 取出下一笔要打包的交易：每个发送者只有最前面的盒子在堆里，保证同一发送者按nonce出池，
+// 盒子之间按 boxes.Less 排序，同一个池快照总是得到同样的顺序。
+// 付不起当前 baseFee 的交易不进堆，留在池中等 baseFee 降下来
 func (pool *TxPool) Pop() *Transaction {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
 	if len(pool.Sortedboxes) == 0 {
 		return nil
 	}
-	boxes := pool.pending[pool.Sortedboxes[0].GetAddress()]
-	if len(boxes) == 0 {
-		return nil
-	}
-	pool.Sortedboxes[0].Dequeue()
+	address := pool.Sortedboxes[0].GetAddress()
+	boxes := pool.pending[address]
 	tx := boxes[0].Dequeue()
 	if len(boxes[0].txs) == 0 {
-		pool.pending[pool.Sortedboxes[0].GetAddress()] = boxes[1:]
+		pool.pending[address] = boxes[1:]
 	}
+	pool.refreshHead(address)
 	return tx
 }
 
+// refreshHead 发送者的第一个盒子或者它的第一个交易变了之后，更新它在出池堆里的位置
+func (pool *TxPool) refreshHead(address common.Address) {
+	if pool.heads == nil {
+		pool.heads = make(map[common.Address]*TxBox)
+	}
+	if box, ok := pool.heads[address]; ok {
+		heap.Remove(&pool.Sortedboxes, box.index)
+		delete(pool.heads, address)
+	}
+	list := pool.pending[address]
+	if len(list) == 0 || len(list[0].txs) == 0 {
+		return
+	}
+	box := list[0]
+	tip, err := box.txs[0].GetEffectiveGasTip(pool.baseFee)
+	if err != nil {
+		return
+	}
+	box.tip = tip
+	heap.Push(&pool.Sortedboxes, box)
+	pool.heads[address] = box
+}
+
+// Restore 把打包时取出但没放进区块的交易放回池中，和该发送者仍在池中的交易按nonce重新排好；
+// nonce 接不上的交易会进入queue
+func (pool *TxPool) Restore(txs []*Transaction) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	bySender := make(map[common.Address][]*Transaction)
+	for _, tx := range txs {
+		address, err := Sender(pool.getSigner(), tx)
+		if err != nil {
+			continue
+		}
+		bySender[address] = append(bySender[address], tx)
+	}
+	for address, list := range bySender {
+		for _, box := range pool.pending[address] {
+			list = append(list, box.txs...)
+		}
+		delete(pool.pending, address)
+		sort.Slice(list, func(i, j int) bool { return list[i].Nonce < list[j].Nonce })
+		for _, tx := range list {
+			if err := pool.add(tx); err != nil {
+				fmt.Println("交易放回交易池失败:", err)
+			}
+		}
+		pool.refreshHead(address)
+	}
+}
+
+// Reject 记录打包时执行失败而被丢弃的交易
+func (pool *TxPool) Reject(tx *Transaction, reason error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.reject(tx, reason)
+}
+
+func (pool *TxPool) reject(tx *Transaction, reason error) {
+	if pool.rejected == nil {
+		pool.rejected = make(map[common.Hash]error)
+	}
+	pool.rejected[*tx.Hash()] = reason
+}
+
+// GetRejected returns why a transaction was dropped by the packer, nil if it was not
+func (pool *TxPool) GetRejected(hash common.Hash) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.rejected[hash]
+}
+
 //-------------------------------------------------------------------------------------
 //---------------------------------具体实现---------------------------------------------
 //-------------------------------------------------------------------------------------
 
 func (pool *TxPool) addQueueTx(tx *Transaction) error {
-	address, err := tx.GetSender()
+	address, err := Sender(pool.getSigner(), tx)
 	if err != nil {
 		return err
 	}
@@ -133,7 +409,7 @@ func (pool *TxPool) addQueueTx(tx *Transaction) error {
 }
 
 func (pool *TxPool) addPendingTx(tx *Transaction) error {
-	address, err := tx.GetSender()
+	address, err := Sender(pool.getSigner(), tx)
 	if err != nil {
 		return err
 	}
@@ -142,19 +418,16 @@ func (pool *TxPool) addPendingTx(tx *Transaction) error {
 		//加到pending中
 		box := NewTxBox(address, []*Transaction{tx})
 		pool.pending[address] = append(pool.pending[address], box)
-		pool.Sortedboxes = append(pool.Sortedboxes, *box)
-		sort.Sort(pool.Sortedboxes)
+		pool.refreshHead(address)
 	} else {
 		last := boxes[len(boxes)-1]
-		if tx.GasPrice.Cmp(last.GetGasPrice()) >= 0 { //这里是，如果tx.gas>=last.gas，说明要加到最后一个box里面
+		if last.accepts(tx) { //这里是，如果tx.gas>=last.gas，说明要加到最后一个box里面
 			//加到pending中
 			last.Enqueue(tx)
 		} else {
 			//反之则说明，要新建一个txbox在pending中
 			box := NewTxBox(address, []*Transaction{tx})
 			pool.pending[address] = append(pool.pending[address], box)
-			pool.Sortedboxes = append(pool.Sortedboxes, *box)
-			sort.Sort(pool.Sortedboxes)
 		}
 	}
 
@@ -163,7 +436,7 @@ func (pool *TxPool) addPendingTx(tx *Transaction) error {
 	if list != nil {
 		nonce := tx.Nonce + 1 //这里就是理论上现在的pending里面的最后一个nonce了
 		for {
-			if tx, ok := list[nonce]; ok {
+			if tx, ok := list[nonce]; ok && pool.checkValidity(tx) == nil {
 				delete(list, nonce)
 				pool.queue[address] = list
 				pool.addPendingTx(tx)
@@ -177,7 +450,7 @@ func (pool *TxPool) addPendingTx(tx *Transaction) error {
 }
 
 func (pool *TxPool) replacePendingTx(tx *Transaction) error {
-	address, err := tx.GetSender()
+	address, err := Sender(pool.getSigner(), tx)
 	if err != nil {
 		return err
 	}
@@ -206,25 +479,14 @@ func (pool *TxPool) replacePendingTx(tx *Transaction) error {
 	}
 	newboxes = append(newboxes, oldtxboxes[flag:]...)
 	pool.pending[address] = newboxes
-	//删除一下Sortedboxes里面地址等于address的txbox
-	for i, txbox := range pool.Sortedboxes {
-		if txbox.GetAddress() == address {
-			// 删除第i个元素
-			pool.Sortedboxes = append(pool.Sortedboxes[:i], pool.Sortedboxes[i+1:]...)
-			
-		}
-	}
-	//添加一下newboxes到Sortedboxes中
-	for _, box := range newboxes {
-		pool.Sortedboxes = append(pool.Sortedboxes, *box)
-	}
-	sort.Sort(pool.Sortedboxes)
+	//替换后盒子重新分过，出池堆里的盒子要跟着换
+	pool.refreshHead(address)
 	return nil
 }
 
 func (pool *TxPool) cutPending(boxes []*TxBox, tx *Transaction) []*TxBox {
 	//这里是模仿的queue=>pending的逻辑，但是这里不进行递归调用，外层for循环来便利
-	address, err := tx.GetSender()
+	address, err := Sender(pool.getSigner(), tx)
 	if err != nil {
 		return nil
 	}
@@ -237,7 +499,7 @@ func (pool *TxPool) cutPending(boxes []*TxBox, tx *Transaction) []*TxBox {
 		return boxes
 	} else {
 		last := boxes[len(boxes)-1]
-		if tx.GasPrice.Cmp(last.GetGasPrice()) >= 0 { //这里是，如果tx.gas>=last.gas，说明要加到最后一个box里面
+		if last.accepts(tx) { //这里是，如果tx.gas>=last.gas，说明要加到最后一个box里面
 			//加到pending中
 			last.Enqueue(tx)
 		} else {
@@ -253,16 +515,38 @@ func (pool *TxPool) cutPending(boxes []*TxBox, tx *Transaction) []*TxBox {
 //----------------------------------基础方法---------------------------------------------
 //--------------------------------------------------------------------------------------
 
-func (txPool *TxPool) getaccountnonce(addr common.Address) (uint64, error) {
+// checkValidity 按链头之后的区块检查交易的有效期
+func (txPool *TxPool) checkValidity(tx *Transaction) error {
+	return tx.CheckValidity(txPool.height+1, txPool.timestamp)
+}
+
+func (txPool *TxPool) checkFeePayer(tx *Transaction) error {
+	payer, err := FeePayer(txPool.getSigner(), tx)
+	if err != nil {
+		return err
+	}
+	payerAccount, err := txPool.getaccount(payer)
+	if err != nil {
+		return err
+	}
+	if payerAccount.IsMultisig() {
+		return ErrMultisigFeePayer
+	}
+	maxFee := new(big.Int).Mul(tx.GetGasFeeCap(), new(big.Int).SetUint64(tx.GasLimit))
+	if maxFee.Cmp(new(big.Int).SetUint64(payerAccount.Balance)) > 0 {
+		return ErrInsufficientPayerFunds
+	}
+	return nil
+}
+
+func (txPool *TxPool) getaccount(addr common.Address) (*common.Account, error) {
 	addrBytes := addr.Bytes()
-	accountBytes, err := txPool.StatDB.Get(addrBytes)
+	accountBytes, err := txPool.snaps.Get(txPool.StatDB, addrBytes)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if accountBytes == nil {
-		return 0, nil // New account starts with nonce 0
+		return &common.Account{}, nil // New account starts with nonce 0
 	}
-	accountvalue := common.Reserialize(accountBytes)
-	nonce := accountvalue.Nonce
-	return nonce, nil
+	return common.Reserialize(accountBytes), nil
 }
@@ -0,0 +1,177 @@
+package tx
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// LegacyTxType 没有类型字节的旧交易，编码是一个RLP列表
+const LegacyTxType = 0x00
+
+var (
+	// ErrTxTypeNotSupported 未知的交易类型
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	// ErrEmptyTypedTx 类型化交易的编码太短
+	ErrEmptyTypedTx = errors.New("empty typed transaction bytes")
+
+	errEmptyTx = errors.New("empty transaction bytes")
+)
+
+// TypedTxData 类型化交易（EIP-2718）在 TxData 公共字段之外各自的部分。
+// 它决定类型字节、编码的字段顺序和签名内容，legacy 交易的 Inner 为 nil
+type TypedTxData interface {
+	TxType() byte
+	// copy returns a deep copy of the type specific fields
+	copy() TypedTxData
+	// fields returns the fields of tx in the encoding order of this type, signature excluded
+	fields(tx *Transaction) []interface{}
+	// decode fills tx from the RLP list that follows the type byte
+	decode(payload []byte, tx *Transaction) error
+	// setJSON and fromJSON move the type specific fields in and out of the JSON form
+	setJSON(enc *txJSON)
+	fromJSON(dec *txJSON, tx *Transaction) error
+}
+
+// txTypes 已知的交易类型，新类型在 init 里注册
+var txTypes = map[byte]func() TypedTxData{}
+
+// registerTxType 注册一种交易类型，类型字节必须在 [1, 0x7f] 内，不能和 RLP 列表的首字节冲突
+func registerTxType(txType byte, newData func() TypedTxData) {
+	if txType == LegacyTxType || txType > 0x7f {
+		panic("invalid transaction type")
+	}
+	txTypes[txType] = newData
+}
+
+// newTypedTxData 按类型字节创建对应的空数据
+func newTypedTxData(txType byte) (TypedTxData, error) {
+	newData, ok := txTypes[txType]
+	if !ok {
+		return nil, ErrTxTypeNotSupported
+	}
+	return newData(), nil
+}
+
+// Type returns the EIP-2718 type of the transaction, LegacyTxType for legacy transactions
+func (tx *Transaction) Type() byte {
+	if tx.Inner == nil {
+		return LegacyTxType
+	}
+	return tx.Inner.TxType()
+}
+
+// Copy returns a deep copy of the transaction
+func (tx *Transaction) Copy() *Transaction {
+	cpy := &Transaction{
+		TxData: TxData{
+			Nonce:    tx.Nonce,
+			GasPrice: copyBig(tx.GasPrice),
+			GasLimit: tx.GasLimit,
+			Value:    copyBig(tx.Value),
+			Data:     append([]byte(nil), tx.Data...),
+			ChainID:  copyBig(tx.ChainID),
+		},
+		SignatureData: SignatureData{V: copyBig(tx.V), R: copyBig(tx.R), S: copyBig(tx.S)},
+	}
+	if tx.To != nil {
+		to := *tx.To
+		cpy.To = &to
+	}
+	if tx.Inner != nil {
+		cpy.Inner = tx.Inner.copy()
+	}
+	return cpy
+}
+
+// encodeTyped 类型化交易的规范编码：类型字节 || RLP(字段..., v, r, s)
+func (tx *Transaction) encodeTyped() ([]byte, error) {
+	v, r, s := tx.V, tx.R, tx.S
+	if v == nil {
+		v = new(big.Int)
+	}
+	if r == nil {
+		r = new(big.Int)
+	}
+	if s == nil {
+		s = new(big.Int)
+	}
+	payload, err := rlp.EncodeToBytes(append(tx.Inner.fields(tx), v, r, s))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{tx.Inner.TxType()}, payload...), nil
+}
+
+// decodeTyped 按首字节找到交易类型，解出剩下的字段
+func decodeTyped(data []byte) (*Transaction, error) {
+	if len(data) <= 1 {
+		return nil, ErrEmptyTypedTx
+	}
+	inner, err := newTypedTxData(data[0])
+	if err != nil {
+		return nil, err
+	}
+	tx := &Transaction{Inner: inner}
+	if err := inner.decode(data[1:], tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// EncodeRLP 放在区块等RLP结构里时，legacy 交易是列表本身，类型化交易是包着规范编码的字节串
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	if tx.Inner == nil {
+		return rlp.Encode(w, tx.legacyFields())
+	}
+	data, err := tx.encodeTyped()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, data)
+}
+
+// DecodeRLP 按RLP的种类区分：列表是 legacy 交易，字节串是类型化交易
+func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
+	kind, _, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	var decoded *Transaction
+	if kind == rlp.List {
+		raw, err := s.Raw()
+		if err != nil {
+			return err
+		}
+		decoded, err = decodeLegacy(raw)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err := s.Bytes()
+		if err != nil {
+			return err
+		}
+		decoded, err = decodeTyped(data)
+		if err != nil {
+			return err
+		}
+	}
+	tx.setDecoded(decoded)
+	return nil
+}
+
+// setDecoded 用解码出的交易替换 tx 的内容，tx 上缓存的发送者作废
+func (tx *Transaction) setDecoded(decoded *Transaction) {
+	tx.TxData, tx.SignatureData, tx.Inner = decoded.TxData, decoded.SignatureData, decoded.Inner
+	tx.from.Store(nil)
+}
+
+func copyBig(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// EIP-2929 执行中访问账户的费用，本笔交易第一次访问是冷的，之后是热的。
+// vm 还没有读存储的指令，访问列表里声明的存储槽只按固有gas收费，执行时不会再用到
+const (
+	ColdAccountAccessCost uint64 = 2600
+	WarmStorageReadCost   uint64 = 100
+)
+
+// ErrOutOfGas 执行消耗的gas超过了交易的 GasLimit
+var ErrOutOfGas = errors.New("out of gas")
+
+// accessList 账户和存储槽的集合，vm 用它记本笔交易访问过的账户，每笔交易开始时重新生成
+type accessList struct {
+	addresses map[common.Address]map[common.Hash]struct{}
+}
+
+func newAccessList() *accessList {
+	return &accessList{addresses: make(map[common.Address]map[common.Hash]struct{})}
+}
+
+// addAddress 返回账户之前是否已经在列表里
+func (al *accessList) addAddress(addr common.Address) bool {
+	if _, ok := al.addresses[addr]; ok {
+		return true
+	}
+	al.addresses[addr] = make(map[common.Hash]struct{})
+	return false
+}
+
+// addSlot 返回存储槽之前是否已经在列表里，账户也一起加入
+func (al *accessList) addSlot(addr common.Address, slot common.Hash) bool {
+	al.addAddress(addr)
+	if _, ok := al.addresses[addr][slot]; ok {
+		return true
+	}
+	al.addresses[addr][slot] = struct{}{}
+	return false
+}
+
+// prepareAccessList 交易开始时，发送者、接收者（或新合约）、coinbase 和交易声明的账户都是热的
+func (vm *VM) prepareAccessList(sender common.Address, dst common.Address, list tx.AccessList) {
+	vm.accessList = newAccessList()
+	vm.execGas = 0
+	vm.accessList.addAddress(sender)
+	vm.accessList.addAddress(dst)
+	vm.accessList.addAddress(vm.coinbase)
+	for _, tuple := range list {
+		vm.accessList.addAddress(tuple.Address)
+	}
+}
+
+// AddressInAccessList reports whether addr has been accessed by the executing transaction
+func (vm *VM) AddressInAccessList(addr common.Address) bool {
+	if vm.accessList == nil {
+		return false
+	}
+	_, ok := vm.accessList.addresses[addr]
+	return ok
+}
+
+// accessAccount 执行中访问 addr 时收费并返回收取的gas：第一次 ColdAccountAccessCost，之后 WarmStorageReadCost
+func (vm *VM) accessAccount(addr common.Address) uint64 {
+	if vm.accessList == nil {
+		vm.accessList = newAccessList()
+	}
+	if vm.tracer != nil {
+		vm.tracer.addAddress(addr)
+	}
+	cost := ColdAccountAccessCost
+	if vm.accessList.addAddress(addr) {
+		cost = WarmStorageReadCost
+	}
+	vm.execGas += cost
+	return cost
+}
+
+// AccessListTracer records the accounts touched while executing, the storage slots of the starting list are kept.
+// The sender and the recipient are always warm and left out
+type AccessListTracer struct {
+	excl map[common.Address]struct{}
+	list *accessList
+}
+
+// NewAccessListTracer creates a tracer starting from the given access list, addresses in excl are never recorded
+func NewAccessListTracer(list tx.AccessList, excl ...common.Address) *AccessListTracer {
+	tracer := &AccessListTracer{excl: make(map[common.Address]struct{}), list: newAccessList()}
+	for _, addr := range excl {
+		tracer.excl[addr] = struct{}{}
+	}
+	for _, tuple := range list {
+		tracer.addAddress(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			tracer.addSlot(tuple.Address, key)
+		}
+	}
+	return tracer
+}
+
+func (t *AccessListTracer) addAddress(addr common.Address) {
+	if _, ok := t.excl[addr]; !ok {
+		t.list.addAddress(addr)
+	}
+}
+
+func (t *AccessListTracer) addSlot(addr common.Address, slot common.Hash) {
+	//被排除的账户的存储槽也原样保留
+	t.list.addSlot(addr, slot)
+}
+
+// GetAccessList returns the recorded accesses, sorted so the result is deterministic
+func (t *AccessListTracer) GetAccessList() tx.AccessList {
+	list := make(tx.AccessList, 0, len(t.list.addresses))
+	for addr, slots := range t.list.addresses {
+		tuple := tx.AccessTuple{Address: addr, StorageKeys: make([]common.Hash, 0, len(slots))}
+		for slot := range slots {
+			tuple.StorageKeys = append(tuple.StorageKeys, slot)
+		}
+		sort.Slice(tuple.StorageKeys, func(i, j int) bool {
+			return bytes.Compare(tuple.StorageKeys[i][:], tuple.StorageKeys[j][:]) < 0
+		})
+		list = append(list, tuple)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0
+	})
+	return list
+}
+
+// size 列表里账户和存储槽的总数，只增不减
+func (t *AccessListTracer) size() int {
+	n := len(t.list.addresses)
+	for _, slots := range t.list.addresses {
+		n += len(slots)
+	}
+	return n
+}
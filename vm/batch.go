@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+)
+
+// executeBatch 先扣gas费和nonce，再在快照上依次执行各笔调用。任何一笔失败就回滚全部调用，
+// 交易仍然上链并收取gas费，收据状态为失败，每笔调用的结果记在收据里
+func (vm *VM) executeBatch(sender common.Address, calls []tx.BatchCall, totalCost *big.Int) error {
+	senderAccount, err := vm.GetAccount(sender)
+	if err != nil {
+		return err
+	}
+	senderAccount.Balance -= totalCost.Uint64()
+	senderAccount.Nonce++
+	if err := vm.SetAccount(sender, senderAccount); err != nil {
+		return err
+	}
+
+	snapshot, logs := vm.Snapshot(), len(vm.logs)
+	vm.callResults = make([]tx.CallResult, len(calls))
+	var failed error
+	for i, call := range calls {
+		if failed != nil {
+			vm.callResults[i] = tx.CallResult{Status: tx.ReceiptStatusFailed, Error: "not executed"}
+			continue
+		}
+		if failed = vm.applyCall(sender, call); failed != nil {
+			vm.callResults[i] = tx.CallResult{Status: tx.ReceiptStatusFailed, Error: failed.Error()}
+			continue
+		}
+		vm.callResults[i] = tx.CallResult{Status: tx.ReceiptStatusSuccessful}
+	}
+	if failed != nil {
+		vm.RevertToSnapshot(snapshot)
+		vm.logs = vm.logs[:logs]
+		vm.failed = true
+	}
+	return nil
+}
+
+// applyCall 批量交易中的一笔调用：从发送者转出金额，调用合约时记日志，发给自己时可以修改所有者
+func (vm *VM) applyCall(sender common.Address, call tx.BatchCall) error {
+	if call.To.IsZero() {
+		return errors.New("batch call cannot create contracts")
+	}
+	value := call.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	if value.Sign() < 0 || !value.IsUint64() {
+		return errors.New("invalid value")
+	}
+	//每笔调用都访问目标账户，没在访问列表里声明的第一次访问是冷的
+	vm.accessAccount(call.To)
+
+	senderAccount, err := vm.GetAccount(sender)
+	if err != nil {
+		return err
+	}
+	if senderAccount.Balance < value.Uint64() {
+		return errors.New("insufficient balance")
+	}
+	senderAccount.Balance -= value.Uint64()
+	if err := vm.SetAccount(sender, senderAccount); err != nil {
+		return err
+	}
+	receiverAccount, err := vm.GetAccount(call.To)
+	if err != nil {
+		return err
+	}
+	receiverAccount.Balance += value.Uint64()
+	if err := vm.SetAccount(call.To, receiverAccount); err != nil {
+		return err
+	}
+
+	if call.To == sender {
+		return vm.applyOwnerUpdate(sender, call.Data)
+	}
+	if len(receiverAccount.Code) > 0 {
+		vm.AddLog(callLog(call.To, call.Data))
+	}
+	return nil
+}
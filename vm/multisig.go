@@ -0,0 +1,20 @@
+package vm
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+)
+
+// applyOwnerUpdate 发给自己的交易的 data 是所有者变更时，替换账户的所有者和门限
+func (vm *VM) applyOwnerUpdate(addr common.Address, data []byte) error {
+	update, ok, err := tx.DecodeOwnerUpdate(data)
+	if err != nil || !ok {
+		return err
+	}
+	account, err := vm.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+	account.Owners, account.Threshold = update.Owners, update.Threshold
+	return vm.SetAccount(addr, account)
+}
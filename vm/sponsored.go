@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"blockchain/common"
+	"blockchain/tx"
+	"math/big"
+)
+
+// chargeFeePayer 代付交易先从代付方扣掉按实际单价预付的gas费，余额要够按最高单价付
+func (vm *VM) chargeFeePayer(payer common.Address, maxFee, fee *big.Int) error {
+	payerAccount, err := vm.GetAccount(payer)
+	if err != nil {
+		return err
+	}
+	if payerAccount.IsMultisig() {
+		return tx.ErrMultisigFeePayer
+	}
+	if maxFee.Cmp(new(big.Int).SetUint64(payerAccount.Balance)) > 0 {
+		return tx.ErrInsufficientPayerFunds
+	}
+	payerAccount.Balance -= fee.Uint64()
+	return vm.SetAccount(payer, payerAccount)
+}
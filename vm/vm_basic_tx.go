@@ -3,17 +3,53 @@ package vm
 import (
 	"blockchain/common"
 	"blockchain/mpt"
+	"blockchain/snapshot"
 	"blockchain/tx"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 )
 
 // VM represents the Ethereum Virtual Machine
 type VM struct {
 	stateDB   *mpt.MPT
 	mintCount map[string]int // 每个地址独立的mint计数
+
+	coinbase common.Address //手续费的收款方，即区块头的 Coinbase
+	gasUsed  uint64         //本 vm 执行过的交易累计消耗的gas
+	issued   uint64         //本 vm 新发行的币（出块补贴和mint），用于统计总发行量
+	baseFee  *big.Int       //区块头的 BaseFee，每单位gas的这部分手续费销毁；nil 表示没有
+	burnt    uint64         //本 vm 销毁的 baseFee 手续费
+
+	height    uint64 //区块头的 Height，检查交易的有效期
+	timestamp uint64 //区块头的 Timestamp，检查交易的有效期
+
+	dirties     map[string][]byte //还没写进 stateDB 的账户，交易失败时整体丢弃
+	journal     []journalEntry    //dirties 的修改记录，用于回滚到快照
+	deferCommit bool              //为true时执行完交易也不写 stateDB，等显式 Commit
+
+	logs        []*tx.Log       //正在执行的交易产生的日志
+	failed      bool            //正在执行的交易上链但执行被回滚（批量交易有调用失败）
+	callResults []tx.CallResult //正在执行的批量交易每笔调用的结果
+	receipts    []*tx.Receipt   //本 vm 打包的交易的收据，按执行顺序
+
+	signer        tx.Signer         //恢复发送者，链ID不对的交易拒绝执行
+	snaps         *snapshot.Tree    //读账户时先查快照，可以为nil
+	committedFrom common.Hash       //第一次 Commit 前 stateDB 的根
+	committed     map[string][]byte //写进过 stateDB 的账户，作为快照的差异层
+
+	accessList *accessList       //正在执行的交易访问过的账户
+	execGas    uint64            //正在执行的交易在固有gas之外消耗的gas
+	tracer     *AccessListTracer //不为nil时记录执行中访问的账户
+}
+
+// journalEntry 一次 SetAccount 覆盖之前 dirties 里的值
+type journalEntry struct {
+	key   string
+	prev  []byte
+	dirty bool //之前 dirties 里是否已有该账户
 }
 
 // NewVM creates a new VM instance
@@ -21,64 +57,357 @@ func NewVM(stateDB *mpt.MPT) *VM {
 	return &VM{
 		stateDB:   stateDB,
 		mintCount: make(map[string]int),
+		dirties:   make(map[string][]byte),
+		signer:    tx.LatestSignerForChainID(tx.DefaultChainID),
+	}
+}
+
+// Snapshot returns an identifier of the current uncommitted state
+func (vm *VM) Snapshot() int {
+	return len(vm.journal)
+}
+
+// RevertToSnapshot discards every account change made after the snapshot was taken
+func (vm *VM) RevertToSnapshot(id int) {
+	for i := len(vm.journal) - 1; i >= id; i-- {
+		entry := vm.journal[i]
+		if entry.dirty {
+			vm.dirties[entry.key] = entry.prev
+		} else {
+			delete(vm.dirties, entry.key)
+		}
 	}
+	vm.journal = vm.journal[:id]
+}
+
+// DeferCommit keeps executed transactions in memory until Commit is called,
+// so a block under construction can be dropped without touching the state trie
+func (vm *VM) DeferCommit() {
+	vm.deferCommit = true
+}
+
+func (vm *VM) autoCommit() error {
+	if vm.deferCommit {
+		return nil
+	}
+	return vm.Commit()
+}
+
+// Commit writes the uncommitted accounts into the state trie in key order,
+// so the resulting root only depends on the final values
+func (vm *VM) Commit() error {
+	if vm.committed == nil {
+		vm.committedFrom = vm.stateDB.RootHash()
+		vm.committed = make(map[string][]byte)
+	}
+	keys := make([]string, 0, len(vm.dirties))
+	for key := range vm.dirties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := vm.stateDB.Put([]byte(key), vm.dirties[key]); err != nil {
+			return err
+		}
+		vm.committed[key] = vm.dirties[key]
+	}
+	vm.dirties = make(map[string][]byte)
+	vm.journal = nil
+	return nil
+}
+
+// SetSigner sets the signature scheme, and thereby the chain ID, of the transactions this VM executes
+func (vm *VM) SetSigner(signer tx.Signer) {
+	vm.signer = signer
+}
+
+// SetSnapshots makes account reads consult the snapshot layers before the state trie
+func (vm *VM) SetSnapshots(snaps *snapshot.Tree) {
+	vm.snaps = snaps
+}
+
+// GetStateDiff returns the state root before the first Commit and every account committed since
+func (vm *VM) GetStateDiff() (common.Hash, map[string][]byte) {
+	return vm.committedFrom, vm.committed
+}
+
+// SetCoinbase sets the account receiving the fees of executed transactions
+func (vm *VM) SetCoinbase(coinbase common.Address) {
+	vm.coinbase = coinbase
 }
 
-// ExecuteTransaction executes a transaction and updates the state
-func (vm *VM) ExecuteTransaction(tx *tx.Transaction) error {
+// SetBaseFee sets the base fee of the block, the base fee part of every transaction fee is burnt
+func (vm *VM) SetBaseFee(baseFee *big.Int) {
+	vm.baseFee = baseFee
+}
+
+// SetBlock sets the height and timestamp of the block, transactions outside their validity bounds are rejected
+func (vm *VM) SetBlock(height, timestamp uint64) {
+	vm.height, vm.timestamp = height, timestamp
+}
+
+// GetBurnt returns the fees burnt by the transactions executed so far
+func (vm *VM) GetBurnt() uint64 {
+	return vm.burnt
+}
+
+// GetGasUsed returns the gas consumed by all transactions executed so far
+func (vm *VM) GetGasUsed() uint64 {
+	return vm.gasUsed
+}
+
+// GetIssued returns the amount of new coins created through this VM
+func (vm *VM) GetIssued() uint64 {
+	return vm.issued
+}
+
+// GetReceipts returns the receipts of the transactions executed so far
+func (vm *VM) GetReceipts() []*tx.Receipt {
+	return vm.receipts
+}
+
+// AddLog records a log emitted by the transaction being executed
+func (vm *VM) AddLog(log *tx.Log) {
+	vm.logs = append(vm.logs, log)
+}
+
+// ExecuteTransaction executes a transaction and updates the state, a failed transaction leaves the state untouched
+func (vm *VM) ExecuteTransaction(transaction *tx.Transaction) error {
+	snapshot, gasUsed := vm.Snapshot(), vm.gasUsed
+	vm.logs, vm.failed, vm.callResults = nil, false, nil
+	if err := vm.applyTransaction(transaction); err != nil {
+		vm.RevertToSnapshot(snapshot)
+		vm.logs, vm.failed, vm.callResults = nil, false, nil
+		return err
+	}
+	if err := vm.autoCommit(); err != nil {
+		return err
+	}
+	vm.receipts = append(vm.receipts, vm.newReceipt(transaction, vm.gasUsed-gasUsed))
+	return nil
+}
+
+// newReceipt 用刚执行完的交易的日志生成收据，区块信息在封装后补上
+func (vm *VM) newReceipt(transaction *tx.Transaction, gasUsed uint64) *tx.Receipt {
+	receipt := &tx.Receipt{
+		Status:            tx.ReceiptStatusSuccessful,
+		CumulativeGasUsed: vm.gasUsed,
+		Logs:              vm.logs,
+		GasUsed:           gasUsed,
+		TxIndex:           uint(len(vm.receipts)),
+		Type:              transaction.Type(),
+		CallResults:       vm.callResults,
+	}
+	if vm.failed {
+		receipt.Status = tx.ReceiptStatusFailed
+	}
+	if hash := transaction.Hash(); hash != nil {
+		receipt.TxHash = *hash
+	}
+	if receipt.Logs == nil {
+		receipt.Logs = []*tx.Log{}
+	}
+	receipt.Bloom = tx.CreateBloom([]*tx.Receipt{receipt})
+	if transaction.IsContractCreation() {
+		if sender, err := tx.Sender(vm.signer, transaction); err == nil {
+			receipt.ContractAddress = contractAddress(sender, transaction.Nonce)
+		}
+	}
+	vm.logs, vm.failed, vm.callResults = nil, false, nil
+	return receipt
+}
+
+// contractAddress 创建合约时新账户的地址，由发送者和交易nonce决定
+func contractAddress(sender common.Address, nonce uint64) common.Address {
+	nonceBytes := []byte{byte(nonce)}
+	hash := common.Hash{}.NewHash(append(sender.Bytes(), nonceBytes...))
+	return common.Address{}.NewAddress(hash[:20])
+}
+
+// applyTransaction 执行交易，修改只记在 dirties 里
+func (vm *VM) applyTransaction(transaction *tx.Transaction) error {
 	// 1. 验证交易
-	if err := vm.validateTransaction(tx); err != nil {
+	if err := vm.validateTransaction(transaction); err != nil {
 		return err
 	}
 
-	// 2. 获取发送者地址
-	sender, err := tx.GetSender()
+	// 2. 获取发送者地址，签名不是本链的交易在这里被拒绝
+	sender, err := tx.Sender(vm.signer, transaction)
 	if err != nil {
 		return err
 	}
 
+	// 多签账户要有足够多的所有者签名，也只能发多签交易
+	senderAccount, err := vm.GetAccount(sender)
+	if err != nil {
+		return err
+	}
+	if err := tx.VerifyMultisig(vm.signer, transaction, senderAccount); err != nil {
+		return err
+	}
+	// 交易按发送者的 nonce 依次执行：账户 nonce 从0开始，下一笔交易的 nonce 是它加1。
+	// 打包、导入区块和校验提议都走这里，重放和跳号的交易一律拒绝
+	if transaction.Nonce <= senderAccount.Nonce {
+		return tx.ErrNonceTooLow
+	}
+	if transaction.Nonce > senderAccount.Nonce+1 {
+		return tx.ErrNonceTooHigh
+	}
+
+	// 代付交易的gas费由代付方付，代付签名在这里检查
+	payer, err := tx.FeePayer(vm.signer, transaction)
+	if err != nil {
+		return err
+	}
+	return vm.applyMessage(transaction, sender, payer)
+}
+
+// applyMessage 以 sender 的身份执行交易内容，gas费由 payer 付，不再检查签名
+func (vm *VM) applyMessage(tx *tx.Transaction, sender, payer common.Address) error {
 	// 3. 检查发送者余额
 	senderAccount, err := vm.GetAccount(sender)
 	if err != nil {
 		return err
 	}
 
-	// 计算交易总成本
-	totalCost := new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(tx.GasLimit))
-	totalCost.Add(totalCost, tx.Value)
+	// 先按 GasLimit 和实际单价预扣gas费，执行后按实际消耗退还；余额要够按最高单价付
+	gas := new(big.Int).SetUint64(tx.GasLimit)
+	gasCost := new(big.Int).Mul(tx.GetEffectiveGasPrice(vm.baseFee), gas)
+	totalCost := new(big.Int).Add(gasCost, tx.Value)
+	maxCost := new(big.Int).Add(new(big.Int).Mul(tx.GetGasFeeCap(), gas), tx.Value)
+	if payer != sender {
+		// 代付：先从代付方扣gas费，发送者只付转账金额
+		if err := vm.chargeFeePayer(payer, new(big.Int).Mul(tx.GetGasFeeCap(), gas), gasCost); err != nil {
+			return err
+		}
+		totalCost, maxCost = tx.Value, tx.Value
+	}
 
 	// 将总成本转换为uint64进行比较
-	if totalCost.Cmp(new(big.Int).SetUint64(senderAccount.Balance)) > 0 {
+	if maxCost.Cmp(new(big.Int).SetUint64(senderAccount.Balance)) > 0 {
 		fmt.Printf("Debug - Insufficient balance: have %v, need %v\n", senderAccount.Balance, totalCost)
 		return errors.New("insufficient balance")
 	}
 
+	// 访问列表：发送者、接收者或新合约以及交易声明的账户是热的
+	dst := contractAddress(sender, tx.Nonce)
+	if tx.To != nil && !tx.To.IsZero() {
+		dst = *tx.To
+	}
+	vm.prepareAccessList(sender, dst, tx.GetAccessList())
+
 	// 4. 执行交易
-	if tx.To == nil || (tx.To.IsZero() && len(tx.Data) != 0) {
+	if calls := tx.GetBatchCalls(); calls != nil {
+		err = vm.executeBatch(sender, calls, totalCost)
+	} else if tx.IsContractCreation() {
 		// 执行VM层操作
-		fmt.Printf("oftiyfdebug\n")
-		return vm.executeVMOperation(tx, sender, totalCost)
+		err = vm.executeVMOperation(tx, sender, totalCost)
 	} else {
 		// 普通转账或合约调用
-		return vm.transfer(tx, sender, totalCost)
+		err = vm.transfer(tx, sender, totalCost)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 5. 结算gas：固有gas加上执行中访问账户的费用
+	gasUsed := tx.IntrinsicGas() + vm.execGas
+	if gasUsed > tx.GasLimit {
+		return ErrOutOfGas
+	}
+	return vm.settleGas(tx, payer, gasUsed)
+}
+
+// settleGas 把未用完的gas退还给付gas费的账户，已用的gas费中 baseFee 部分销毁，其余作为小费付给 coinbase
+func (vm *VM) settleGas(tx *tx.Transaction, payer common.Address, gasUsed uint64) error {
+	price := tx.GetEffectiveGasPrice(vm.baseFee).Uint64()
+	if refund := (tx.GasLimit - gasUsed) * price; refund > 0 {
+		payerAccount, err := vm.GetAccount(payer)
+		if err != nil {
+			return err
+		}
+		payerAccount.Balance += refund
+		if err := vm.SetAccount(payer, payerAccount); err != nil {
+			return err
+		}
+	}
+	//Call 可以不付gas费，单价低于 baseFee 时只销毁实际付的部分
+	var burn uint64
+	if vm.baseFee != nil {
+		burn = price
+		if vm.baseFee.Cmp(new(big.Int).SetUint64(price)) < 0 {
+			burn = vm.baseFee.Uint64()
+		}
+	}
+	if err := vm.addBalance(vm.coinbase, gasUsed*(price-burn)); err != nil {
+		return err
+	}
+	vm.burnt += gasUsed * burn
+	vm.gasUsed += gasUsed
+	return nil
+}
+
+func (vm *VM) addBalance(addr common.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
 	}
+	account, err := vm.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+	account.Balance += amount
+	return vm.SetAccount(addr, account)
+}
+
+// AddBalance credits an existing balance, moving coins without creating any
+func (vm *VM) AddBalance(addr common.Address, amount uint64) error {
+	if err := vm.addBalance(addr, amount); err != nil {
+		return err
+	}
+	return vm.autoCommit()
+}
+
+// Reward credits newly issued coins, e.g. the block subsidy, and counts them into the supply
+func (vm *VM) Reward(addr common.Address, amount uint64) error {
+	if err := vm.AddBalance(addr, amount); err != nil {
+		return err
+	}
+	vm.issued += amount
+	return nil
 }
 
 // validateTransaction validates a transaction
-func (vm *VM) validateTransaction(tx *tx.Transaction) error {
-	if tx == nil {
+func (vm *VM) validateTransaction(transaction *tx.Transaction) error {
+	if transaction == nil {
 		return errors.New("transaction is nil")
 	}
-	if tx.GasPrice == nil || tx.GasPrice.Sign() <= 0 {
+	if transaction.GasPrice == nil || transaction.GasPrice.Sign() <= 0 {
 		return errors.New("invalid gas price")
 	}
-	if tx.GasLimit == 0 {
+	if tipCap := transaction.GetGasTipCap(); tipCap == nil || tipCap.Sign() < 0 {
+		return errors.New("invalid gas tip cap")
+	} else if tipCap.Cmp(transaction.GetGasFeeCap()) > 0 {
+		return tx.ErrTipAboveFeeCap
+	}
+	if vm.baseFee == nil && transaction.Type() == tx.DynamicFeeTxType {
+		return tx.ErrNoBaseFee
+	}
+	if vm.baseFee != nil && transaction.GetGasFeeCap().Cmp(vm.baseFee) < 0 {
+		return tx.ErrFeeCapTooLow
+	}
+	if transaction.GasLimit == 0 {
 		return errors.New("invalid gas limit")
 	}
-	if tx.Value == nil || tx.Value.Sign() < 0 {
+	if transaction.GasLimit < transaction.IntrinsicGas() {
+		return errors.New("intrinsic gas too low")
+	}
+	if transaction.Value == nil || transaction.Value.Sign() < 0 {
 		return errors.New("invalid value")
 	}
-	return nil
+	if transaction.Type() == tx.BatchTxType && len(transaction.GetBatchCalls()) == 0 {
+		return tx.ErrEmptyBatch
+	}
+	return transaction.CheckValidity(vm.height, vm.timestamp)
 }
 
 // GetAccount retrieves the account of an address
@@ -86,7 +415,11 @@ func (vm *VM) GetAccount(addr common.Address) (*common.Account, error) {
 	// 使用地址的原始字节作为键
 	key := addr.Bytes()
 	fmt.Printf("Debug - Getting account with key: %x\n", key)
-	accountData, err := vm.stateDB.Get(key)
+	accountData, ok := vm.dirties[string(key)]
+	var err error
+	if !ok {
+		accountData, err = vm.snaps.Get(vm.stateDB, key)
+	}
 	if err != nil {
 		// 如果账户不存在，返回新账户
 		fmt.Printf("Debug - Account not found: %v\n", addr)
@@ -105,7 +438,7 @@ func (vm *VM) GetAccount(addr common.Address) (*common.Account, error) {
 	return &account, nil
 }
 
-// SetAccount sets the account of an address
+// SetAccount sets the account of an address, the change is kept uncommitted until Commit
 func (vm *VM) SetAccount(addr common.Address, account *common.Account) error {
 	// 使用地址的原始字节作为键
 	key := addr.Bytes()
@@ -116,7 +449,10 @@ func (vm *VM) SetAccount(addr common.Address, account *common.Account) error {
 		return err
 	}
 	fmt.Printf("Debug - Setting account for %v: balance=%v, nonce=%v\n", addr, account.Balance, account.Nonce)
-	return vm.stateDB.Put(key, accountData)
+	prev, dirty := vm.dirties[string(key)]
+	vm.journal = append(vm.journal, journalEntry{key: string(key), prev: prev, dirty: dirty})
+	vm.dirties[string(key)] = accountData
+	return nil
 }
 
 // executeVMOperation handles VM-level operations
@@ -125,13 +461,11 @@ func (vm *VM) executeVMOperation(tx *tx.Transaction, sender common.Address, tota
 	case tx.To == nil || tx.To.IsZero():
 		// 创建新合约
 		// 计算操作地址
-		nonceBytes := []byte{byte(tx.Nonce)}
-		hash := common.Hash{}.NewHash(append(sender.Bytes(), nonceBytes...))
-		operationAddr := common.Address{}.NewAddress(hash[:20])
+		operationAddr := contractAddress(sender, tx.Nonce)
 
 		// 检查操作地址是否已存在
-		exists, err := vm.stateDB.Get(operationAddr.Bytes())
-		if err == nil && exists != nil {
+		exists, err := vm.snaps.Get(vm.stateDB, operationAddr.Bytes())
+		if _, ok := vm.dirties[string(operationAddr.Bytes())]; ok || (err == nil && exists != nil) {
 			return errors.New("operation address already exists")
 		}
 
@@ -223,10 +557,19 @@ func (vm *VM) transfer(tx *tx.Transaction, sender common.Address, totalCost *big
 		return err
 	}
 
+	// 发给自己的所有者变更：替换多签账户的所有者和门限，普通账户也可以这样变成多签账户
+	if *tx.To == sender {
+		if err := vm.applyOwnerUpdate(sender, tx.Data); err != nil {
+			return err
+		}
+	}
+
 	// 3. 如果是合约调用，执行合约代码
 	if len(receiverAccount.Code) > 0 {
 		// TODO: 实现合约代码执行逻辑
 		// 这里需要实现EVM的指令集和合约执行逻辑
+		// 在那之前把调用记成合约的日志：前4字节的哈希作为主题，其余作为数据
+		vm.AddLog(callLog(*tx.To, tx.Data))
 	}
 
 	return nil
@@ -260,8 +603,12 @@ func (vm *VM) Mint(addr common.Address) error {
 	fmt.Printf("Debug - After mint address: %v\n", addr)
 	fmt.Printf("Debug - After mint balance: %v\n", afterAccount.Balance)
 
+	if err := vm.autoCommit(); err != nil {
+		return err
+	}
 	// 增加mint计数
 	vm.mintCount[addrStr]++
+	vm.issued += mintAmount
 
 	return nil
 }
@@ -270,3 +617,18 @@ func (vm *VM) Mint(addr common.Address) error {
 func (vm *VM) GetMintCount(addr common.Address) int {
 	return vm.mintCount[addr.String()]
 }
+
+// callLog 合约调用产生的日志，没有调用数据时不带主题
+func callLog(contract common.Address, data []byte) *tx.Log {
+	log := &tx.Log{Address: contract, Topics: []common.Hash{}, Data: []byte{}}
+	if len(data) == 0 {
+		return log
+	}
+	selector := data
+	if len(selector) > 4 {
+		selector = selector[:4]
+	}
+	log.Topics = append(log.Topics, common.Hash{}.NewHash(selector))
+	log.Data = append(log.Data, data[len(selector):]...)
+	return log
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"blockchain/common"
+	"blockchain/mpt"
+	"blockchain/tx"
+	"errors"
+	"math/big"
+)
+
+// CallGasCap 没给gas上限的调用最多用这么多gas
+const CallGasCap uint64 = 25000000
+
+// CallMsg 不需要签名的调用参数，用于在某个状态上试执行交易
+type CallMsg struct {
+	From     common.Address
+	To       *common.Address //nil 表示创建合约
+	Value    *big.Int
+	GasLimit uint64   //为0时不超过 CallGasCap 和余额按单价付得起的gas
+	GasPrice *big.Int //为nil时不收gas费
+	Data     []byte
+
+	AccessList tx.AccessList  //预先声明的访问列表，不为空时按访问列表交易计算gas
+	Calls      []tx.BatchCall //不为空时按批量交易依次执行各笔调用，To、Value、Data 不用
+}
+
+// Call executes the message on top of the current state and discards every change,
+// it returns the gas the message would use
+func (vm *VM) Call(msg CallMsg) (uint64, error) {
+	call := &tx.Transaction{TxData: tx.TxData{
+		To:       msg.To,
+		Value:    msg.Value,
+		GasLimit: msg.GasLimit,
+		GasPrice: msg.GasPrice,
+		Data:     msg.Data,
+	}}
+	if len(msg.Calls) > 0 {
+		call.To, call.Value, call.Data = nil, nil, nil
+		call.Inner = &tx.BatchTx{Calls: msg.Calls, AccessList: msg.AccessList}
+	} else if len(msg.AccessList) > 0 {
+		call.Inner = &tx.AccessListTx{AccessList: msg.AccessList}
+	}
+	if call.Value == nil {
+		call.Value = new(big.Int)
+	}
+	if call.GasPrice == nil {
+		call.GasPrice = new(big.Int)
+	}
+	if call.Value.Sign() < 0 || call.GasPrice.Sign() < 0 {
+		return 0, errors.New("invalid value")
+	}
+	account, err := vm.GetAccount(msg.From)
+	if err != nil {
+		return 0, err
+	}
+	call.Nonce = account.Nonce + 1
+	gas := call.IntrinsicGas()
+	if call.GasLimit == 0 {
+		call.GasLimit = CallGasCap
+		if call.GasPrice.Sign() > 0 {
+			if affordable := new(big.Int).Div(new(big.Int).SetUint64(account.Balance), call.GasPrice); affordable.IsUint64() && affordable.Uint64() < call.GasLimit {
+				call.GasLimit = affordable.Uint64()
+			}
+		}
+	}
+	if call.GasLimit < gas {
+		return 0, errors.New("intrinsic gas too low")
+	}
+
+	snapshot, gasUsed, logs := vm.Snapshot(), vm.gasUsed, vm.logs
+	defer func() {
+		vm.RevertToSnapshot(snapshot)
+		vm.gasUsed, vm.logs = gasUsed, logs
+	}()
+	if err := vm.applyMessage(call, msg.From, msg.From); err != nil {
+		return 0, err
+	}
+	return gas + vm.execGas, nil
+}
+
+// CreateAccessList traces the message and returns the access list it needs, together with
+// the gas the message uses when sent with that list. The sender and the recipient are left out,
+// they are always warm
+func (vm *VM) CreateAccessList(msg CallMsg) (tx.AccessList, uint64, error) {
+	dst := contractAddress(msg.From, 0)
+	if account, err := vm.GetAccount(msg.From); err == nil {
+		dst = contractAddress(msg.From, account.Nonce+1)
+	}
+	if msg.To != nil && !msg.To.IsZero() {
+		dst = *msg.To
+	}
+	tracer := NewAccessListTracer(msg.AccessList, msg.From, dst)
+	defer func() { vm.tracer = nil }()
+	//带上访问列表后执行路径可能变化，重复执行直到列表不再增加
+	for {
+		size := tracer.size()
+		msg.AccessList = tracer.GetAccessList()
+		vm.tracer = tracer
+		gas, err := vm.Call(msg)
+		if err != nil {
+			return nil, 0, err
+		}
+		if tracer.size() == size {
+			return msg.AccessList, gas, nil
+		}
+	}
+}
+
+// Fork returns a VM reading stateDB underneath this VM's uncommitted changes,
+// it never writes to stateDB and is used to query the state of a block under construction
+func (vm *VM) Fork(stateDB *mpt.MPT) *VM {
+	fork := NewVM(stateDB)
+	for key, value := range vm.dirties {
+		fork.dirties[key] = value
+	}
+	fork.coinbase = vm.coinbase
+	fork.snaps = vm.snaps
+	fork.signer = vm.signer
+	fork.gasUsed = vm.gasUsed
+	fork.baseFee = vm.baseFee
+	fork.deferCommit = true
+	return fork
+}